@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var manifestPath string
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Provision an identity provider from a manifest",
+	Long: `The apply command provisions the identity provider recorded in a manifest written by
+"create identity-provider --manifest-out" again, e.g. to reconcile it from a GitOps
+repository. The key pair is generated with the recorded key size when missing from the
+output directory, and existing AWS resources are reused, so the manifest can be applied
+repeatedly.
+
+Example usage:
+  aws-oidc-sts apply --manifest manifest.json --output-dir /path/to/directory`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validateWebhookFlags(); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Invalid flags:"), err)
+			return
+		}
+
+		if err := validateOutputFormat(outputFormat); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), err.Error()))
+			return
+		}
+
+		manifest, err := providers.ReadManifest(manifestPath)
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to read manifest:"), err)
+			cmd.SilenceUsage = true
+			return
+		}
+
+		signer, err := openSigner()
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to open signer:"), err)
+			cmd.SilenceUsage = true
+			return
+		}
+		if signer != nil {
+			defer signer.Close()
+		}
+
+		result, err := providers.ApplyManifest(manifest, providers.Config{
+			OutputDir:              TargetDir,
+			WebIdentitySessionName: webIdentitySessionName,
+			Endpoints:              clientOptions(),
+			ReachableTimeout:       providers.DefaultReachableTimeout,
+			Strict:                 strict,
+			NoCheckpoint:           noCheckpoint,
+			JWKS: providers.JWKSOptions{
+				MinKeySize: minKeySize,
+				Signer:     signer,
+			},
+		})
+		if err != nil {
+			notifyWebhook(cmd, nil, err)
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to apply manifest:"), err)
+			cmd.SilenceUsage = true
+			return
+		}
+
+		if err := notifyWebhook(cmd, result, nil); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to notify webhook:"), err)
+			cmd.SilenceUsage = true
+			return
+		}
+
+		if outputFormat == outputText {
+			slog.Info("Manifest applied successfully.",
+				"Issuer", result.Issuer, "ProviderArn", result.ProviderARN, "KeyId", result.KeyID)
+			return
+		}
+		if err := printResult(cmd.OutOrStdout(), outputFormat, result); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to print result:"), err)
+		}
+	},
+}
+
+func init() {
+	applyCmd.Flags().StringVar(&manifestPath, "manifest", "", "Path of the manifest to apply (required)")
+	applyCmd.Flags().BoolVar(&noCheckpoint, "no-checkpoint", false, "Run every AWS step again, ignoring and not updating the "+providers.ProvisioningStateFileName+" state file")
+	applyCmd.Flags().StringVar(&outputFormat, "output-format", outputText, "Format of the result printed on success: text (log line), json or yaml")
+	addSignerFlags(applyCmd)
+	applyCmd.MarkFlagRequired("manifest")
+	addWebhookFlags(applyCmd)
+}
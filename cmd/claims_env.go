@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	issuerFromEnv  string
+	audFromEnv     string
+	subjectFromEnv string
+)
+
+// addClaimsFromEnvFlags registers the flags naming the environment variables the issuer,
+// audience and subject claims are read from.
+func addClaimsFromEnvFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&issuerFromEnv, "issuer-from-env", "", "Environment variable to read the \"iss\" claim from, unless --issuer is set")
+	cmd.Flags().StringVar(&audFromEnv, "aud-from-env", "", "Environment variable to read the comma-separated \"aud\" claim from, unless --aud is set")
+	cmd.Flags().StringVar(&subjectFromEnv, "sub-from-env", "", "Environment variable to read the \"sub\" claim from, unless --sub is set")
+}
+
+// resolveClaimsFromEnv reads the claims named by the --*-from-env flags from the environment.
+// An explicit claim flag takes precedence over its environment variable, which takes
+// precedence over the default. A named variable that is unset or empty is an error.
+func resolveClaimsFromEnv(cmd *cobra.Command) error {
+	if err := claimFromEnv(cmd, "issuer", issuerFromEnv, &issuer); err != nil {
+		return err
+	}
+	if err := claimFromEnv(cmd, "sub", subjectFromEnv, &jwtSubject); err != nil {
+		return err
+	}
+
+	var audiences string
+	if err := claimFromEnv(cmd, "aud", audFromEnv, &audiences); err != nil {
+		return err
+	}
+	if audiences != "" {
+		jwtAudiences = strings.Split(audiences, ",")
+	}
+
+	return nil
+}
+
+// claimFromEnv sets value from the environment variable envVar when it is named and the claim
+// flag was not set explicitly.
+func claimFromEnv(cmd *cobra.Command, flag, envVar string, value *string) error {
+	if envVar == "" || cmd.Flags().Changed(flag) {
+		return nil
+	}
+
+	envValue := os.Getenv(envVar)
+	if envValue == "" {
+		return fmt.Errorf("environment variable %s named by --%s-from-env is not set", envVar, flag)
+	}
+	*value = envValue
+
+	return nil
+}
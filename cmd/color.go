@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"io"
+	"os"
+)
+
+var (
+	noColor bool
+)
+
+const (
+	colorReset = "\033[0m"
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+)
+
+// colorEnabled reports whether ANSI colors may be written to w. Colors are disabled
+// by the --no-color flag, by a non-empty NO_COLOR environment variable, and whenever
+// w is not a terminal, so that redirected and machine-readable output stays plain.
+func colorEnabled(w io.Writer) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize wraps s in the given ANSI color when colors are enabled for w.
+func colorize(w io.Writer, color, s string) string {
+	if !colorEnabled(w) {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// failure renders a failure message for w, in red when colors are enabled.
+func failure(w io.Writer, s string) string {
+	return colorize(w, colorRed, s)
+}
+
+// success renders a success message for w, in green when colors are enabled.
+func success(w io.Writer, s string) string {
+	return colorize(w, colorGreen, s)
+}
+
+// statusLabel renders a PASS or FAIL indicator for w.
+func statusLabel(w io.Writer, ok bool) string {
+	if ok {
+		return success(w, "PASS")
+	}
+	return failure(w, "FAIL")
+}
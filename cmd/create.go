@@ -19,5 +19,7 @@ Example usage:
 func init() {
 	createCmd.AddCommand(rsaKeyPairCmd)
 	createCmd.AddCommand(identityProviderCmd)
+	createCmd.AddCommand(jwtCmd)
+	createCmd.AddCommand(gitlabCmd)
 
 }
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var roleARN string
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose common OIDC misconfigurations",
+	Long: `The doctor command runs a battery of diagnostics over the OIDC setup and prints
+a checklist with the outcome of each of them, along with a remediation hint for the
+failed ones:
+
+  - the key pair in the output directory is present and matching
+  - the local JWKS is valid and publishes the key pair
+  - the issuer is normalized
+  - the discovery document and the JWKS are reachable and valid
+  - the IAM OIDC provider exists, with the audiences of --audience as client IDs and
+    the thumbprint of the JWKS host
+  - the trust policy of the role matches the token claims and an actual
+    AssumeRoleWithWebIdentity call succeeds (with --role-arn)
+
+The issuer is given by --issuer, or derived from --bucket-name and --region. The subject
+defaults to the name of the role, as with identity-provider. The test token carries the
+audiences of --jwt-aud, all of --audience by default.
+
+Example usage:
+  aws-oidc-sts doctor --bucket-name my-s3-bucket --region us-east-1 --role-arn arn:aws:iam::123456789012:role/my-role
+  aws-oidc-sts doctor --issuer https://oidc.example.com --region us-east-1`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if issuer == "" && bucketName == "" {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Either --issuer or --bucket-name is required"))
+			return
+		}
+
+		subject, err := resolveSubject()
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), err.Error()))
+			return
+		}
+
+		checks := providers.Doctor(providers.DoctorOptions{
+			Config: &providers.Config{
+				OutputDir:              TargetDir,
+				BucketName:             bucketName,
+				Region:                 region,
+				IssuerOverride:         issuer,
+				WebIdentitySessionName: webIdentitySessionName,
+				Endpoints:              clientOptions(),
+				Audiences:              providerAudiences,
+				JWKS: providers.JWKSOptions{
+					KeyID:      keyID,
+					KeyIDHash:  keyIDHash,
+					MinKeySize: minKeySize,
+				},
+				JWT: providers.JWTOptions{
+					Subject:   subject,
+					Audiences: jwtAudiences,
+				},
+			},
+			RoleARN: roleARN,
+		})
+
+		out := cmd.OutOrStdout()
+		failed := 0
+		for _, check := range checks {
+			fmt.Fprintf(out, "[%s] %s\n", statusLabel(out, check.OK()), check.Name)
+			if !check.OK() {
+				failed++
+				fmt.Fprintf(out, "       %v\n       Hint: %s\n", check.Err, check.Hint)
+			}
+		}
+
+		if failed > 0 {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), fmt.Sprintf("%d of %d checks failed", failed, len(checks))))
+			cmd.SilenceUsage = true
+			return
+		}
+		fmt.Fprintln(out, success(out, fmt.Sprintf("All %d checks passed", len(checks))))
+	},
+}
+
+func init() {
+	doctorCmd.Flags().StringVar(&issuer, "issuer", "", "Issuer URL of the identity provider (defaults to the URL of --bucket-name)")
+	doctorCmd.Flags().StringVarP(&bucketName, "bucket-name", "b", "", "S3 bucket hosting the issuer")
+	doctorCmd.Flags().StringVarP(&region, "region", "r", "", "AWS region")
+	doctorCmd.Flags().StringVar(&roleARN, "role-arn", "", "ARN of the role assumed with the identity provider tokens")
+	doctorCmd.Flags().StringSliceVar(&providerAudiences, "audience", []string{providers.JWTAudience}, "Client ID expected on the IAM OIDC provider (repeatable)")
+	doctorCmd.Flags().StringSliceVar(&jwtAudiences, "jwt-aud", nil, "Audience (aud) of the test token, one of --audience (repeatable, defaults to all of them)")
+	addSubjectFlags(doctorCmd)
+	doctorCmd.Flags().StringVar(&keyIDHash, "kid-hash", providers.KeyIDHashSHA256, keyIDHashUsage)
+	doctorCmd.Flags().StringVar(&keyID, "kid", "", "Key ID (kid) the key pair is published with, when set with --kid on identity-provider")
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var (
+	p12Out         string
+	p12Password    string
+	p12PasswordEnv string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print values computed by the provisioning flow without calling AWS",
+	Long: `The export command prints values computed from the same inputs as the
+identity-provider command, without touching AWS, so that they can be pasted into the
+configuration of other systems.
+
+Example usage:
+  aws-oidc-sts export jwks-uri --bucket-name my-s3-bucket --region us-east-1
+  aws-oidc-sts export p12 --out bundle.p12 --password-env P12_PASSWORD`,
+}
+
+var exportJWKSURICmd = &cobra.Command{
+	Use:   "jwks-uri",
+	Short: "Print the jwks_uri advertised by the identity provider",
+	Long: `The jwks-uri command prints the jwks_uri the identity-provider command advertises
+for the same flags: the URL of the JWKS object under --key-prefix in the bucket or, with
+--issuer, the JWKS under the .well-known path of the external issuer.
+
+Example usage:
+  aws-oidc-sts export jwks-uri --bucket-name my-s3-bucket --region us-east-1
+  aws-oidc-sts export jwks-uri --bucket-name my-s3-bucket --region us-east-1 --key-prefix tenants/a
+  aws-oidc-sts export jwks-uri --issuer https://oidc.example.com`,
+	Run: func(cmd *cobra.Command, args []string) {
+		uri, err := providers.ExportJWKSURI(&providers.Config{
+			BucketName:      bucketName,
+			Region:          region,
+			KeyPrefix:       keyPrefix,
+			SkipBucket:      issuer != "" || jwksURI != "",
+			IssuerOverride:  issuer,
+			JWKSURIOverride: jwksURI,
+		})
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to compute the jwks_uri:"), err)
+			cmd.SilenceUsage = true
+			return
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), uri)
+	},
+}
+
+var exportP12Cmd = &cobra.Command{
+	Use:   "p12",
+	Short: "Bundle the private key and its certificate into a PKCS#12 file",
+	Long: `The p12 command bundles the private key of the key pair in the output directory and
+its self-signed certificate into a password-protected PKCS#12 (.p12/.pfx) file, for
+systems importing keys from Windows or Java keystores. The certificate is created when
+missing, and the bundle is written with mode 0600.
+
+The password must be at least 8 characters long. Prefer --password-env over --password
+to keep it out of the shell history and the process list.
+
+Example usage:
+  aws-oidc-sts export p12 --out bundle.p12 --password-env P12_PASSWORD
+  aws-oidc-sts export p12 --out /path/to/bundle.pfx --password 'correct horse' --output-dir /path/to/directory`,
+	Run: func(cmd *cobra.Command, args []string) {
+		password := p12Password
+		if p12PasswordEnv != "" {
+			if password != "" {
+				cmd.PrintErrln(failure(cmd.ErrOrStderr(), "--password cannot be used with --password-env"))
+				return
+			}
+			password = os.Getenv(p12PasswordEnv)
+		}
+
+		if err := providers.ExportPKCS12(TargetDir, p12Out, password); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to export PKCS#12 bundle:"), err)
+			cmd.SilenceUsage = true
+		}
+	},
+}
+
+func init() {
+	exportJWKSURICmd.Flags().StringVarP(&bucketName, "bucket-name", "b", "", "S3 bucket storing the JWKS")
+	exportJWKSURICmd.Flags().StringVarP(&region, "region", "r", "", "AWS region of the bucket")
+	exportJWKSURICmd.Flags().StringVar(&keyPrefix, "key-prefix", "", "Prefix of the uploaded object keys")
+	exportJWKSURICmd.Flags().StringVar(&issuer, "issuer", "", "URL of an issuer hosted outside of S3, instead of the bucket")
+	exportJWKSURICmd.Flags().StringVar(&jwksURI, "jwks-uri", "", "JWKS URL advertised by the external issuer, printed as is")
+
+	exportP12Cmd.Flags().StringVar(&p12Out, "out", "", "Path of the PKCS#12 file to write (required)")
+	exportP12Cmd.Flags().StringVar(&p12Password, "password", "", "Password protecting the PKCS#12 file")
+	exportP12Cmd.Flags().StringVar(&p12PasswordEnv, "password-env", "", "Environment variable to read the password protecting the PKCS#12 file from")
+	exportP12Cmd.MarkFlagRequired("out")
+
+	exportCmd.AddCommand(exportJWKSURICmd)
+	exportCmd.AddCommand(exportP12Cmd)
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gitlabInstance string
+	gitlabProject  string
+	gitlabRef      string
+	gitlabAudience []string
+)
+
+var gitlabCmd = &cobra.Command{
+	Use:   "gitlab",
+	Short: "Create an IAM OIDC provider and role for GitLab CI",
+	Long: `The gitlab command creates the IAM OIDC provider of a GitLab instance and an IAM role
+assumed by the ID tokens of GitLab CI jobs, without generating any key pair or document:
+GitLab is the issuer.
+
+The issuer is --gitlab-instance, GitLab.com by default, which also is the default audience
+of the ID tokens. The trust policy requires the "sub" claim of the jobs of --gitlab-project,
+restricted to --gitlab-ref when set: a branch name, branch:<name> or tag:<name>. Wildcards
+(* and ?) in the project or ref are matched with StringLike.
+
+Example usage:
+  aws-oidc-sts create gitlab --gitlab-project my-group/my-project --gitlab-ref main --role-name my-role --region us-east-1
+  aws-oidc-sts create gitlab --gitlab-instance https://gitlab.example.com --gitlab-project my-group/* \
+    --gitlab-ref "tag:v*" --role-name my-role --region us-east-1`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validateWebhookFlags(); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Invalid flags:"), err)
+			return
+		}
+
+		if err := validateOutputFormat(outputFormat); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), err.Error()))
+			return
+		}
+		if err := providers.ValidateGitLabInstance(gitlabInstance); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "--gitlab-instance:"), err)
+			return
+		}
+		tags, err := resolveTags()
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), err.Error()))
+			return
+		}
+		if gitlabRef == "" {
+			slog.Warn("No --gitlab-ref set, the role can be assumed by the jobs of any branch or tag of the project.")
+		}
+
+		result, err := providers.CreateGitLabIdentityProvider(&providers.Config{
+			OutputDir:              TargetDir,
+			Region:                 region,
+			WebIdentitySessionName: webIdentitySessionName,
+			Endpoints:              clientOptions(),
+			Thumbprints:            thumbprints,
+			RoleName:               roleName,
+			Tags:                   tags,
+			SourceIPs:              sourceIPs,
+			SourceVPCEs:            sourceVPCEs,
+			Audiences:              gitlabAudience,
+			ReachableTimeout:       reachableTimeout,
+		}, providers.GitLabOptions{
+			Instance: gitlabInstance,
+			Project:  gitlabProject,
+			Ref:      gitlabRef,
+		})
+		if err != nil {
+			notifyWebhook(cmd, nil, err)
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to create GitLab identity provider:"), err)
+			cmd.SilenceUsage = true
+			return
+		}
+
+		if err := notifyWebhook(cmd, result, nil); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to notify webhook:"), err)
+			cmd.SilenceUsage = true
+			return
+		}
+
+		if outputFormat == outputText {
+			slog.Info("GitLab identity provider created successfully.",
+				"Issuer", result.Issuer, "ProviderArn", result.ProviderARN, "RoleArn", result.RoleARN)
+			return
+		}
+		if err := printResult(cmd.OutOrStdout(), outputFormat, result); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to print result:"), err)
+		}
+	},
+}
+
+func init() {
+	gitlabCmd.Flags().StringVar(&gitlabInstance, "gitlab-instance", providers.GitLabInstance, "HTTPS URL of the GitLab instance issuing the ID tokens")
+	gitlabCmd.Flags().StringVar(&gitlabProject, "gitlab-project", "", "Full path of the GitLab project, e.g. my-group/my-project (required)")
+	gitlabCmd.Flags().StringVar(&gitlabRef, "gitlab-ref", "", "Branch name, branch:<name> or tag:<name> the jobs run for (any ref when omitted)")
+	gitlabCmd.Flags().StringSliceVar(&gitlabAudience, "audience", nil, "Audience (aud) of the ID tokens, set with id_tokens in .gitlab-ci.yml (defaults to the instance URL)")
+	gitlabCmd.Flags().StringVar(&roleName, "role-name", "", "Name of the IAM role assumed by the jobs (required)")
+	gitlabCmd.Flags().StringVarP(&region, "region", "r", "", "AWS region (required)")
+	gitlabCmd.Flags().StringSliceVar(&sourceIPs, "source-ip", nil, "IP address or CIDR block the jobs may assume the role from, e.g. of self-hosted runners (repeatable)")
+	gitlabCmd.Flags().StringSliceVar(&sourceVPCEs, "source-vpce", nil, "ID of a VPC endpoint the jobs may assume the role through (repeatable)")
+	gitlabCmd.Flags().StringSliceVar(&thumbprints, "thumbprint", nil, "Thumbprint of the IAM OIDC provider, fetched from the JWKS host when omitted (repeatable)")
+	gitlabCmd.Flags().DurationVar(&reachableTimeout, "reachable-timeout", providers.DefaultReachableTimeout, "Maximum time spent waiting for the discovery document of the instance")
+	gitlabCmd.Flags().StringVar(&outputFormat, "output-format", outputText, "Format of the result printed on success: text (log line), json or yaml")
+	gitlabCmd.MarkFlagRequired("gitlab-project")
+	gitlabCmd.MarkFlagRequired("role-name")
+	gitlabCmd.MarkFlagRequired("region")
+	addWebhookFlags(gitlabCmd)
+	addTagFlags(gitlabCmd)
+}
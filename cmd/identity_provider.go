@@ -1,41 +1,338 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
 	"github.com/spf13/cobra"
 )
 
 var (
-	bucketName string
-	region     string
+	bucketName                   string
+	region                       string
+	allowSourceIdentity          bool
+	sourceIdentityMatchesSubject bool
+	sourceIPs                    []string
+	sourceVPCEs                  []string
+	noCheckpoint                 bool
+	jwtType                      string
+	additionalKeyFiles           []string
+	jwksMaxBytes                 int
+	jwksMaxKeys                  int
+	x5tAlgorithm                 string
+	keyID                        string
+	expectKeyID                  string
+	keyIDHash                    string
+	skipBucket                   bool
+	issuer                       string
+	jwksURI                      string
+	thumbprints                  []string
+	roleName                     string
+	storageClass                 string
+	verifyReachable              bool
+	reachableTimeout             time.Duration
+	providerAudiences            []string
+	jwtAudiences                 []string
+	outputFormat                 string
+	discoveryYAML                bool
+	noDiscovery                  bool
+	keyPrefix                    string
+	lifecycleExpireDays          int
+	lifecyclePrefix              string
+	localOnly                    bool
+	offline                      bool
+	manifestOut                  string
+	objectOwnership              string
+	publicObjects                bool
 )
 
+// keyIDHashUsage is the usage of the --kid-hash flag of the commands computing key IDs.
+const keyIDHashUsage = "Hash algorithm of the key ID (kid) computed from the public key: sha256, or sha1 for legacy relying parties"
+
 var identityProviderCmd = &cobra.Command{
 	Use:   "identity-provider",
 	Short: "Generate a JSON Web Key Set (JWKS) for an identity provider",
-	Long: `The identity-provider command generates a JSON Web Key Set (JWKS) 
-and saves it to the specified target directory. This is useful for setting up 
+	Long: `The identity-provider command generates a JSON Web Key Set (JWKS) and an 
+openid-configuration discovery document, saves them to the specified target directory 
+and uploads them to the S3 bucket hosting the issuer. This is useful for setting up 
 or configuring an identity provider that requires a JWKS for token signing 
 and verification.
 
+The IAM OIDC provider is then created for the issuer, along with an IAM role trusting 
+it when --role-name is set. With --skip-bucket, all S3 work is skipped and IAM is 
+provisioned against an issuer hosted elsewhere, given by --issuer. No key pair is read and
+no JWKS or JWT is generated then: only the discovery document and JWKS served by the issuer
+and the thumbprints of its host are checked.
+
+The bucket is created with the BucketOwnerEnforced object ownership, which disables object
+ACLs. With --public, the documents are uploaded with the public-read ACL, and the bucket is
+created with the BucketOwnerPreferred ownership unless --object-ownership selects
+ObjectWriter; BucketOwnerEnforced is then rejected.
+
+The subject (sub) of the JWT, trusted by the role, defaults to the role name so that
+CloudTrail events and trust conditions name the workload. Set it with --subject, or keep
+the former default with --legacy-subject.
+
+With --manifest-out, the inputs and outputs of the run are recorded in a manifest to be
+committed and re-applied later with the apply command.
+
+With --local, AWS is not called at all: the JWKS, the openid-configuration and a JWT are
+generated for the issuer given by --issuer and the audiences given by --audience, to be
+served by a non-AWS OIDC provider. The JWT is written to token.jwt.
+
+The created bucket, IAM OIDC provider and role are tagged with the tags of --tags-file and
+--tag, which wins over the file on conflicts, besides the ManagedBy tag which is always set.
+
+The AWS steps completed are recorded in .aws-oidc-sts-state.json in the output directory, so
+that running the command again after a failure or an interruption resumes where it stopped
+instead of calling AWS again. Documents are uploaded again when they change. Use
+--no-checkpoint, or delete the file, after deleting resources outside of this tool.
+
+With --jwks-wrapper, a copy of the JWKS with the extra top-level properties of the given JSON
+object is also written to jwks-wrapped.json, e.g. {"version": 1}. The standard JWKS is the
+one uploaded to S3 and served to AWS.
+
+With --source-ip and --source-vpce, the trust policy also requires the request to come from
+one of the IP addresses or CIDR blocks, or through one of the VPC endpoints, on top of the
+audience and subject of the token. When both are set, either network path is allowed, each
+in its own statement, as requests through a VPC endpoint carry no source IP.
+
+With --webhook-url, the result is POSTed as JSON to a webhook after a successful run, and
+the error after a failed run with --webhook-on-failure. With --webhook-secret, the body is
+signed with HMAC-SHA256 in the X-Aws-Oidc-Sts-Signature header. A webhook that cannot be
+notified is only logged, unless --webhook-required is set.
+
+With --signer pkcs11, the key pair is held in a PKCS#11 token such as an HSM and the
+private key is never exposed to the process: the token signs the JWT and the
+certificate, and only its public key is read to build the JWKS.
+
 Example usage:
-  aws-oidc-sts create identity-provider --target-dir /path/to/directory --bucket-name my-s3-bucket`,
+  aws-oidc-sts create identity-provider --target-dir /path/to/directory --bucket-name my-s3-bucket
+  aws-oidc-sts create identity-provider --skip-bucket --issuer https://oidc.example.com --role-name my-role
+  aws-oidc-sts create identity-provider --local --issuer https://auth.internal.example.com --audience my-service`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := providers.CreateIdentityProvider(TargetDir, bucketName, region); err != nil {
-			cmd.PrintErrln("Failed to create identity provider:", err)
+		// The problems of the flags are reported along with those of the configuration
+		inputErrs := []error{validateIdentityProviderFlags()}
+		subject, err := resolveSubject()
+		inputErrs = append(inputErrs, err)
+		tags, err := resolveTags()
+		inputErrs = append(inputErrs, err)
+		jwksWrapper, err := readJWKSWrapper()
+		inputErrs = append(inputErrs, err)
+
+		signer, err := openSigner()
+		if err != nil {
+			identityProviderFailed(cmd, "Failed to open signer:", err)
+			return
+		}
+		if signer != nil {
+			defer signer.Close()
+		}
+
+		cfg := &providers.Config{
+			OutputDir:                    TargetDir,
+			BucketName:                   bucketName,
+			Region:                       region,
+			WebIdentitySessionName:       webIdentitySessionName,
+			Endpoints:                    clientOptions(),
+			KeyPrefix:                    keyPrefix,
+			LifecycleExpireDays:          lifecycleExpireDays,
+			LifecyclePrefix:              lifecyclePrefix,
+			StorageClass:                 storageClass,
+			ObjectOwnership:              objectOwnership,
+			Public:                       publicObjects,
+			SkipBucket:                   skipBucket,
+			IssuerOverride:               issuer,
+			JWKSURIOverride:              jwksURI,
+			Thumbprints:                  thumbprints,
+			Offline:                      offline,
+			RoleName:                     roleName,
+			Tags:                         tags,
+			Audiences:                    providerAudiences,
+			VerifyReachable:              verifyReachable,
+			ReachableTimeout:             reachableTimeout,
+			Strict:                       strict,
+			NoCheckpoint:                 noCheckpoint,
+			NoDiscovery:                  noDiscovery,
+			DiscoveryYAML:                discoveryYAML,
+			AllowSourceIdentity:          allowSourceIdentity,
+			SourceIdentityMatchesSubject: sourceIdentityMatchesSubject,
+			SourceIPs:                    sourceIPs,
+			SourceVPCEs:                  sourceVPCEs,
+			JWKS: providers.JWKSOptions{
+				AdditionalKeyFiles: additionalKeyFiles,
+				MaxBytes:           jwksMaxBytes,
+				MaxKeys:            jwksMaxKeys,
+				X5TAlgorithm:       x5tAlgorithm,
+				KeyID:              keyID,
+				ExpectedKeyID:      expectKeyID,
+				KeyIDHash:          keyIDHash,
+				MinKeySize:         minKeySize,
+				Signer:             signer,
+				Wrapper:            jwksWrapper,
+			},
+			JWT: providers.JWTOptions{
+				Type:            jwtType,
+				Audiences:       jwtAudiences,
+				Subject:         subject,
+				NotBeforeOffset: nbfOffset,
+			},
+		}
+		if err := errors.Join(inputErrs...); err != nil {
+			if !localOnly {
+				err = errors.Join(err, providers.ValidateConfig(cfg))
+			}
+			identityProviderFailed(cmd, "Invalid configuration:", err)
+			return
+		}
+
+		createIdentityProvider := providers.CreateIdentityProvider
+		if localOnly {
+			createIdentityProvider = providers.CreateLocalIdentityProvider
+		}
+		result, err := createIdentityProvider(cfg)
+		if err != nil {
+			identityProviderFailed(cmd, "Failed to create identity provider:", err)
+			return
+		}
+		recordRunMetrics(cmd, nil, result.TokenExpiration)
+
+		if manifestOut != "" {
+			if err := providers.WriteManifest(manifestOut, providers.NewManifest(cfg, result)); err != nil {
+				cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to write manifest:"), err)
+				cmd.SilenceUsage = true
+				return
+			}
+		}
+
+		if err := notifyWebhook(cmd, result, nil); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to notify webhook:"), err)
 			cmd.SilenceUsage = true
-		} else {
-			slog.Info("Identity provider created successfully.")
+			return
+		}
+
+		if outputFormat == outputText {
+			slog.Info("Identity provider created successfully.",
+				"Issuer", result.Issuer, "ProviderArn", result.ProviderARN, "KeyId", result.KeyID, "Subject", result.Subject)
+			return
+		}
+		if err := printResult(cmd.OutOrStdout(), outputFormat, result); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to print result:"), err)
 		}
 
 	},
 }
 
+// identityProviderFailed records the failed run of cmd in the metrics, notifies the webhook
+// of its error and prints it after message.
+func identityProviderFailed(cmd *cobra.Command, message string, err error) {
+	recordRunMetrics(cmd, err, time.Time{})
+	notifyWebhook(cmd, nil, err)
+	cmd.PrintErrln(failure(cmd.ErrOrStderr(), message), err)
+	cmd.SilenceUsage = true
+}
+
+// validateIdentityProviderFlags checks the combination of identity-provider flags, and returns
+// every problem found at once. The values themselves are checked by providers.ValidateConfig.
+func validateIdentityProviderFlags() error {
+	var errs []error
+
+	if err := validateOutputFormat(outputFormat); err != nil {
+		errs = append(errs, err)
+	}
+
+	if noDiscovery && discoveryYAML {
+		errs = append(errs, fmt.Errorf("--discovery-yaml cannot be used with --no-discovery"))
+	}
+
+	if err := validateWebhookFlags(); err != nil {
+		errs = append(errs, err)
+	}
+
+	switch {
+	case localOnly:
+		errs = append(errs, validateLocalIdentityProviderFlags()...)
+	case !skipBucket:
+		if issuer != "" || jwksURI != "" {
+			errs = append(errs, fmt.Errorf("--issuer and --jwks-uri require --skip-bucket"))
+		}
+	default:
+		if keyPrefix != "" {
+			errs = append(errs, fmt.Errorf("--key-prefix cannot be used with --skip-bucket"))
+		}
+		if lifecycleExpireDays != 0 {
+			errs = append(errs, fmt.Errorf("--lifecycle-expire-days cannot be used with --skip-bucket"))
+		}
+		if publicObjects || objectOwnership != "" {
+			errs = append(errs, fmt.Errorf("--public and --object-ownership cannot be used with --skip-bucket"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateLocalIdentityProviderFlags checks the flags of a local identity provider, which
+// requires an issuer and none of the AWS settings.
+func validateLocalIdentityProviderFlags() []error {
+	var errs []error
+	if issuer == "" {
+		errs = append(errs, fmt.Errorf("--issuer is required with --local"))
+	} else if !strings.HasPrefix(issuer, "https://") && !strings.HasPrefix(issuer, "http://") {
+		errs = append(errs, fmt.Errorf("--issuer %q must be an http or https URL", issuer))
+	}
+	if bucketName != "" || skipBucket || roleName != "" || keyPrefix != "" || lifecycleExpireDays != 0 || verifyReachable || publicObjects || objectOwnership != "" || len(tagFlags) > 0 || tagsFile != "" ||
+		len(sourceIPs) > 0 || len(sourceVPCEs) > 0 || noCheckpoint {
+		errs = append(errs, fmt.Errorf("--local cannot be used with --bucket-name, --skip-bucket, --role-name, --key-prefix, --lifecycle-expire-days, --verify-reachable, --public, --object-ownership, --tag, --tags-file, --source-ip, --source-vpce or --no-checkpoint"))
+	}
+	return errs
+}
+
 func init() {
-	identityProviderCmd.Flags().StringVarP(&bucketName, "bucket-name", "b", "", "S3 bucket name to store the JWKS and openid-configuration (required)")
-	identityProviderCmd.Flags().StringVarP(&region, "region", "r", "", "AWS region (required)")
-	identityProviderCmd.MarkFlagRequired("bucket-name")
-	identityProviderCmd.MarkFlagRequired("region")
+	identityProviderCmd.Flags().StringVarP(&bucketName, "bucket-name", "b", "", "S3 bucket name to store the JWKS and openid-configuration (required unless --skip-bucket is set)")
+	identityProviderCmd.Flags().StringVarP(&region, "region", "r", "", "AWS region (required unless --local is set)")
+	identityProviderCmd.Flags().BoolVar(&allowSourceIdentity, "allow-source-identity", false, "Allow sts:SetSourceIdentity in the generated trust policy")
+	identityProviderCmd.Flags().BoolVar(&sourceIdentityMatchesSubject, "source-identity-match-sub", false, "Require the source identity to match the token subject (requires --allow-source-identity)")
+	identityProviderCmd.Flags().StringSliceVar(&sourceIPs, "source-ip", nil, "IP address or CIDR block the role may be assumed from, added as an aws:SourceIp condition of the trust policy (repeatable)")
+	identityProviderCmd.Flags().StringSliceVar(&sourceVPCEs, "source-vpce", nil, "ID of a VPC endpoint the role may be assumed through, added as an aws:SourceVpce condition of the trust policy (repeatable)")
+	identityProviderCmd.Flags().StringVar(&jwtType, "jwt-typ", providers.JWTType, "Value of the \"typ\" header of the generated JWT")
+	identityProviderCmd.Flags().StringSliceVar(&additionalKeyFiles, "additional-private-key", nil, "Path of an additional RSA private key to publish in the JWKS, e.g. during a key size upgrade (repeatable)")
+	identityProviderCmd.Flags().IntVar(&jwksMaxBytes, "jwks-max-bytes", providers.DefaultJWKSMaxBytes, "Size in bytes above which the JWKS is reported (an error with --strict)")
+	identityProviderCmd.Flags().IntVar(&jwksMaxKeys, "jwks-max-keys", providers.DefaultJWKSMaxKeys, "Number of keys above which the JWKS is reported (an error with --strict)")
+	identityProviderCmd.Flags().StringVar(&keyID, "kid", "", "Stable URL-safe label used as the key ID (kid) instead of the hash of the public key, e.g. 2024-q1 (kept when the JWKS is regenerated without it)")
+	identityProviderCmd.Flags().StringVar(&expectKeyID, "expect-kid", "", "Fail unless the key ID computed from the public key of the key pair is this value, to pin the key")
+	identityProviderCmd.Flags().StringVar(&keyIDHash, "kid-hash", providers.KeyIDHashSHA256, keyIDHashUsage)
+	identityProviderCmd.Flags().StringVar(&jwksWrapperFile, "jwks-wrapper", "", jwksWrapperUsage)
+	identityProviderCmd.Flags().StringVar(&x5tAlgorithm, "x5t-alg", providers.X5TAlgorithmSHA256, "Certificate thumbprints published in the JWKS: sha1 (x5t), sha256 (x5t#S256) or both")
+	identityProviderCmd.Flags().StringVar(&keyPrefix, "key-prefix", "", "Prefix of the uploaded object keys, which also becomes the path of the issuer URL (e.g. tenants/a)")
+	identityProviderCmd.Flags().IntVar(&lifecycleExpireDays, "lifecycle-expire-days", 0, "Expire the objects under --lifecycle-prefix after this many days with a bucket lifecycle rule (disabled when 0)")
+	identityProviderCmd.Flags().StringVar(&lifecyclePrefix, "lifecycle-prefix", providers.ArchiveObjectPrefix, "Prefix, under --key-prefix, of the rotation archives expired by --lifecycle-expire-days")
+	identityProviderCmd.Flags().StringVar(&storageClass, "storage-class", string(types.StorageClassStandard), "S3 storage class of the uploaded JWKS and openid-configuration, readable without a restore: STANDARD, STANDARD_IA, ONEZONE_IA, INTELLIGENT_TIERING or GLACIER_IR")
+	identityProviderCmd.Flags().StringVar(&objectOwnership, "object-ownership", "", "Object ownership of the created bucket: BucketOwnerEnforced (default), BucketOwnerPreferred (default with --public) or ObjectWriter")
+	identityProviderCmd.Flags().BoolVar(&publicObjects, "public", false, "Upload the JWKS and openid-configuration with the public-read ACL, allowing public ACLs on the created bucket")
+	identityProviderCmd.Flags().BoolVar(&skipBucket, "skip-bucket", false, "Skip all S3 work and provision IAM against the external issuer given by --issuer")
+	identityProviderCmd.Flags().StringVar(&issuer, "issuer", "", "URL of an issuer hosted outside of S3 (requires --skip-bucket)")
+	identityProviderCmd.Flags().StringVar(&jwksURI, "jwks-uri", "", "JWKS URL advertised by the external issuer (requires --skip-bucket)")
+	identityProviderCmd.Flags().StringSliceVar(&thumbprints, "thumbprint", nil, "Thumbprint of the IAM OIDC provider, fetched from the JWKS host when omitted (repeatable)")
+	identityProviderCmd.Flags().StringSliceVar(&providerAudiences, "audience", []string{providers.JWTAudience}, "Client ID of the IAM OIDC provider accepted as token audience by the role trust policy (repeatable)")
+	identityProviderCmd.Flags().StringSliceVar(&jwtAudiences, "jwt-aud", nil, "Audience (aud) of the generated JWT, one of --audience (repeatable, defaults to all of them)")
+	identityProviderCmd.Flags().BoolVar(&offline, "offline", false, "Skip checking the supplied --thumbprint values against the certificate chain of the JWKS host")
+	identityProviderCmd.Flags().StringVar(&roleName, "role-name", "", "Name of the IAM role trusting the identity provider to create")
+	identityProviderCmd.Flags().BoolVar(&verifyReachable, "verify-reachable", false, "Wait until the uploaded openid-configuration and JWKS are served by the issuer before creating the IAM OIDC provider")
+	identityProviderCmd.Flags().DurationVar(&reachableTimeout, "reachable-timeout", providers.DefaultReachableTimeout, "Maximum time spent waiting for the issuer documents to propagate, retrying on 404, and on 403 with --public, with exponential backoff")
+	identityProviderCmd.Flags().DurationVar(&nbfOffset, "nbf-offset", 0, "Offset of the not before (nbf) claim of the generated JWT from its iat claim, e.g. -30s")
+	identityProviderCmd.Flags().StringVar(&outputFormat, "output-format", outputText, "Format of the result printed on success: text (log line), json or yaml")
+	identityProviderCmd.Flags().BoolVar(&noDiscovery, "no-discovery", false, "Skip generating, uploading and checking the openid-configuration, managed by another system")
+	identityProviderCmd.Flags().BoolVar(&discoveryYAML, "discovery-yaml", false, "Also write the openid-configuration as YAML for review (the uploaded document stays JSON)")
+	addWebhookFlags(identityProviderCmd)
+	addTagFlags(identityProviderCmd)
+	addSubjectFlags(identityProviderCmd)
+	identityProviderCmd.Flags().BoolVar(&noCheckpoint, "no-checkpoint", false, "Run every AWS step again, ignoring and not updating the "+providers.ProvisioningStateFileName+" state file")
+	identityProviderCmd.Flags().StringVar(&manifestOut, "manifest-out", "", "Path of the manifest recording the inputs and outputs of the run, to re-apply with the apply command")
+	identityProviderCmd.Flags().BoolVar(&localOnly, "local", false, "Only generate the JWKS, openid-configuration and JWT for --issuer locally, without calling AWS")
+	addSignerFlags(identityProviderCmd)
 }
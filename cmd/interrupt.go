@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+)
+
+// interruptExitCode is the exit code of a run interrupted by SIGINT (130) or SIGTERM (143),
+// or 0 when the run was not interrupted.
+var interruptExitCode atomic.Int32
+
+// handleInterrupts removes the partially written files on SIGINT or SIGTERM and cancels the
+// returned context, so that the output directory only ever holds complete artifacts and the
+// running command returns normally, running its deferred cleanups such as closing the signer.
+// A second signal exits at once, for commands stuck in a step that cannot be interrupted.
+func handleInterrupts(parent context.Context) context.Context {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		slog.Warn("Interrupted, removing partially written files.", slog.String("signal", sig.String()))
+		providers.RemovePendingTempFiles()
+
+		code := int32(130)
+		if sig == syscall.SIGTERM {
+			code = 143
+		}
+		interruptExitCode.Store(code)
+		cancel()
+
+		sig = <-signals
+		slog.Warn("Interrupted again, exiting without waiting for the command.", slog.String("signal", sig.String()))
+		providers.RemovePendingTempFiles()
+		closeLogging()
+		os.Exit(int(code))
+	}()
+
+	return ctx
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var (
+	publicKeyFile   string
+	jwksAlgorithm   string
+	jwksWrapperFile string
+	publicJWKSOut   string
+)
+
+// jwksWrapperUsage is the usage of the --jwks-wrapper flag, shared by the commands generating the JWKS.
+const jwksWrapperUsage = "Path of a JSON object of top-level properties added around the keys in a copy of the JWKS written to " +
+	providers.JWKSWrappedFileName + ", for non-OIDC consumers (a \"" + providers.JWKSWrapperKeysPlaceholder + "\" value receives the keys too)"
+
+// readJWKSWrapper reads the wrapper template selected by --jwks-wrapper, or returns nil when
+// the flag is not set.
+func readJWKSWrapper() (map[string]any, error) {
+	if jwksWrapperFile == "" {
+		return nil, nil
+	}
+	return providers.ReadJWKSWrapper(jwksWrapperFile)
+}
+
+var jwksCmd = &cobra.Command{
+	Use:   "jwks",
+	Short: "Manage JSON Web Key Sets",
+	Long: `The jwks command groups the operations on JSON Web Key Sets (JWKS) that do not
+require the key pair in the output directory.
+
+Example usage:
+  aws-oidc-sts jwks from-public --public-key-file /path/to/public.pem --out jwks.json --kid 2024-q1`,
+}
+
+var jwksFromPublicCmd = &cobra.Command{
+	Use:   "from-public",
+	Short: "Create a JWKS from a public key only",
+	Long: `The from-public command creates a JWKS holding only the given public key, for
+verifiers publishing the keys of tokens signed elsewhere without holding the private key.
+The JWKS is written to the file given by --out, never to the jwks.json of the output
+directory, which holds the signing key.
+
+The key ID defaults to the hash of the public key, and --alg must match the key type:
+RS256, RS384, RS512, PS256, PS384 or PS512 for RSA keys, the ES algorithm of the curve
+for ECDSA keys and EdDSA for Ed25519 keys.
+
+Example usage:
+  aws-oidc-sts jwks from-public --public-key-file /path/to/public.pem --out /path/to/jwks.json
+  aws-oidc-sts jwks from-public --public-key-file /path/to/public.pem --out jwks.json --kid 2024-q1 --alg RS256`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := providers.CreatePublicJSONWebKeySet(publicJWKSOut, publicKeyFile, keyID, keyIDHash, jwksAlgorithm, minKeySize); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to create JWKS:"), err)
+			cmd.SilenceUsage = true
+		}
+	},
+}
+
+func init() {
+	jwksFromPublicCmd.Flags().StringVar(&publicKeyFile, "public-key-file", "", "Path of the PEM-encoded public key to publish (required)")
+	jwksFromPublicCmd.Flags().StringVar(&keyID, "kid", "", "URL-safe key ID (kid) of the key, instead of the hash of the public key")
+	jwksFromPublicCmd.Flags().StringVar(&keyIDHash, "kid-hash", providers.KeyIDHashSHA256, keyIDHashUsage)
+	jwksFromPublicCmd.Flags().StringVar(&jwksAlgorithm, "alg", "RS256", "Signature algorithm (alg) of the key, matching its type")
+	jwksFromPublicCmd.Flags().StringVar(&publicJWKSOut, "out", "", "Path of the JWKS file to write (required)")
+	jwksFromPublicCmd.MarkFlagRequired("public-key-file")
+	jwksFromPublicCmd.MarkFlagRequired("out")
+
+	jwksCmd.AddCommand(jwksFromPublicCmd)
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var (
+	jwtIssuedAt   int64
+	jwtExpiration int64
+	bundleB64     bool
+	jwtSubject    string
+	nbfOffset     time.Duration
+	jwsFormat     string
+)
+
+var jwtCmd = &cobra.Command{
+	Use:   "jwt",
+	Short: "Sign a JWT with the key pair in the target directory",
+	Long: `The jwt command signs a JWT with the RSA key pair in the target directory and
+prints it. The key ID matches the one published in the JWKS, so the token can be
+exchanged with STS once the identity provider is set up.
+
+The issued at (iat) and expiration (exp) claims are computed from the current time
+unless --iat or --exp is set, which allows replaying a specific token in tests. Without
+--exp, the token expires 24 hours after its iat claim. A token that is already expired or
+expires far in the future is reported but still signed.
+
+The issuer, audience and subject claims can be read from the environment variables named by
+--issuer-from-env, --aud-from-env and --sub-from-env, e.g. when injected by a CI platform.
+The --issuer, --aud and --sub flags take precedence over them.
+
+The expiration of the JWT is logged as a Unix timestamp and in RFC 3339 format, or
+included in the result with --output-format json or yaml, along with the token.
+
+The JWT is printed in the JWS compact serialization expected by OIDC and STS. With
+--jws-format json, it is printed in the general JWS JSON serialization instead, with the
+protected header, payload and signature as separate members.
+
+With --bundle-b64, the issuer, the JWKS of the output directory and the JWT are printed
+as a single base64-encoded JSON object instead, which the unbundle command decodes back
+into files.
+
+Example usage:
+  aws-oidc-sts create jwt --issuer https://my-s3-bucket.s3.us-east-1.amazonaws.com
+  aws-oidc-sts create jwt --issuer https://oidc.example.com --iat 1700000000 --exp 1700003600
+  aws-oidc-sts create jwt --issuer-from-env CI_OIDC_ISSUER --aud-from-env CI_OIDC_AUDIENCE
+  aws-oidc-sts create jwt --issuer https://oidc.example.com --output-format json
+  aws-oidc-sts create jwt --issuer https://oidc.example.com --jws-format json
+  aws-oidc-sts create jwt --issuer https://oidc.example.com --bundle-b64`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validateOutputFormat(outputFormat); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Invalid flags:"), err)
+			return
+		}
+		if bundleB64 && outputFormat != outputText {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Invalid flags:"), "--bundle-b64 cannot be used with --output-format "+outputFormat)
+			return
+		}
+		if jwsFormat != providers.JWSFormatCompact && jwsFormat != providers.JWSFormatJSON {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Invalid flags:"), fmt.Sprintf("--jws-format must be %s or %s", providers.JWSFormatCompact, providers.JWSFormatJSON))
+			return
+		}
+		if bundleB64 && jwsFormat != providers.JWSFormatCompact {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Invalid flags:"), "--bundle-b64 cannot be used with --jws-format "+jwsFormat)
+			return
+		}
+
+		if err := resolveClaimsFromEnv(cmd); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Invalid flags:"), err)
+			return
+		}
+
+		signer, err := openSigner()
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to open signer:"), err)
+			cmd.SilenceUsage = true
+			return
+		}
+		if signer != nil {
+			defer signer.Close()
+		}
+
+		if expectKeyID != "" {
+			if err := providers.VerifyKeyFingerprint(TargetDir, signer, expectKeyID, keyIDHash); err != nil {
+				cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Unexpected key pair:"), err)
+				cmd.SilenceUsage = true
+				return
+			}
+		}
+
+		signingKey, err := providers.SigningKey(TargetDir, keyID, keyIDHash, signer, minKeySize)
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to load signing key:"), err)
+			cmd.SilenceUsage = true
+			return
+		}
+
+		opts := providers.JWTOptions{
+			Issuer:          issuer,
+			Type:            jwtType,
+			Audiences:       jwtAudiences,
+			Subject:         jwtSubject,
+			NotBeforeOffset: nbfOffset,
+			JWSFormat:       jwsFormat,
+		}
+		if signer != nil {
+			opts.Signer = signer
+		}
+		if cmd.Flags().Changed("iat") {
+			opts.IssuedAt = time.Unix(jwtIssuedAt, 0)
+		}
+		if cmd.Flags().Changed("exp") {
+			opts.Expiration = time.Unix(jwtExpiration, 0)
+		}
+
+		token, err := providers.CreateJWT(signingKey, opts)
+		recordRunMetrics(cmd, err, tokenExpiration(token))
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to create JWT:"), err)
+			cmd.SilenceUsage = true
+			return
+		}
+
+		if !bundleB64 {
+			printJWT(cmd, token)
+			return
+		}
+
+		bundleIssuer := issuer
+		if bundleIssuer == "" {
+			bundleIssuer = providers.JWTIssuer
+		}
+		bundle, err := providers.NewBundle(TargetDir, bundleIssuer, token)
+		if err == nil {
+			var encoded string
+			if encoded, err = providers.EncodeBundle(bundle); err == nil {
+				fmt.Fprintln(cmd.OutOrStdout(), encoded)
+			}
+		}
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to create bundle:"), err)
+			cmd.SilenceUsage = true
+		}
+	},
+}
+
+func init() {
+	jwtCmd.Flags().StringVar(&issuer, "issuer", "", "Value of the \"iss\" claim (defaults to "+providers.JWTIssuer+")")
+	jwtCmd.Flags().StringVar(&keyID, "kid", "", "Key ID (kid) the key pair is published with, when set with --kid on identity-provider")
+	jwtCmd.Flags().StringVar(&keyIDHash, "kid-hash", providers.KeyIDHashSHA256, keyIDHashUsage)
+	jwtCmd.Flags().StringVar(&expectKeyID, "expect-kid", "", "Fail unless the key ID computed from the public key of the key pair is this value, to pin the key")
+	jwtCmd.Flags().StringSliceVar(&jwtAudiences, "aud", nil, "Audience (aud) of the JWT (repeatable, defaults to "+providers.JWTAudience+")")
+	jwtCmd.Flags().StringVar(&jwtSubject, "sub", "", "Value of the \"sub\" claim (defaults to "+providers.JWTSubject+")")
+	jwtCmd.Flags().StringVar(&jwtType, "jwt-typ", providers.JWTType, "Value of the \"typ\" header of the JWT")
+	jwtCmd.Flags().Int64Var(&jwtIssuedAt, "iat", 0, "Issued at (iat) claim as a Unix timestamp, instead of the current time")
+	jwtCmd.Flags().Int64Var(&jwtExpiration, "exp", 0, "Expiration (exp) claim as a Unix timestamp, instead of 24 hours after the iat claim")
+	jwtCmd.Flags().StringVar(&outputFormat, "output-format", outputText, "Format of the printed JWT: text (token only, expiration logged), json or yaml")
+	jwtCmd.Flags().DurationVar(&nbfOffset, "nbf-offset", 0, "Offset of the not before (nbf) claim from the iat claim, e.g. -30s to tolerate clock skew")
+	jwtCmd.Flags().StringVar(&jwsFormat, "jws-format", providers.JWSFormatCompact, "Serialization of the printed JWT: compact, as expected by OIDC, or json for the general JWS JSON serialization")
+	jwtCmd.Flags().BoolVar(&bundleB64, "bundle-b64", false, "Print the issuer, the JWKS and the JWT as a single base64-encoded bundle")
+	addClaimsFromEnvFlags(jwtCmd)
+	addSignerFlags(jwtCmd)
+}
+
+// printJWT prints the signed JWT in the selected output format, with its expiration.
+func printJWT(cmd *cobra.Command, token []byte) {
+	result, err := providers.NewJWTResult(token)
+	if err != nil {
+		cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to read JWT expiration:"), err)
+		cmd.SilenceUsage = true
+		return
+	}
+
+	if outputFormat == outputText {
+		fmt.Fprintln(cmd.OutOrStdout(), result.Token)
+		slog.Info("JWT expires at", slog.Int64("exp", result.Expiration), slog.String("expiresAt", result.ExpiresAt))
+		return
+	}
+	if err := printResult(cmd.OutOrStdout(), outputFormat, result); err != nil {
+		cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to print result:"), err)
+	}
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var listProvidersCmd = &cobra.Command{
+	Use:   "list-providers",
+	Short: "List the IAM OIDC identity providers managed by this tool",
+	Long: `The list-providers command enumerates the IAM OpenID Connect identity providers
+of the account and prints the URL, ARN and client IDs of those created by this tool.
+This is useful to audit the OIDC trust defined in an account and to find stale providers.
+
+Example usage:
+  aws-oidc-sts list-providers --region us-east-1`,
+	Run: func(cmd *cobra.Command, args []string) {
+		managed, err := providers.ListIdentityProviders(clientOptions(), concurrency)
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to list identity providers:"), err)
+			cmd.SilenceUsage = true
+			return
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "URL\tARN\tCLIENT IDS")
+		for _, provider := range managed {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", provider.URL, provider.ARN, strings.Join(provider.ClientIDs, ","))
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	listProvidersCmd.Flags().StringVarP(&region, "region", "r", "", "AWS region used to configure the AWS client")
+}
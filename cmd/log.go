@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+var (
+	logFile string
+	logOut  *os.File
+)
+
+// multiHandler is a slog.Handler passing every record to each of its handlers.
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range m {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
+
+// setupLogging tees the logs to --log-file as ND-JSON when it is set, while the console
+// keeps the text output. The file is only readable by the owner, as the logs contain
+// account IDs, ARNs and issuers.
+func setupLogging() error {
+	if logFile == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	// The mode of OpenFile only applies to a created file, tighten an existing one too
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to restrict the permissions of the log file: %w", err)
+	}
+	logOut = f
+
+	slog.SetDefault(slog.New(multiHandler{
+		slog.NewTextHandler(os.Stderr, nil),
+		slog.NewJSONHandler(f, nil),
+	}))
+
+	return nil
+}
+
+// closeLogging closes the file opened by setupLogging.
+func closeLogging() {
+	if logOut != nil {
+		logOut.Close()
+		logOut = nil
+	}
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var (
+	metricsPushgateway string
+	metricsTextfile    string
+)
+
+// recordRunMetrics pushes the metrics of the run of cmd to the Pushgateway and writes them to
+// the textfile selected by the --metrics-* flags, if any. The expiration of the token signed by
+// the run, when not zero, is recorded as the token expiration. Failing to record the metrics is
+// only logged, so that monitoring never fails the run itself.
+func recordRunMetrics(cmd *cobra.Command, runErr error, tokenExpiration time.Time) {
+	if metricsPushgateway == "" && metricsTextfile == "" {
+		return
+	}
+
+	metrics := providers.RunMetrics{
+		Command:         cmd.Name(),
+		Success:         runErr == nil,
+		Time:            time.Now(),
+		TokenExpiration: tokenExpiration,
+	}
+	if created, err := providers.KeyCreationTime(TargetDir); err == nil {
+		metrics.KeyCreated = created
+	}
+
+	if metricsPushgateway != "" {
+		if err := providers.PushMetrics(metricsPushgateway, metrics); err != nil {
+			slog.Warn("Failed to push metrics.", slog.Any("error", err))
+		}
+	}
+	if metricsTextfile != "" {
+		if err := providers.WriteMetricsTextfile(metricsTextfile, metrics); err != nil {
+			slog.Warn("Failed to write metrics.", slog.Any("error", err))
+		}
+	}
+}
+
+// tokenExpiration returns the expiration of the signed token, or the zero time when there is no
+// token or its expiration cannot be read.
+func tokenExpiration(token []byte) time.Time {
+	if token == nil {
+		return time.Time{}
+	}
+	expiration, err := providers.TokenExpiration(token)
+	if err != nil {
+		return time.Time{}
+	}
+	return expiration
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+// validateOutputFormat checks the value of an --output-format flag.
+func validateOutputFormat(format string) error {
+	switch format {
+	case outputText, outputJSON, outputYAML:
+		return nil
+	}
+	return fmt.Errorf("--output-format must be one of %s, %s or %s", outputText, outputJSON, outputYAML)
+}
+
+// printResult writes the result to w as JSON or YAML. The text format is rendered by the
+// caller, as it differs for each command.
+func printResult(w io.Writer, format string, result any) error {
+	var out []byte
+	var err error
+	switch format {
+	case outputJSON:
+		out, err = json.MarshalIndent(result, "", "  ")
+		out = append(out, '\n')
+	case outputYAML:
+		out, err = yaml.Marshal(result)
+	default:
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to render result: %w", err)
+	}
+
+	_, err = w.Write(out)
+	return err
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var (
+	olderThan string
+	dryRun    bool
+)
+
+var pruneJWKSVersionsCmd = &cobra.Command{
+	Use:   "prune-jwks-versions",
+	Short: "Delete superseded JWKS object versions older than a retention window",
+	Long: `The prune-jwks-versions command lists the versions of the JWKS object in a versioned 
+S3 bucket and deletes the superseded ones last modified before the retention window. 
+The current version is always kept. Use --dry-run to preview the deletions first.
+
+Example usage:
+  aws-oidc-sts prune-jwks-versions --bucket-name my-s3-bucket --older-than 30d --dry-run`,
+	Run: func(cmd *cobra.Command, args []string) {
+		retention, err := parseRetention(olderThan)
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Invalid --older-than:"), err)
+			return
+		}
+
+		pruned, err := providers.PruneJWKSVersions(clientOptions(), bucketName, keyPrefix, retention, dryRun)
+		for _, version := range pruned {
+			action := "Deleted"
+			if dryRun {
+				action = "Would delete"
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s version %s (last modified %s)\n",
+				action, version.VersionID, version.LastModified.Format(time.RFC3339))
+		}
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to prune JWKS versions:"), err)
+			cmd.SilenceUsage = true
+		}
+	},
+}
+
+// parseRetention parses a retention window given either as a number of days, e.g. "30d",
+// or as a Go duration, e.g. "720h".
+func parseRetention(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	retention, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if retention < 0 {
+		return 0, fmt.Errorf("retention %q must not be negative", value)
+	}
+
+	return retention, nil
+}
+
+func init() {
+	pruneJWKSVersionsCmd.Flags().StringVarP(&bucketName, "bucket-name", "b", "", "S3 bucket name hosting the JWKS (required)")
+	pruneJWKSVersionsCmd.Flags().StringVarP(&region, "region", "r", "", "AWS region used to configure the AWS client")
+	pruneJWKSVersionsCmd.Flags().StringVar(&keyPrefix, "key-prefix", "", "Prefix of the JWKS object key, as set on identity-provider")
+	pruneJWKSVersionsCmd.Flags().StringVar(&olderThan, "older-than", "30d", "Retention window of superseded versions, in days (e.g. 30d) or as a duration (e.g. 720h)")
+	pruneJWKSVersionsCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the versions that would be deleted without deleting them")
+	pruneJWKSVersionsCmd.MarkFlagRequired("bucket-name")
+}
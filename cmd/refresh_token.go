@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var refreshTokenCmd = &cobra.Command{
+	Use:   "refresh-token",
+	Short: "Sign a fresh JWT for an already provisioned identity provider",
+	Long: `The refresh-token command signs a new JWT with the key pair of an identity provider
+provisioned in the output directory, without touching the keys, the bucket or IAM.
+
+The issuer is read from the local openid-configuration and the audiences and subject from
+the previous token.jwt, unless set with --issuer, --aud and --sub. The token gets a fresh
+iat and exp and the key ID published in the local JWKS, so that it still verifies against
+the published JWKS. It is written to token.jwt and printed.
+
+Example usage:
+  aws-oidc-sts refresh-token --output-dir /path/to/directory
+  aws-oidc-sts refresh-token --issuer https://oidc.example.com --aud sts.amazonaws.com --output-format json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validateOutputFormat(outputFormat); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Invalid flags:"), err)
+			return
+		}
+
+		signer, err := openSigner()
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to open signer:"), err)
+			cmd.SilenceUsage = true
+			return
+		}
+		if signer != nil {
+			defer signer.Close()
+		}
+
+		token, err := providers.RefreshToken(TargetDir, keyID, keyIDHash, signer, minKeySize, providers.JWTOptions{
+			Issuer:          issuer,
+			Type:            jwtType,
+			Audiences:       jwtAudiences,
+			Subject:         jwtSubject,
+			NotBeforeOffset: nbfOffset,
+		})
+		recordRunMetrics(cmd, err, tokenExpiration(token))
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to refresh JWT:"), err)
+			cmd.SilenceUsage = true
+			return
+		}
+
+		printJWT(cmd, token)
+	},
+}
+
+func init() {
+	refreshTokenCmd.Flags().StringVar(&issuer, "issuer", "", "Value of the \"iss\" claim (defaults to the issuer of the local openid-configuration)")
+	refreshTokenCmd.Flags().StringVar(&keyID, "kid", "", "Key ID (kid) the key pair is published with, when set with --kid on identity-provider")
+	refreshTokenCmd.Flags().StringVar(&keyIDHash, "kid-hash", providers.KeyIDHashSHA256, keyIDHashUsage)
+	refreshTokenCmd.Flags().StringSliceVar(&jwtAudiences, "aud", nil, "Audience (aud) of the JWT (repeatable, defaults to the audiences of the previous token)")
+	refreshTokenCmd.Flags().StringVar(&jwtSubject, "sub", "", "Value of the \"sub\" claim (defaults to the subject of the previous token)")
+	refreshTokenCmd.Flags().StringVar(&jwtType, "jwt-typ", providers.JWTType, "Value of the \"typ\" header of the JWT")
+	refreshTokenCmd.Flags().DurationVar(&nbfOffset, "nbf-offset", 0, "Offset of the not before (nbf) claim from the iat claim, e.g. -30s to tolerate clock skew")
+	refreshTokenCmd.Flags().StringVar(&outputFormat, "output-format", outputText, "Format of the printed JWT: text (token only, expiration logged), json or yaml")
+	addSignerFlags(refreshTokenCmd)
+}
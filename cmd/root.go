@@ -1,14 +1,28 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	awsProvider "github.com/chuhaoyuu/aws-oidc-sts/pkg/providers/aws"
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/workerpool"
 	"github.com/spf13/cobra"
 )
 
 var (
-	TargetDir string
+	TargetDir              string
+	concurrency            int
+	webIdentitySessionName string
+	strict                 bool
+	endpointURL            string
+	s3Endpoint             string
+	stsEndpoint            string
+	iamEndpoint            string
+	minKeySize             int
+	credentialsFile        string
+	configFile             string
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -19,17 +33,39 @@ var rootCmd = &cobra.Command{
 of OpenID Connect (OIDC) and Security Token Service (STS) resources in AWS. 
 It provides commands to generate cryptographic assets, configure identity providers, 
 and manage related resources.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return setupLogging()
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx := handleInterrupts(context.Background())
+	err := rootCmd.ExecuteContext(ctx)
+	closeLogging()
+	if code := interruptExitCode.Load(); code != 0 {
+		os.Exit(int(code))
+	}
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// clientOptions returns the AWS SDK options set by the command line flags.
+func clientOptions() awsProvider.ClientOptions {
+	return awsProvider.ClientOptions{
+		Region:                 region,
+		WebIdentitySessionName: webIdentitySessionName,
+		EndpointURL:            endpointURL,
+		S3Endpoint:             s3Endpoint,
+		STSEndpoint:            stsEndpoint,
+		IAMEndpoint:            iamEndpoint,
+		CredentialsFile:        credentialsFile,
+		ConfigFile:             configFile,
+	}
+}
+
 func init() {
 	pwd, err := os.Getwd()
 	if err != nil {
@@ -39,6 +75,33 @@ func init() {
 
 	rootCmd.Root().CompletionOptions.DisableDefaultCmd = false
 	rootCmd.AddCommand(createCmd)
+	rootCmd.AddCommand(listProvidersCmd)
+	rootCmd.AddCommand(trustPolicyCmd)
+	rootCmd.AddCommand(pruneJWKSVersionsCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(unbundleCmd)
+	rootCmd.AddCommand(jwksCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(validateJWKSCmd)
+	rootCmd.AddCommand(verifyIssuersCmd)
+	rootCmd.AddCommand(refreshTokenCmd)
+	rootCmd.AddCommand(testAssumeCmd)
+	rootCmd.AddCommand(rotateCmd)
 	rootCmd.PersistentFlags().StringVarP(&TargetDir, "output-dir", "o", pwd, "Target directory for the generated files")
+	rootCmd.PersistentFlags().IntVar(&concurrency, "concurrency", workerpool.DefaultConcurrency, "Maximum number of simultaneous operations in batch commands")
+	rootCmd.PersistentFlags().StringVar(&webIdentitySessionName, "web-identity-session-name", "", "Role session name used when AWS credentials come from a web identity token file (AWS_WEB_IDENTITY_TOKEN_FILE)")
+	rootCmd.PersistentFlags().BoolVar(&strict, "strict", false, "Turn the warnings of the sanity checks into errors")
+	rootCmd.PersistentFlags().IntVar(&minKeySize, "min-key-size", providers.DefaultMinKeySize, "Smallest RSA key size in bits allowed when generating, importing or publishing a key")
+	rootCmd.PersistentFlags().StringVar(&endpointURL, "endpoint-url", "", "Endpoint URL used for every AWS service, e.g. a LocalStack endpoint")
+	rootCmd.PersistentFlags().StringVar(&s3Endpoint, "s3-endpoint", "", "Endpoint URL of S3, overriding --endpoint-url")
+	rootCmd.PersistentFlags().StringVar(&stsEndpoint, "sts-endpoint", "", "Endpoint URL of STS, overriding --endpoint-url")
+	rootCmd.PersistentFlags().StringVar(&iamEndpoint, "iam-endpoint", "", "Endpoint URL of IAM, overriding --endpoint-url")
+	rootCmd.PersistentFlags().StringVar(&credentialsFile, "credentials-file", "", "Shared AWS credentials file used instead of ~/.aws/credentials")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config-file", "", "Shared AWS config file used instead of ~/.aws/config")
+	rootCmd.PersistentFlags().StringVar(&metricsPushgateway, "metrics-pushgateway", "", "Push the metrics of the run (success, token expiry, key age) to this Prometheus Pushgateway URL")
+	rootCmd.PersistentFlags().StringVar(&metricsTextfile, "metrics-textfile", "", "Write the metrics of the run to this .prom file for the node exporter textfile collector")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Also write the logs as ND-JSON to this file (restricted to mode 0600)")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output (also disabled by the NO_COLOR environment variable or when not writing to a terminal)")
 
 }
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var rotationStage string
+
+var rotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Rotate the signing key in stages without downtime",
+	Long: `The rotate command rotates the key pair in the output directory in three stages, so
+that verifiers have cached the new key by the time tokens are signed with it:
+
+  --stage prepare   generates the next key pair and publishes its public key alongside
+                    the active key
+  --stage activate  signs new tokens with the next key, still publishing the previous
+                    key for the tokens it signed
+  --stage retire    stops publishing the previous key and deletes it
+
+Wait at least the JWKS cache lifetime of the verifiers between prepare and activate, and
+the lifetime of the tokens between activate and retire. The progress is recorded in
+rotation-state.json, and each stage checks the previous one completed. The JWKS is
+regenerated after each stage, and uploaded to the bucket given by --bucket-name.
+
+Example usage:
+  aws-oidc-sts rotate --stage prepare --bucket-name my-s3-bucket --region us-east-1
+  aws-oidc-sts rotate --stage activate --bucket-name my-s3-bucket --region us-east-1
+  aws-oidc-sts rotate --stage retire --output-dir /path/to/directory`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validateOutputFormat(outputFormat); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Invalid flags:"), err)
+			return
+		}
+
+		jwksWrapper, err := readJWKSWrapper()
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), err.Error()))
+			return
+		}
+
+		state, err := providers.RotateKeys(providers.RotateOptions{
+			Config: &providers.Config{
+				OutputDir:              TargetDir,
+				BucketName:             bucketName,
+				Region:                 region,
+				KeyPrefix:              keyPrefix,
+				StorageClass:           storageClass,
+				Public:                 publicObjects,
+				WebIdentitySessionName: webIdentitySessionName,
+				Endpoints:              clientOptions(),
+				JWKS: providers.JWKSOptions{
+					KeyID:        keyID,
+					KeyIDHash:    keyIDHash,
+					MinKeySize:   minKeySize,
+					X5TAlgorithm: x5tAlgorithm,
+					Strict:       strict,
+					Wrapper:      jwksWrapper,
+				},
+			},
+			Stage: rotationStage,
+			Bits:  keySize,
+		})
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to rotate keys:"), err)
+			cmd.SilenceUsage = true
+			return
+		}
+
+		if outputFormat == outputText {
+			slog.Info("Key rotation stage completed.", "Stage", state.Stage, "ActiveKeyId", state.ActiveKeyID,
+				"NextKeyId", state.NextKeyID, "PreviousKeyId", state.PreviousKeyID)
+			return
+		}
+		if err := printResult(cmd.OutOrStdout(), outputFormat, state); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to print result:"), err)
+		}
+	},
+}
+
+func init() {
+	rotateCmd.Flags().StringVar(&rotationStage, "stage", "", "Rotation stage to run: prepare, activate or retire (required)")
+	rotateCmd.Flags().StringVarP(&bucketName, "bucket-name", "b", "", "S3 bucket the regenerated JWKS is uploaded to (the JWKS is only written locally when omitted)")
+	rotateCmd.Flags().StringVarP(&region, "region", "r", "", "AWS region of the bucket")
+	rotateCmd.Flags().StringVar(&keyPrefix, "key-prefix", "", "Prefix of the uploaded object keys")
+	rotateCmd.Flags().StringVar(&storageClass, "storage-class", string(types.StorageClassStandard), "S3 storage class of the uploaded JWKS, readable without a restore: STANDARD, STANDARD_IA, ONEZONE_IA, INTELLIGENT_TIERING or GLACIER_IR")
+	rotateCmd.Flags().BoolVar(&publicObjects, "public", false, "Upload the JWKS with the public-read ACL, when the identity provider was created with --public")
+	rotateCmd.Flags().IntVar(&keySize, "key-size", providers.DefaultRSAKeySize, "Size in bits of the next RSA key generated by the prepare stage")
+	rotateCmd.Flags().StringVar(&keyID, "kid", "", "Key ID (kid) the active key pair is published with, when set with --kid on identity-provider. On activate, a new key ID not published for the previous key")
+	rotateCmd.Flags().StringVar(&keyIDHash, "kid-hash", providers.KeyIDHashSHA256, keyIDHashUsage)
+	rotateCmd.Flags().StringVar(&x5tAlgorithm, "x5t-alg", providers.X5TAlgorithmSHA256, "Certificate thumbprints published in the JWKS: sha1 (x5t), sha256 (x5t#S256) or both")
+	rotateCmd.Flags().StringVar(&jwksWrapperFile, "jwks-wrapper", "", jwksWrapperUsage)
+	rotateCmd.Flags().StringVar(&outputFormat, "output-format", outputText, "Format of the rotation state printed on success: text (log line), json or yaml")
+	rotateCmd.MarkFlagRequired("stage")
+}
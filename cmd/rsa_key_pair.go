@@ -5,6 +5,11 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	keySize   int
+	keyLayout string
+)
+
 var rsaKeyPairCmd = &cobra.Command{
 	Use:   "rsa-key-pair",
 	Short: "Generate an RSA key pair and save it to the target directory",
@@ -12,12 +17,28 @@ var rsaKeyPairCmd = &cobra.Command{
 to the specified target directory. This command is useful for creating secure 
 key pairs for cryptographic operations. 
 
+The key is 4096 bits unless --key-size is set, which cannot be below --min-key-size.
+
+The keys are written to the tls directory unless --key-layout nested is set, which writes
+them to a subdirectory named by their key ID, e.g. tls/<kid>/private-key.pem, and records
+that key ID in tls/active-kid. The other commands detect the layout, and rotate then keeps
+each key pair of a rotation in its own subdirectory, all of them published in the JWKS.
+
 Example usage:
-  aws-oidc-sts create rsa-key-pair --target-dir /path/to/directory`,
+  aws-oidc-sts create rsa-key-pair --target-dir /path/to/directory
+  aws-oidc-sts create rsa-key-pair --key-size 3072 --min-key-size 3072
+  aws-oidc-sts create rsa-key-pair --key-layout nested`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := providers.CreateRSAKeyPair(TargetDir); err != nil {
-			cmd.PrintErrln("Failed to create RSA key pair:", err)
+		opts := providers.RSAKeyPairOptions{Bits: keySize, MinKeySize: minKeySize, Layout: keyLayout, KeyIDHash: keyIDHash}
+		if err := providers.CreateRSAKeyPair(TargetDir, opts); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to create RSA key pair:"), err)
 			cmd.SilenceUsage = true
 		}
 	},
 }
+
+func init() {
+	rsaKeyPairCmd.Flags().IntVar(&keySize, "key-size", providers.DefaultRSAKeySize, "Size of the generated RSA key in bits")
+	rsaKeyPairCmd.Flags().StringVar(&keyLayout, "key-layout", providers.KeyLayoutFlat, "Layout of the key files: flat (tls/private-key.pem) or nested (tls/<kid>/private-key.pem)")
+	rsaKeyPairCmd.Flags().StringVar(&keyIDHash, "kid-hash", providers.KeyIDHashSHA256, keyIDHashUsage)
+}
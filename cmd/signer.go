@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+// pkcs11PINEnv is the environment variable holding the PKCS#11 user PIN, kept off the
+// command line so that it does not leak into the shell history or the process list.
+const pkcs11PINEnv = "AWS_OIDC_STS_PKCS11_PIN"
+
+var (
+	signerType       string
+	pkcs11Library    string
+	pkcs11TokenLabel string
+	pkcs11KeyLabel   string
+)
+
+// addSignerFlags registers the flags selecting the signer of the JWTs on cmd.
+func addSignerFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&signerType, "signer", providers.SignerFile, "Signer of the JWTs: file (private key file in the output directory) or pkcs11 (key held in an HSM)")
+	cmd.Flags().StringVar(&pkcs11Library, "pkcs11-lib", "", "Path of the PKCS#11 module (with --signer pkcs11)")
+	cmd.Flags().StringVar(&pkcs11TokenLabel, "pkcs11-token-label", "", "Label of the PKCS#11 token holding the key (with --signer pkcs11)")
+	cmd.Flags().StringVar(&pkcs11KeyLabel, "pkcs11-key-label", "", "Label of the RSA key pair in the PKCS#11 token (with --signer pkcs11); the PIN is read from "+pkcs11PINEnv)
+}
+
+// openSigner opens the signer selected by the signer flags, nil for the file signer.
+func openSigner() (providers.Signer, error) {
+	return providers.NewSigner(providers.SignerOptions{
+		Type:             signerType,
+		PKCS11Library:    pkcs11Library,
+		PKCS11TokenLabel: pkcs11TokenLabel,
+		PKCS11KeyLabel:   pkcs11KeyLabel,
+		PKCS11PIN:        os.Getenv(pkcs11PINEnv),
+	})
+}
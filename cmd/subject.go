@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var legacySubject bool
+
+// addSubjectFlags registers the flags selecting the "sub" claim of the generated JWT, which
+// defaults to the role name.
+func addSubjectFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&jwtSubject, "subject", "", "Subject (sub) of the generated JWT and of the trust policy (defaults to the role name, or "+providers.JWTSubject+" without role)")
+	cmd.Flags().BoolVar(&legacySubject, "legacy-subject", false, "Use "+providers.JWTSubject+" as subject, as before the subject defaulted to the role name")
+}
+
+// resolveSubject returns the subject selected by the --subject and --legacy-subject flags, or
+// an empty string to derive it from the other inputs.
+func resolveSubject() (string, error) {
+	if legacySubject {
+		if jwtSubject != "" {
+			return "", fmt.Errorf("--legacy-subject cannot be used with --subject")
+		}
+		return providers.JWTSubject, nil
+	}
+	return jwtSubject, nil
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tagFlags []string
+	tagsFile string
+)
+
+// addTagFlags registers the flags of the tags applied to the created AWS resources.
+func addTagFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&tagFlags, "tag", nil, "Tag applied to the created AWS resources, as key=value (repeatable, wins over --tags-file)")
+	cmd.Flags().StringVar(&tagsFile, "tags-file", "", "Path of a JSON object or key=value lines of tags applied to the created AWS resources")
+}
+
+// resolveTags returns the tags of --tags-file merged with the --tag flags, which win on
+// conflicts. The ManagedBy tag is added when the resources are created.
+func resolveTags() (map[string]string, error) {
+	tags := make(map[string]string)
+	if tagsFile != "" {
+		fileTags, err := providers.ReadTagsFile(tagsFile)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range fileTags {
+			tags[key] = value
+		}
+	}
+
+	for _, tag := range tagFlags {
+		key, value, err := providers.ParseTag(tag)
+		if err != nil {
+			return nil, fmt.Errorf("--tag: %w", err)
+		}
+		tags[key] = value
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var tokenFile string
+
+var testAssumeCmd = &cobra.Command{
+	Use:   "test-assume",
+	Short: "Assume the role with a web identity token to prove the setup works",
+	Long: `The test-assume command exchanges a web identity token for credentials of the role
+given by --role-arn with AssumeRoleWithWebIdentity, then prints the assumed-role identity
+reported by GetCallerIdentity with the temporary credentials. It is the definitive proof
+that the issuer, the IAM OIDC provider and the trust policy of the role work together.
+
+The token is read from --token-file, or freshly signed with the key pair in the output
+directory for the issuer of the local openid-configuration (or --issuer), with the role
+name as subject unless --sub is set. No AWS credentials are needed.
+
+When STS rejects the token, the likely cause is printed along with the error, e.g. an
+audience or subject mismatch, a stale thumbprint or an unreachable JWKS.
+
+Example usage:
+  aws-oidc-sts test-assume --role-arn arn:aws:iam::123456789012:role/my-role --region us-east-1
+  aws-oidc-sts test-assume --role-arn arn:aws:iam::123456789012:role/my-role --region us-east-1 --token-file token.jwt`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validateOutputFormat(outputFormat); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Invalid flags:"), err)
+			return
+		}
+
+		var token []byte
+		if tokenFile != "" {
+			var err error
+			if token, err = os.ReadFile(tokenFile); err != nil {
+				cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to read token:"), err)
+				cmd.SilenceUsage = true
+				return
+			}
+		}
+
+		signer, err := openSigner()
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to open signer:"), err)
+			cmd.SilenceUsage = true
+			return
+		}
+		if signer != nil {
+			defer signer.Close()
+		}
+
+		result, err := providers.TestAssumeRole(providers.TestAssumeOptions{
+			Config: &providers.Config{
+				OutputDir:              TargetDir,
+				Region:                 region,
+				IssuerOverride:         issuer,
+				WebIdentitySessionName: webIdentitySessionName,
+				Endpoints:              clientOptions(),
+				JWKS: providers.JWKSOptions{
+					KeyID:      keyID,
+					KeyIDHash:  keyIDHash,
+					MinKeySize: minKeySize,
+					Signer:     signer,
+				},
+				JWT: providers.JWTOptions{
+					Type:      jwtType,
+					Audiences: jwtAudiences,
+					Subject:   jwtSubject,
+				},
+			},
+			RoleARN: roleARN,
+			Token:   token,
+		})
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to assume role:"), err)
+			if hint := providers.AssumeRoleHint(err); hint != "" {
+				cmd.PrintErrln(fmt.Sprintf("Hint: %s", hint))
+			}
+			cmd.SilenceUsage = true
+			return
+		}
+
+		if outputFormat == outputText {
+			slog.Info("Role assumed successfully.",
+				"AssumedRoleArn", result.AssumedRoleARN, "Account", result.Account, "Expiration", result.Expiration)
+			return
+		}
+		if err := printResult(cmd.OutOrStdout(), outputFormat, result); err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to print result:"), err)
+		}
+	},
+}
+
+func init() {
+	testAssumeCmd.Flags().StringVar(&roleARN, "role-arn", "", "ARN of the role to assume (required)")
+	testAssumeCmd.Flags().StringVarP(&region, "region", "r", "", "AWS region of the STS endpoint")
+	testAssumeCmd.Flags().StringVar(&tokenFile, "token-file", "", "Path of the web identity token to exchange, instead of signing a fresh one")
+	testAssumeCmd.Flags().StringVar(&issuer, "issuer", "", "Value of the \"iss\" claim of the signed token (defaults to the issuer of the local openid-configuration)")
+	testAssumeCmd.Flags().StringSliceVar(&jwtAudiences, "aud", nil, "Audience (aud) of the signed token (repeatable, defaults to "+providers.JWTAudience+")")
+	testAssumeCmd.Flags().StringVar(&jwtSubject, "sub", "", "Value of the \"sub\" claim of the signed token (defaults to the role name)")
+	testAssumeCmd.Flags().StringVar(&jwtType, "jwt-typ", providers.JWTType, "Value of the \"typ\" header of the signed token")
+	testAssumeCmd.Flags().StringVar(&keyID, "kid", "", "Key ID (kid) the key pair is published with, when set with --kid on identity-provider")
+	testAssumeCmd.Flags().StringVar(&keyIDHash, "kid-hash", providers.KeyIDHashSHA256, keyIDHashUsage)
+	testAssumeCmd.Flags().StringVar(&outputFormat, "output-format", outputText, "Format of the result printed on success: text (log line), json or yaml")
+	addSignerFlags(testAssumeCmd)
+	testAssumeCmd.MarkFlagRequired("role-arn")
+}
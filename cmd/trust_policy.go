@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	awsProvider "github.com/chuhaoyuu/aws-oidc-sts/pkg/providers/aws"
+	"github.com/spf13/cobra"
+)
+
+var (
+	providerARN string
+	audiences   []string
+	subject     string
+
+	printConditionKeys bool
+)
+
+var trustPolicyCmd = &cobra.Command{
+	Use:   "trust-policy",
+	Short: "Print the trust policy of a role assumed with an OIDC identity provider",
+	Long: `The trust-policy command renders the trust policy document of an IAM role assumed 
+with web identity tokens issued by an OIDC identity provider and prints it to stdout. 
+No AWS call is made, so the policy can be pasted into infrastructure as code without 
+granting this tool any AWS permission.
+
+With --print-condition-keys, the IAM condition keys matched against the "aud" and "sub"
+claims of the issuer's tokens are printed instead, with the supplied values, to review
+the issuer to condition key derivation when a trust policy never matches.
+
+Example usage:
+  aws-oidc-sts trust-policy --provider-arn arn:aws:iam::123456789012:oidc-provider/oidc.example.com \
+    --issuer https://oidc.example.com --audience sts.amazonaws.com --subject my-service
+  aws-oidc-sts trust-policy --provider-arn arn:aws:iam::123456789012:oidc-provider/oidc.example.com \
+    --issuer https://oidc.example.com --audience sts.amazonaws.com --audience my-client-id
+  aws-oidc-sts trust-policy --issuer https://oidc.example.com/tenants/a --subject my-service --print-condition-keys`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if printConditionKeys {
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "%s = %s\n", awsProvider.AudienceConditionKey(issuer), strings.Join(audiences, ", "))
+			fmt.Fprintf(out, "%s = %s\n", awsProvider.SubjectConditionKey(issuer), subject)
+			return
+		}
+
+		if providerARN == "" {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "--provider-arn is required unless --print-condition-keys is set"))
+			return
+		}
+		if sourceIdentityMatchesSubject && !allowSourceIdentity {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "--source-identity-match-sub requires --allow-source-identity"))
+			return
+		}
+
+		policyJSON, err := awsProvider.RenderTrustPolicy(awsProvider.TrustPolicyInput{
+			ProviderARN:                  providerARN,
+			Issuer:                       issuer,
+			Audiences:                    audiences,
+			Subject:                      subject,
+			AllowSourceIdentity:          allowSourceIdentity,
+			SourceIdentityMatchesSubject: sourceIdentityMatchesSubject,
+		})
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to render trust policy:"), err)
+			cmd.SilenceUsage = true
+			return
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), string(policyJSON))
+	},
+}
+
+func init() {
+	trustPolicyCmd.Flags().StringVar(&providerARN, "provider-arn", "", "ARN of the IAM OIDC provider trusted by the role (required unless --print-condition-keys is set)")
+	trustPolicyCmd.Flags().StringVar(&issuer, "issuer", "", "Issuer URL of the OIDC provider (required)")
+	trustPolicyCmd.Flags().StringSliceVar(&audiences, "audience", []string{providers.JWTAudience}, "Accepted audience (aud) of the web identity token (repeatable)")
+	trustPolicyCmd.Flags().StringVar(&subject, "subject", "", "Expected subject (sub) of the web identity token")
+	trustPolicyCmd.Flags().BoolVar(&allowSourceIdentity, "allow-source-identity", false, "Allow sts:SetSourceIdentity in the trust policy")
+	trustPolicyCmd.Flags().BoolVar(&sourceIdentityMatchesSubject, "source-identity-match-sub", false, "Require the source identity to match the token subject (requires --allow-source-identity)")
+	trustPolicyCmd.Flags().BoolVar(&printConditionKeys, "print-condition-keys", false, "Print the IAM condition keys of the aud and sub claims for the issuer instead of the policy")
+	trustPolicyCmd.MarkFlagRequired("issuer")
+}
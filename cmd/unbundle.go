@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"io"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var unbundleCmd = &cobra.Command{
+	Use:   "unbundle [BUNDLE]",
+	Short: "Decode a base64 bundle into the issuer, JWKS and JWT files",
+	Long: `The unbundle command decodes a bundle printed by "create jwt --bundle-b64" and writes 
+its issuer, JWKS and JWT to the output directory, as issuer, jwks.json and token.jwt. The 
+bundle is read from the argument, or from stdin when omitted.
+
+Example usage:
+  aws-oidc-sts unbundle "$OIDC_BUNDLE" --output-dir /path/to/directory
+  echo "$OIDC_BUNDLE" | aws-oidc-sts unbundle`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var encoded string
+		if len(args) == 1 {
+			encoded = args[0]
+		} else {
+			input, err := io.ReadAll(cmd.InOrStdin())
+			if err != nil {
+				cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to read bundle:"), err)
+				cmd.SilenceUsage = true
+				return
+			}
+			encoded = string(input)
+		}
+
+		bundle, err := providers.DecodeBundle(encoded)
+		if err == nil {
+			err = providers.WriteBundle(TargetDir, bundle)
+		}
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to unbundle:"), err)
+			cmd.SilenceUsage = true
+		}
+	},
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var (
+	jwksFile          string
+	allowedAlgorithms []string
+)
+
+var validateJWKSCmd = &cobra.Command{
+	Use:   "validate-jwks",
+	Short: "Validate a JWKS file before publishing it",
+	Long: `The validate-jwks command checks a hand-edited or externally produced JWKS before it is
+published: the file must parse, every key must have a kid and the parameters required by its
+kty, kids must be unique and at least one key must be a signing key. With --allowed-algs,
+every key must also have one of the given algorithms.
+
+All the issues found are reported, and the command exits with a non-zero status if there is any.
+
+Example usage:
+  aws-oidc-sts validate-jwks --file jwks.json
+  aws-oidc-sts validate-jwks --file jwks.json --allowed-algs RS256,RS512`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		issues := providers.ValidateJWKSFile(jwksFile, allowedAlgorithms)
+
+		out := cmd.OutOrStdout()
+		if len(issues) > 0 {
+			for _, issue := range issues {
+				fmt.Fprintf(out, "[%s] %v\n", statusLabel(out, false), issue)
+			}
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), fmt.Sprintf("%d issues found in %s", len(issues), jwksFile)))
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			return fmt.Errorf("invalid JWKS %s", jwksFile)
+		}
+
+		fmt.Fprintln(out, success(out, fmt.Sprintf("%s is a valid JWKS", jwksFile)))
+		return nil
+	},
+}
+
+func init() {
+	validateJWKSCmd.Flags().StringVar(&jwksFile, "file", "", "Path of the JWKS to validate (required)")
+	validateJWKSCmd.Flags().StringSliceVar(&allowedAlgorithms, "allowed-algs", nil, "Comma-separated list of the algorithms (alg) allowed for the keys")
+	validateJWKSCmd.MarkFlagRequired("file")
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var issuersFile string
+
+var verifyIssuersCmd = &cobra.Command{
+	Use:   "verify-issuers",
+	Short: "Verify the health of several OIDC issuers at once",
+	Long: `The verify-issuers command verifies every issuer listed in --issuers-file, one URL per
+line: its discovery document must be served and valid, and the JWKS it advertises must be
+served, valid and publish at least one key.
+
+The issuers are verified concurrently, at most --concurrency at a time, and a pass/fail
+line is printed for each of them. The command exits with a non-zero status if any failed.
+
+Example usage:
+  aws-oidc-sts verify-issuers --issuers-file issuers.txt
+  aws-oidc-sts verify-issuers --issuers-file issuers.txt --concurrency 16`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		issuers, err := providers.ReadIssuersFile(issuersFile)
+		if err != nil {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), "Failed to read issuers:"), err)
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			return err
+		}
+
+		statuses := providers.VerifyIssuers(issuers, concurrency)
+
+		out := cmd.OutOrStdout()
+		failed := 0
+		for _, status := range statuses {
+			fmt.Fprintf(out, "[%s] %s\n", statusLabel(out, status.OK()), status.Issuer)
+			if !status.OK() {
+				failed++
+				fmt.Fprintf(out, "       %v\n", status.Err)
+				continue
+			}
+			fmt.Fprintf(out, "       %d keys at %s\n", status.Keys, status.JWKSURI)
+		}
+
+		if failed > 0 {
+			cmd.PrintErrln(failure(cmd.ErrOrStderr(), fmt.Sprintf("%d of %d issuers failed", failed, len(statuses))))
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			return fmt.Errorf("%d issuers failed", failed)
+		}
+		fmt.Fprintln(out, success(out, fmt.Sprintf("All %d issuers passed", len(statuses))))
+		return nil
+	},
+}
+
+func init() {
+	verifyIssuersCmd.Flags().StringVar(&issuersFile, "issuers-file", "", "Path of the file listing the issuer URLs to verify, one per line (required)")
+	verifyIssuersCmd.MarkFlagRequired("issuers-file")
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/providers"
+	"github.com/spf13/cobra"
+)
+
+var (
+	webhookURL       string
+	webhookSecret    string
+	webhookSecretEnv string
+	webhookOnFailure bool
+	webhookRequired  bool
+)
+
+// addWebhookFlags registers the flags of the webhook notified after a provisioning run.
+func addWebhookFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&webhookURL, "webhook-url", "", "POST the result of a successful run as JSON to this URL")
+	cmd.Flags().StringVar(&webhookSecret, "webhook-secret", "", "Sign the webhook body with HMAC-SHA256 using this secret, in the "+providers.WebhookSignatureHeader+" header")
+	cmd.Flags().StringVar(&webhookSecretEnv, "webhook-secret-env", "", "Environment variable to read the webhook secret from")
+	cmd.Flags().BoolVar(&webhookOnFailure, "webhook-on-failure", false, "Also notify the webhook when the run fails, with the error")
+	cmd.Flags().BoolVar(&webhookRequired, "webhook-required", false, "Fail a successful run when the webhook cannot be notified, instead of only logging it")
+}
+
+// validateWebhookFlags checks the combination of the webhook flags, and that the variable
+// named by --webhook-secret-env holds a secret.
+func validateWebhookFlags() error {
+	if webhookSecret != "" && webhookSecretEnv != "" {
+		return fmt.Errorf("--webhook-secret cannot be used with --webhook-secret-env")
+	}
+	if webhookURL == "" && (webhookSecret != "" || webhookSecretEnv != "" || webhookOnFailure || webhookRequired) {
+		return fmt.Errorf("the --webhook-* flags require --webhook-url")
+	}
+	if _, err := webhookSigningSecret(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// webhookSigningSecret returns the secret signing the webhook body, read from the variable
+// named by --webhook-secret-env when set, which must then hold a non-empty secret rather
+// than silently sending unsigned bodies.
+func webhookSigningSecret() (string, error) {
+	if webhookSecretEnv == "" {
+		return webhookSecret, nil
+	}
+	secret := os.Getenv(webhookSecretEnv)
+	if secret == "" {
+		return "", fmt.Errorf("--webhook-secret-env: environment variable %s is not set or empty", webhookSecretEnv)
+	}
+	return secret, nil
+}
+
+// notifyWebhook sends the result of the run of cmd, or its error with --webhook-on-failure,
+// to the webhook selected by --webhook-url, if any. Nothing is sent when the secret of
+// --webhook-secret-env is missing. Failing to notify the webhook is only logged, unless
+// --webhook-required is set and the run succeeded, in which case the error is returned to
+// fail the run.
+func notifyWebhook(cmd *cobra.Command, result *providers.IdentityProviderResult, runErr error) error {
+	if webhookURL == "" || (runErr != nil && !webhookOnFailure) {
+		return nil
+	}
+
+	payload := providers.WebhookPayload{
+		Command: cmd.Name(),
+		Success: runErr == nil,
+		Time:    time.Now().UTC(),
+		Result:  result,
+	}
+	if runErr != nil {
+		payload.Error = runErr.Error()
+	}
+
+	secret, err := webhookSigningSecret()
+	if err == nil {
+		err = providers.SendWebhook(webhookURL, secret, payload)
+	}
+	if err == nil {
+		slog.Info("Webhook notified.", slog.Bool("success", payload.Success))
+		return nil
+	}
+	if webhookRequired && runErr == nil {
+		return err
+	}
+	slog.Warn("Failed to notify webhook.", slog.Any("error", err))
+	return nil
+}
@@ -0,0 +1,188 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrInterrupted is returned by the writes started after RemovePendingTempFiles was called.
+var ErrInterrupted = errors.New("interrupted")
+
+// pendingTempFiles tracks the temporary files not yet renamed into place, so that they can be
+// removed on interrupt. Its lock is held while renaming, so that an interrupt never leaves a
+// group of files half renamed.
+var pendingTempFiles = struct {
+	sync.Mutex
+	names       map[string]bool
+	interrupted bool
+}{names: make(map[string]bool)}
+
+// atomicFile is a file written by writeFilesAtomic.
+type atomicFile struct {
+	name string
+	data []byte
+	perm os.FileMode
+}
+
+// writeFileAtomic writes data to the named file like os.WriteFile, through a temporary file in
+// the same directory renamed into place, so that the file is either complete or left untouched.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	return writeFilesAtomic(atomicFile{name: name, data: data, perm: perm})
+}
+
+// writeFilesAtomic writes a group of files that are only valid together, e.g. the private and
+// public keys of a key pair. Every file is first written to a temporary file in its directory,
+// then all of them are renamed into place. If a rename fails, the files already renamed are
+// rolled back: those that existed before are restored with their previous content and the
+// others are removed, so that either the whole group or none of it ends up on disk.
+func writeFilesAtomic(files ...atomicFile) error {
+	tempNames := make([]string, 0, len(files))
+	defer func() {
+		pendingTempFiles.Lock()
+		defer pendingTempFiles.Unlock()
+		for _, tempName := range tempNames {
+			if pendingTempFiles.names[tempName] {
+				delete(pendingTempFiles.names, tempName)
+				os.Remove(tempName)
+			}
+		}
+	}()
+
+	for _, file := range files {
+		tempName, err := createTempFile(file)
+		if tempName != "" {
+			tempNames = append(tempNames, tempName)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Keep the previous content of the files replaced by the group, to roll them back
+	var previous []*atomicFile
+	if len(files) > 1 {
+		for _, file := range files {
+			previousFile, err := readPreviousFile(file.name)
+			if err != nil {
+				return err
+			}
+			previous = append(previous, previousFile)
+		}
+	}
+
+	pendingTempFiles.Lock()
+	defer pendingTempFiles.Unlock()
+	if pendingTempFiles.interrupted {
+		return ErrInterrupted
+	}
+	for i, file := range files {
+		if err := os.Rename(tempNames[i], file.name); err != nil {
+			rollbackFiles(files[:i], previous)
+			return fmt.Errorf("failed to rename %s: %w", file.name, err)
+		}
+		delete(pendingTempFiles.names, tempNames[i])
+	}
+
+	return nil
+}
+
+// readPreviousFile returns the content and permissions of the named file, or nil when it does
+// not exist.
+func readPreviousFile(name string) (*atomicFile, error) {
+	info, err := os.Stat(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", name, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return &atomicFile{name: name, data: data, perm: info.Mode().Perm()}, nil
+}
+
+// rollbackFiles restores the renamed files to their previous content, or removes those that did
+// not exist before. It is called with the lock of pendingTempFiles held.
+func rollbackFiles(renamed []atomicFile, previous []*atomicFile) {
+	for i, file := range renamed {
+		if previous[i] == nil {
+			os.Remove(file.name)
+			continue
+		}
+
+		f, err := os.CreateTemp(filepath.Dir(file.name), "."+filepath.Base(file.name)+".*.tmp")
+		if err != nil {
+			continue
+		}
+		_, err = f.Write(previous[i].data)
+		if err == nil {
+			err = f.Chmod(previous[i].perm)
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), file.name)
+		}
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}
+}
+
+// createTempFile writes the content of file to a new temporary file next to it, tracked in
+// pendingTempFiles, and returns its name.
+func createTempFile(file atomicFile) (string, error) {
+	pendingTempFiles.Lock()
+	if pendingTempFiles.interrupted {
+		pendingTempFiles.Unlock()
+		return "", ErrInterrupted
+	}
+	f, err := os.CreateTemp(filepath.Dir(file.name), "."+filepath.Base(file.name)+".*.tmp")
+	if err == nil {
+		pendingTempFiles.names[f.Name()] = true
+	}
+	pendingTempFiles.Unlock()
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file for %s: %w", file.name, err)
+	}
+
+	_, err = f.Write(file.data)
+	if err == nil {
+		err = f.Chmod(file.perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return f.Name(), fmt.Errorf("failed to write %s: %w", file.name, err)
+	}
+
+	return f.Name(), nil
+}
+
+// RemovePendingTempFiles removes the temporary files not yet renamed into place and makes the
+// writes started afterwards fail with ErrInterrupted. It is meant to be called on interrupt,
+// before exiting, and waits for any rename in progress to complete.
+func RemovePendingTempFiles() {
+	pendingTempFiles.Lock()
+	defer pendingTempFiles.Unlock()
+
+	pendingTempFiles.interrupted = true
+	for tempName := range pendingTempFiles.names {
+		os.Remove(tempName)
+		delete(pendingTempFiles.names, tempName)
+	}
+}
@@ -0,0 +1,81 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFilesAtomicRollsBackOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	existingFile := filepath.Join(dir, "private-key.pem")
+	newFile := filepath.Join(dir, "certificate.pem")
+	failingFile := filepath.Join(dir, "public-key.pem")
+	if err := os.WriteFile(existingFile, []byte("old private key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Renaming the last file fails, as a non-empty directory is in the way
+	if err := os.MkdirAll(filepath.Join(failingFile, "blocker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	err := writeFilesAtomic(
+		atomicFile{name: existingFile, data: []byte("new private key"), perm: 0600},
+		atomicFile{name: newFile, data: []byte("new certificate"), perm: 0644},
+		atomicFile{name: failingFile, data: []byte("new public key"), perm: 0644},
+	)
+	if err == nil {
+		t.Fatal("writeFilesAtomic succeeded despite the failing rename")
+	}
+
+	data, err := os.ReadFile(existingFile)
+	if err != nil {
+		t.Fatalf("the existing file was removed: %v", err)
+	}
+	if string(data) != "old private key" {
+		t.Errorf("existing file = %q, want its previous content", data)
+	}
+	if info, err := os.Stat(existingFile); err == nil && info.Mode().Perm() != 0600 {
+		t.Errorf("existing file mode = %v, want its previous mode 0600", info.Mode().Perm())
+	}
+	if _, err := os.Stat(newFile); !os.IsNotExist(err) {
+		t.Errorf("the new file was left behind: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if name := entry.Name(); name != filepath.Base(existingFile) && name != filepath.Base(failingFile) {
+			t.Errorf("unexpected file %s left behind", name)
+		}
+	}
+}
+
+func TestWriteFilesAtomicReplacesGroup(t *testing.T) {
+	dir := t.TempDir()
+	privateKeyFile := filepath.Join(dir, "private-key.pem")
+	publicKeyFile := filepath.Join(dir, "public-key.pem")
+	if err := os.WriteFile(privateKeyFile, []byte("old private key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := writeFilesAtomic(
+		atomicFile{name: privateKeyFile, data: []byte("new private key"), perm: 0600},
+		atomicFile{name: publicKeyFile, data: []byte("new public key"), perm: 0644},
+	)
+	if err != nil {
+		t.Fatalf("writeFilesAtomic: %v", err)
+	}
+
+	for name, want := range map[string]string{privateKeyFile: "new private key", publicKeyFile: "new public key"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), data, want)
+		}
+	}
+}
@@ -4,17 +4,21 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"os"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
 // TODO:
 // 1. Create s3 bucket (Done in S3Service.Create())
-// 2. Upload JWKSFileName to S3 bucket
-// 3. Upload openid-configuration to S3 bucket
-// 4. Create IAM role with trust policy to allow sts:AssumeRole with OIDC provider
+// 2. Upload JWKSFileName to S3 bucket (Done in S3Service.Upload())
+// 3. Upload openid-configuration to S3 bucket (Done in S3Service.Upload())
+// 4. Create IAM role with trust policy to allow sts:AssumeRole with OIDC provider (Done in RoleService.Create())
 // 5. Create IAM policy to allow sts:AssumeRole with OIDC provider
 
 // AwsService defines an interface for interacting with AWS services.
@@ -24,53 +28,157 @@ type AwsService interface {
 	Create() error
 }
 
+// ClientOptions holds the settings used to configure the AWS SDK.
+type ClientOptions struct {
+	// Region is the AWS region. When empty, the region is resolved from the environment
+	// and the shared configuration files.
+	Region string
+	// WebIdentitySessionName is the role session name used when the credentials are
+	// obtained from a web identity token file. When empty, the SDK generates one.
+	WebIdentitySessionName string
+	// EndpointURL overrides the endpoint of every AWS service.
+	EndpointURL string
+	// S3Endpoint, STSEndpoint and IAMEndpoint override the endpoint of a single service.
+	// They take precedence over EndpointURL, which takes precedence over the SDK default.
+	S3Endpoint  string
+	STSEndpoint string
+	IAMEndpoint string
+	// CredentialsFile and ConfigFile replace the default shared credentials and config files
+	// (~/.aws/credentials and ~/.aws/config) without changing AWS_SHARED_CREDENTIALS_FILE or
+	// AWS_CONFIG_FILE for other processes.
+	CredentialsFile string
+	ConfigFile      string
+}
+
 // AwsClient initializes and returns an AWS SDK configuration object.
-// It loads the default configuration with the specified AWS region and
+// It loads the default configuration with the specified AWS options and
 // retrieves the AWS client identity for logging purposes.
 //
 // The function logs the AWS client identity details, including the account,
-// ARN, region, and user ID.
+// ARN, region, user ID and the source of the credentials.
 //
 // Returns:
 //   - aws.Config: The AWS SDK configuration object.
 //   - error: An error if the configuration loading or identity retrieval fails.
-func AwsClient(region string) (aws.Config, error) {
+func AwsClient(opts ClientOptions) (aws.Config, error) {
 	ctx := context.TODO()
-	cfg, err := config.LoadDefaultConfig(ctx,
-		config.WithRegion(region),
-	)
+	cfg, err := newClient(ctx, opts)
 	if err != nil {
 		return aws.Config{}, fmt.Errorf("unable to load SDK config: %w", err)
 	}
 
-	identity, err := clientIdentity(cfg)
+	identity, err := clientIdentity(cfg, opts)
 	if err != nil {
 		return aws.Config{}, fmt.Errorf("failed to get AWS client identity: %w", err)
 	}
 
+	credentials, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+
 	slog.Info("AWS Client Identity",
 		"Account", aws.ToString(identity.Account),
 		"Arn", aws.ToString(identity.Arn),
 		"Region", cfg.Region,
 		"UserId", aws.ToString(identity.UserId),
+		"CredentialSource", credentials.Source,
 	)
 
 	return cfg, nil
 }
 
+// LoadConfig loads the AWS SDK configuration for the given options like AwsClient, without
+// retrieving the caller identity, for operations that do not need credentials, such as
+// AssumeRoleWithWebIdentity.
+func LoadConfig(opts ClientOptions) (aws.Config, error) {
+	cfg, err := newClient(context.TODO(), opts)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("unable to load SDK config: %w", err)
+	}
+	return cfg, nil
+}
+
+// newClient loads the AWS SDK configuration for the given options.
+//
+// Only the explicitly set options are layered on top of config.LoadDefaultConfig and no
+// credentials provider is ever set, so the default credential chain is always used:
+// environment variables, shared configuration files, web identity token files
+// (AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN, as set up by EKS IRSA or federated CI),
+// and container or instance roles. This lets the tool itself run without long-term
+// credentials in an OIDC-federated environment.
+//
+// The credentials are cached and refreshed by the SDK, and requests failing with an expired
+// token are retried with refreshed credentials.
+//
+// Explicit shared credentials and config files must exist: the SDK silently ignores missing
+// shared files, which would fall back to other credentials without notice.
+func newClient(ctx context.Context, opts ClientOptions) (aws.Config, error) {
+	loadOptions := []func(*config.LoadOptions) error{
+		config.WithRegion(opts.Region),
+	}
+
+	if opts.CredentialsFile != "" {
+		if err := checkSharedFile(opts.CredentialsFile); err != nil {
+			return aws.Config{}, err
+		}
+		loadOptions = append(loadOptions, config.WithSharedCredentialsFiles([]string{opts.CredentialsFile}))
+	}
+
+	if opts.ConfigFile != "" {
+		if err := checkSharedFile(opts.ConfigFile); err != nil {
+			return aws.Config{}, err
+		}
+		loadOptions = append(loadOptions, config.WithSharedConfigFiles([]string{opts.ConfigFile}))
+	}
+
+	if opts.EndpointURL != "" {
+		loadOptions = append(loadOptions, config.WithBaseEndpoint(opts.EndpointURL))
+	}
+
+	if opts.WebIdentitySessionName != "" {
+		loadOptions = append(loadOptions, config.WithWebIdentityRoleCredentialOptions(
+			func(o *stscreds.WebIdentityRoleOptions) {
+				o.RoleSessionName = opts.WebIdentitySessionName
+			},
+		))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	return withExpiredTokenRetry(cfg), nil
+}
+
+// checkSharedFile checks that the shared credentials or config file exists and is a regular file.
+func checkSharedFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read shared AWS file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("shared AWS file %s is not a regular file", path)
+	}
+
+	return nil
+}
+
 // clientIdentity retrieves the AWS caller identity using the provided AWS configuration.
 // It utilizes the AWS SDK's STS (Security Token Service) client to fetch the caller identity.
 //
 // Parameters:
 //   - cfg: An aws.Config object containing the AWS configuration.
+//   - opts: The options holding the STS endpoint override.
 //
 // Returns:
 //   - *sts.GetCallerIdentityOutput: The output containing the caller identity details.
 //   - error: An error if the operation fails, otherwise nil.
-func clientIdentity(cfg aws.Config) (*sts.GetCallerIdentityOutput, error) {
+func clientIdentity(cfg aws.Config, opts ClientOptions) (*sts.GetCallerIdentityOutput, error) {
 
 	// Use the AWS SDK to get the identity
-	client := sts.NewFromConfig(cfg)
+	client := NewSTSClient(cfg, opts)
 	identity, err := client.GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
 	if err != nil {
 		return &sts.GetCallerIdentityOutput{}, fmt.Errorf("failed to get caller identity: %w", err)
@@ -80,6 +188,43 @@ func clientIdentity(cfg aws.Config) (*sts.GetCallerIdentityOutput, error) {
 
 }
 
+// AccountID returns the AWS account ID of the caller identity for the given configuration.
+func AccountID(cfg aws.Config, opts ClientOptions) (string, error) {
+	identity, err := clientIdentity(cfg, opts)
+	if err != nil {
+		return "", err
+	}
+
+	return aws.ToString(identity.Account), nil
+}
+
+// NewS3Client returns an S3 client for cfg, using the S3 endpoint override of opts when set.
+func NewS3Client(cfg aws.Config, opts ClientOptions) *s3.Client {
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if opts.S3Endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.S3Endpoint)
+		}
+	})
+}
+
+// NewSTSClient returns an STS client for cfg, using the STS endpoint override of opts when set.
+func NewSTSClient(cfg aws.Config, opts ClientOptions) *sts.Client {
+	return sts.NewFromConfig(cfg, func(o *sts.Options) {
+		if opts.STSEndpoint != "" {
+			o.BaseEndpoint = aws.String(opts.STSEndpoint)
+		}
+	})
+}
+
+// NewIAMClient returns an IAM client for cfg, using the IAM endpoint override of opts when set.
+func NewIAMClient(cfg aws.Config, opts ClientOptions) *iam.Client {
+	return iam.NewFromConfig(cfg, func(o *iam.Options) {
+		if opts.IAMEndpoint != "" {
+			o.BaseEndpoint = aws.String(opts.IAMEndpoint)
+		}
+	})
+}
+
 // Create initializes and creates an AWS resource using the provided AwsService.
 // It returns an error if the service is nil or if the creation process fails.
 //
@@ -0,0 +1,83 @@
+package aws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+)
+
+func TestLoadConfigUsesWebIdentityFromEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("web-identity-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{
+		"AWS_ACCESS_KEY_ID":           "",
+		"AWS_SECRET_ACCESS_KEY":       "",
+		"AWS_SESSION_TOKEN":           "",
+		"AWS_PROFILE":                 "",
+		"AWS_SHARED_CREDENTIALS_FILE": filepath.Join(dir, "credentials"),
+		"AWS_CONFIG_FILE":             filepath.Join(dir, "config"),
+		"AWS_WEB_IDENTITY_TOKEN_FILE": tokenFile,
+		"AWS_ROLE_ARN":                "arn:aws:iam::123456789012:role/ci",
+	} {
+		t.Setenv(name, value)
+	}
+
+	var form map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %v", err)
+		}
+		form = map[string]string{}
+		for key := range r.PostForm {
+			form[key] = r.PostForm.Get(key)
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">` +
+			`<AssumeRoleWithWebIdentityResult><Credentials><AccessKeyId>ASIAWEBIDENTITY</AccessKeyId>` +
+			`<SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>` +
+			`<Expiration>2100-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleWithWebIdentityResult>` +
+			`</AssumeRoleWithWebIdentityResponse>`))
+	}))
+	defer server.Close()
+
+	cfg, err := LoadConfig(ClientOptions{Region: "us-east-1", EndpointURL: server.URL, WebIdentitySessionName: "ci-session"})
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	cache, ok := cfg.Credentials.(*aws.CredentialsCache)
+	if !ok {
+		t.Fatalf("credentials = %T, want *aws.CredentialsCache", cfg.Credentials)
+	}
+	if !cache.IsCredentialsProvider(&stscreds.WebIdentityRoleProvider{}) {
+		t.Fatal("the credentials are not provided by the web identity provider")
+	}
+
+	credentials, err := cfg.Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("Retrieve: %v", err)
+	}
+	if credentials.AccessKeyID != "ASIAWEBIDENTITY" || credentials.Source != stscreds.WebIdentityProviderName {
+		t.Errorf("credentials = %s from %q, want the web identity credentials", credentials.AccessKeyID, credentials.Source)
+	}
+	want := map[string]string{
+		"Action":           "AssumeRoleWithWebIdentity",
+		"RoleArn":          "arn:aws:iam::123456789012:role/ci",
+		"RoleSessionName":  "ci-session",
+		"WebIdentityToken": "web-identity-token",
+	}
+	for key, value := range want {
+		if form[key] != value {
+			t.Errorf("%s = %q, want %q", key, form[key], value)
+		}
+	}
+}
@@ -9,15 +9,34 @@ package aws
 //   - serviceType: An implementation of the AwsService interface representing the desired AWS service.
 //
 // Returns:
-//   - An initialized instance of the specific AWS service (e.g., *S3Service, *AWSCloudFront) if the
+//   - An initialized instance of the specific AWS service (e.g., *S3Service, *RoleService) if the
 //     type matches, or nil if the service type is not recognized.
 func Builder(serviceType AwsService) AwsService {
 	switch service := serviceType.(type) {
 	case *S3Service:
 		return &S3Service{
-			Client:     service.Client,
-			BucketName: service.BucketName,
-			Region:     service.Region,
+			Client:          service.Client,
+			BucketName:      service.BucketName,
+			Region:          service.Region,
+			StorageClass:    service.StorageClass,
+			ObjectOwnership: service.ObjectOwnership,
+			PublicRead:      service.PublicRead,
+			Tags:            service.Tags,
+		}
+	case *OIDCProviderService:
+		return &OIDCProviderService{
+			Client:      service.Client,
+			URL:         service.URL,
+			ClientIDs:   service.ClientIDs,
+			Thumbprints: service.Thumbprints,
+			Tags:        service.Tags,
+		}
+	case *RoleService:
+		return &RoleService{
+			Client:      service.Client,
+			RoleName:    service.RoleName,
+			TrustPolicy: service.TrustPolicy,
+			Tags:        service.Tags,
 		}
 	// case *AWSCloudFront:
 	// 	return &AWSCloudFront{
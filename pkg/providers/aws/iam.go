@@ -0,0 +1,208 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/workerpool"
+)
+
+const (
+	// ManagedByTagKey is the tag key marking resources created by this tool.
+	ManagedByTagKey = "ManagedBy"
+	// ManagedByTagValue is the value of the ManagedByTagKey tag.
+	ManagedByTagValue = "aws-oidc-sts"
+)
+
+// IAMService represents a service for interacting with AWS IAM.
+type IAMService struct {
+	Client *iam.Client
+	// Concurrency bounds the number of simultaneous requests of batch operations.
+	Concurrency int
+}
+
+// OIDCProvider describes an IAM OpenID Connect identity provider.
+type OIDCProvider struct {
+	ARN         string
+	URL         string
+	ClientIDs   []string
+	Thumbprints []string
+	Tags        map[string]string
+}
+
+// ManagedBy reports whether the provider carries the tag marking it as created by this tool.
+func (p OIDCProvider) ManagedBy() bool {
+	return p.Tags[ManagedByTagKey] == ManagedByTagValue
+}
+
+// ListOIDCProviders enumerates the IAM OIDC identity providers of the account and
+// fetches the details of each of them, running at most Concurrency requests at a time.
+//
+// Returns:
+//   - []OIDCProvider: The identity providers defined in the account.
+//   - error: An error if listing the providers or fetching their details fails.
+func (s *IAMService) ListOIDCProviders(ctx context.Context) ([]OIDCProvider, error) {
+	list, err := s.Client.ListOpenIDConnectProviders(ctx, &iam.ListOpenIDConnectProvidersInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list OIDC providers: %w", err)
+	}
+
+	entries := list.OpenIDConnectProviderList
+	providers := make([]OIDCProvider, len(entries))
+	if err := workerpool.Run(s.Concurrency, len(entries), func(i int) error {
+		provider, err := s.GetOIDCProvider(ctx, aws.ToString(entries[i].Arn))
+		if err != nil {
+			return err
+		}
+		providers[i] = provider
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return providers, nil
+}
+
+// GetOIDCProvider fetches the details of the IAM OIDC identity provider with the given ARN.
+func (s *IAMService) GetOIDCProvider(ctx context.Context, arn string) (OIDCProvider, error) {
+	out, err := s.Client.GetOpenIDConnectProvider(ctx, &iam.GetOpenIDConnectProviderInput{
+		OpenIDConnectProviderArn: aws.String(arn),
+	})
+	if err != nil {
+		return OIDCProvider{}, fmt.Errorf("failed to get OIDC provider %s: %w", arn, err)
+	}
+
+	tags := make(map[string]string, len(out.Tags))
+	for _, tag := range out.Tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	return OIDCProvider{
+		ARN:         arn,
+		URL:         "https://" + aws.ToString(out.Url),
+		ClientIDs:   out.ClientIDList,
+		Thumbprints: out.ThumbprintList,
+		Tags:        tags,
+	}, nil
+}
+
+// GetRoleTrustPolicy returns the trust policy document of the IAM role with the given name,
+// decoded from the URL encoding used by IAM.
+func (s *IAMService) GetRoleTrustPolicy(ctx context.Context, roleName string) (string, error) {
+	out, err := s.Client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return "", fmt.Errorf("failed to get role %s: %w", roleName, err)
+	}
+
+	document, err := url.QueryUnescape(aws.ToString(out.Role.AssumeRolePolicyDocument))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode trust policy of role %s: %w", roleName, err)
+	}
+
+	return document, nil
+}
+
+// OIDCProviderService represents an IAM OpenID Connect identity provider to create.
+type OIDCProviderService struct {
+	Client      *iam.Client
+	URL         string
+	ClientIDs   []string
+	Thumbprints []string
+	// Tags are the tags of the created provider, besides the ManagedByTagKey tag.
+	Tags map[string]string
+}
+
+// Create creates the IAM OIDC identity provider for the service's issuer URL.
+// The provider is tagged with the service's tags and as managed by this tool. An already existing provider for the
+// same URL is left unchanged and is not treated as an error.
+//
+// Returns:
+//   - nil if the provider is created successfully or already exists.
+//   - an error if the provider creation fails, including the URL and the underlying error.
+func (s *OIDCProviderService) Create() error {
+	slog.Info("Creating IAM OIDC provider", "URL", s.URL)
+	_, err := s.Client.CreateOpenIDConnectProvider(context.TODO(), &iam.CreateOpenIDConnectProviderInput{
+		Url:            aws.String(s.URL),
+		ClientIDList:   s.ClientIDs,
+		ThumbprintList: s.Thumbprints,
+		Tags:           iamTags(s.Tags),
+	})
+	var alreadyExists *types.EntityAlreadyExistsException
+	if errors.As(err, &alreadyExists) {
+		slog.Warn("IAM OIDC provider already exists, skipping creation.", "URL", s.URL)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create OIDC provider %s: %w", s.URL, err)
+	}
+
+	slog.Info("IAM OIDC provider created successfully", "URL", s.URL)
+
+	return nil
+}
+
+// RoleService represents an IAM role assumed with web identity tokens.
+type RoleService struct {
+	Client      *iam.Client
+	RoleName    string
+	TrustPolicy string
+	// Tags are the tags of the created role, besides the ManagedByTagKey tag.
+	Tags map[string]string
+}
+
+// Create creates the IAM role with the service's trust policy and tags it with the service's
+// tags and as managed by this tool. When the role already exists, its trust policy is updated
+// instead, and its tags are left unchanged.
+//
+// Returns:
+//   - nil if the role is created or updated successfully.
+//   - an error if the role creation or update fails, including the role name and the underlying error.
+func (s *RoleService) Create() error {
+	slog.Info("Creating IAM role", "RoleName", s.RoleName)
+	_, err := s.Client.CreateRole(context.TODO(), &iam.CreateRoleInput{
+		RoleName:                 aws.String(s.RoleName),
+		AssumeRolePolicyDocument: aws.String(s.TrustPolicy),
+		Description:              aws.String("Role assumed with web identity tokens from an OIDC provider managed by aws-oidc-sts"),
+		Tags:                     iamTags(s.Tags),
+	})
+	var alreadyExists *types.EntityAlreadyExistsException
+	if errors.As(err, &alreadyExists) {
+		slog.Warn("IAM role already exists, updating its trust policy.", "RoleName", s.RoleName)
+		if _, err := s.Client.UpdateAssumeRolePolicy(context.TODO(), &iam.UpdateAssumeRolePolicyInput{
+			RoleName:       aws.String(s.RoleName),
+			PolicyDocument: aws.String(s.TrustPolicy),
+		}); err != nil {
+			return fmt.Errorf("failed to update trust policy of role %s: %w", s.RoleName, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create role %s: %w", s.RoleName, err)
+	}
+
+	slog.Info("IAM role created successfully", "RoleName", s.RoleName)
+
+	return nil
+}
+
+// RoleARN returns the ARN of the IAM role with the given name in the given account.
+func RoleARN(accountID, roleName string) string {
+	return fmt.Sprintf("arn:aws:iam::%s:role/%s", accountID, roleName)
+}
+
+// RoleNameFromARN returns the name of the IAM role with the given ARN, without its path.
+func RoleNameFromARN(roleARN string) (string, error) {
+	_, resource, ok := strings.Cut(roleARN, ":role/")
+	if !ok || !strings.HasPrefix(roleARN, "arn:") {
+		return "", fmt.Errorf("invalid role ARN %q", roleARN)
+	}
+
+	return resource[strings.LastIndex(resource, "/")+1:], nil
+}
@@ -0,0 +1,96 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// noSuchLifecycleConfigurationErrorCode is the S3 error code returned when the bucket has no
+// lifecycle configuration yet.
+const noSuchLifecycleConfigurationErrorCode = "NoSuchLifecycleConfiguration"
+
+// lifecycleRuleIDPrefix prefixes the ID of the lifecycle rules managed by PutLifecycleRule.
+const lifecycleRuleIDPrefix = "aws-oidc-sts-expire-"
+
+// PutLifecycleRule makes S3 expire the objects stored under prefix expireDays days after their
+// creation, e.g. the archives written during key rotations.
+//
+// The rule is identified by its prefix and merged into the existing lifecycle configuration
+// of the bucket, whose other rules are kept. Nothing is changed when the same rule already
+// exists, and a rule with the same prefix but a different expiration is replaced.
+//
+// Returns:
+//   - nil if the rule is in place.
+//   - an error if the prefix is empty, expireDays is not positive, or reading or updating
+//     the lifecycle configuration of the bucket fails.
+func (s *S3Service) PutLifecycleRule(prefix string, expireDays int) error {
+	if prefix == "" {
+		return fmt.Errorf("a lifecycle rule prefix is required, an empty prefix would expire the whole bucket")
+	}
+	if expireDays <= 0 {
+		return fmt.Errorf("lifecycle expiration must be a positive number of days, got %d", expireDays)
+	}
+
+	rules, err := s.lifecycleRules()
+	if err != nil {
+		return err
+	}
+
+	ruleID := lifecycleRuleIDPrefix + prefix
+	rule := types.LifecycleRule{
+		ID:         aws.String(ruleID),
+		Status:     types.ExpirationStatusEnabled,
+		Filter:     &types.LifecycleRuleFilter{Prefix: aws.String(prefix)},
+		Expiration: &types.LifecycleExpiration{Days: aws.Int32(int32(expireDays))},
+	}
+
+	updated := make([]types.LifecycleRule, 0, len(rules)+1)
+	for _, existing := range rules {
+		if aws.ToString(existing.ID) != ruleID {
+			updated = append(updated, existing)
+			continue
+		}
+		if existing.Status == types.ExpirationStatusEnabled && existing.Expiration != nil &&
+			aws.ToInt32(existing.Expiration.Days) == int32(expireDays) &&
+			existing.Filter != nil && aws.ToString(existing.Filter.Prefix) == prefix {
+			slog.Info("Lifecycle rule already exists", "BucketName", s.BucketName, "Prefix", prefix, "ExpireDays", expireDays)
+			return nil
+		}
+	}
+	updated = append(updated, rule)
+
+	slog.Info("Putting lifecycle rule", "BucketName", s.BucketName, "Prefix", prefix, "ExpireDays", expireDays)
+	_, err = s.Client.PutBucketLifecycleConfiguration(context.TODO(), &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(s.BucketName),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: updated},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put lifecycle configuration of bucket %s: %w", s.BucketName, err)
+	}
+
+	return nil
+}
+
+// lifecycleRules returns the lifecycle rules of the bucket, or none if it has no lifecycle
+// configuration.
+func (s *S3Service) lifecycleRules() ([]types.LifecycleRule, error) {
+	output, err := s.Client.GetBucketLifecycleConfiguration(context.TODO(), &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(s.BucketName),
+	})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == noSuchLifecycleConfigurationErrorCode {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lifecycle configuration of bucket %s: %w", s.BucketName, err)
+	}
+
+	return output.Rules, nil
+}
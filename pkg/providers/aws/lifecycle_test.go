@@ -0,0 +1,63 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestPutLifecycleRuleIdempotent(t *testing.T) {
+	client := &fakeS3{}
+	service := &S3Service{Client: client, BucketName: "my-bucket", Region: "eu-west-1"}
+
+	for range 2 {
+		if err := service.PutLifecycleRule("archive/", 30); err != nil {
+			t.Fatalf("PutLifecycleRule: %v", err)
+		}
+	}
+
+	if len(client.lifecycleRules) != 1 {
+		t.Fatalf("got %d lifecycle rules, want 1", len(client.lifecycleRules))
+	}
+	rule := client.lifecycleRules[0]
+	if aws.ToString(rule.ID) != lifecycleRuleIDPrefix+"archive/" || aws.ToString(rule.Filter.Prefix) != "archive/" ||
+		aws.ToInt32(rule.Expiration.Days) != 30 || rule.Status != types.ExpirationStatusEnabled {
+		t.Errorf("rule = %+v, want the archive/ rule expiring after 30 days", rule)
+	}
+	if client.lifecyclePuts != 1 {
+		t.Errorf("PutBucketLifecycleConfiguration calls = %d, want 1", client.lifecyclePuts)
+	}
+}
+
+func TestPutLifecycleRuleMergesExistingRules(t *testing.T) {
+	other := types.LifecycleRule{
+		ID:         aws.String("logs"),
+		Status:     types.ExpirationStatusEnabled,
+		Filter:     &types.LifecycleRuleFilter{Prefix: aws.String("logs/")},
+		Expiration: &types.LifecycleExpiration{Days: aws.Int32(7)},
+	}
+	client := &fakeS3{lifecycleRules: []types.LifecycleRule{other}}
+	service := &S3Service{Client: client, BucketName: "my-bucket", Region: "eu-west-1"}
+
+	if err := service.PutLifecycleRule("archive/", 30); err != nil {
+		t.Fatalf("PutLifecycleRule: %v", err)
+	}
+	// A different expiration replaces the rule of the prefix
+	if err := service.PutLifecycleRule("archive/", 60); err != nil {
+		t.Fatalf("PutLifecycleRule: %v", err)
+	}
+
+	if len(client.lifecycleRules) != 2 {
+		t.Fatalf("got %d lifecycle rules, want the existing rule and the archive/ rule", len(client.lifecycleRules))
+	}
+	if aws.ToString(client.lifecycleRules[0].ID) != "logs" {
+		t.Errorf("existing rule = %+v, want it kept", client.lifecycleRules[0])
+	}
+	if days := aws.ToInt32(client.lifecycleRules[1].Expiration.Days); days != 60 {
+		t.Errorf("archive/ rule expires after %d days, want 60", days)
+	}
+	if client.lifecyclePuts != 2 {
+		t.Errorf("PutBucketLifecycleConfiguration calls = %d, want 2", client.lifecyclePuts)
+	}
+}
@@ -0,0 +1,136 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// expiredTokenErrorCodes are the AWS error codes returned when the request was signed with
+// temporary credentials that have expired.
+var expiredTokenErrorCodes = map[string]bool{
+	"ExpiredToken":          true,
+	"ExpiredTokenException": true,
+}
+
+// isExpiredTokenError reports whether err is an AWS error caused by expired credentials.
+func isExpiredTokenError(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && expiredTokenErrorCodes[apiErr.ErrorCode()]
+}
+
+// operationAbortedErrorCode is the S3 error code returned when a conflicting operation is in
+// progress on the same bucket, e.g. two runs creating the same new bucket concurrently.
+const operationAbortedErrorCode = "OperationAborted"
+
+// isOperationAbortedError reports whether err is an S3 error caused by a concurrent conflicting
+// operation, which is transient and resolves once the competing operation completes.
+func isOperationAbortedError(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == operationAbortedErrorCode
+}
+
+// expiredTokenRetryStateMiddlewareID is the ID of the middleware tracking the expired token
+// retry of an operation.
+const expiredTokenRetryStateMiddlewareID = "ExpiredTokenRetryState"
+
+// expiredTokenRetryStateKey is the stack value key of the expiredTokenRetryState of an operation.
+type expiredTokenRetryStateKey struct{}
+
+// expiredTokenRetryState records whether the credentials were already refreshed for an
+// operation, which is then not retried again on an expired token.
+type expiredTokenRetryState struct {
+	refreshed bool
+}
+
+// expiredTokenRetryer wraps the retryer of a configuration to refresh the cached credentials
+// and retry once the operations failing with an expired token. Other errors are left to the
+// wrapped retryer.
+type expiredTokenRetryer struct {
+	aws.Retryer
+	cache *aws.CredentialsCache
+}
+
+// IsErrorRetryable reports expired token errors as retryable, and defers to the wrapped
+// retryer for other errors.
+func (r *expiredTokenRetryer) IsErrorRetryable(err error) bool {
+	return isExpiredTokenError(err) || r.Retryer.IsErrorRetryable(err)
+}
+
+// GetRetryToken invalidates the credentials cache before the retry of an expired token error,
+// so that the next attempt is signed with freshly retrieved credentials instead of the expired
+// cached ones. An operation whose credentials were already refreshed is not retried again, and
+// other errors take a retry token of the wrapped retryer.
+func (r *expiredTokenRetryer) GetRetryToken(ctx context.Context, opErr error) (func(error) error, error) {
+	if !isExpiredTokenError(opErr) {
+		return r.Retryer.GetRetryToken(ctx, opErr)
+	}
+
+	state, ok := middleware.GetStackValue(ctx, expiredTokenRetryStateKey{}).(*expiredTokenRetryState)
+	if !ok || state.refreshed {
+		return nil, opErr
+	}
+	state.refreshed = true
+
+	slog.Warn("AWS credentials expired, refreshing them and retrying the request.")
+	r.cache.Invalidate()
+
+	return func(error) error { return nil }, nil
+}
+
+// GetAttemptToken implements aws.RetryerV2 with the wrapped retryer, which may only implement
+// the deprecated GetInitialToken.
+func (r *expiredTokenRetryer) GetAttemptToken(ctx context.Context) (func(error) error, error) {
+	if retryer, ok := r.Retryer.(aws.RetryerV2); ok {
+		return retryer.GetAttemptToken(ctx)
+	}
+	return r.Retryer.GetInitialToken(), nil
+}
+
+// RetryDelay retries expired token errors without delay, as the refreshed credentials are
+// usable at once, and defers to the wrapped retryer for other errors.
+func (r *expiredTokenRetryer) RetryDelay(attempt int, opErr error) (time.Duration, error) {
+	if isExpiredTokenError(opErr) {
+		return 0, nil
+	}
+	return r.Retryer.RetryDelay(attempt, opErr)
+}
+
+// addExpiredTokenRetryState adds the middleware giving each operation its own
+// expiredTokenRetryState, ahead of the retry middleware of the SDK.
+func addExpiredTokenRetryState(stack *middleware.Stack) error {
+	return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc(expiredTokenRetryStateMiddlewareID,
+		func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			ctx = middleware.WithStackValue(ctx, expiredTokenRetryStateKey{}, &expiredTokenRetryState{})
+			return next.HandleFinalize(ctx, in)
+		}), "Retry", middleware.Before)
+}
+
+// withExpiredTokenRetry configures cfg to refresh the cached credentials and retry once the
+// requests failing with an expired token, wrapping the retryer already configured, or the
+// standard retryer by default. Credentials loaded by the SDK are already cached and refreshed
+// ahead of their expiry, but credentials can still expire mid-operation in long-running flows,
+// e.g. when the clock of the host is skewed or the credentials are revoked early.
+func withExpiredTokenRetry(cfg aws.Config) aws.Config {
+	cache, ok := cfg.Credentials.(*aws.CredentialsCache)
+	if !ok {
+		return cfg
+	}
+
+	newRetryer := cfg.Retryer
+	if newRetryer == nil {
+		newRetryer = func() aws.Retryer { return retry.NewStandard() }
+	}
+	cfg.Retryer = func() aws.Retryer {
+		return &expiredTokenRetryer{Retryer: newRetryer(), cache: cache}
+	}
+	cfg.APIOptions = append(cfg.APIOptions, addExpiredTokenRetryState)
+
+	return cfg
+}
@@ -0,0 +1,121 @@
+package aws
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// countingProvider returns static credentials and counts how many times they are retrieved,
+// i.e. how many times the credentials cache wrapping it was invalidated, plus one.
+type countingProvider struct {
+	retrievals atomic.Int32
+}
+
+func (p *countingProvider) Retrieve(context.Context) (aws.Credentials, error) {
+	p.retrievals.Add(1)
+	return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret", Source: "test"}, nil
+}
+
+// scriptedHTTPClient answers the STS requests with an ExpiredToken error for the first
+// expiredResponses requests, then with a GetCallerIdentity result.
+type scriptedHTTPClient struct {
+	expiredResponses int32
+	requests         atomic.Int32
+}
+
+func (c *scriptedHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if c.requests.Add(1) <= c.expiredResponses {
+		return xmlResponse(http.StatusBadRequest, `<ErrorResponse><Error><Type>Sender</Type><Code>ExpiredToken</Code>`+
+			`<Message>The security token included in the request is expired</Message></Error></ErrorResponse>`), nil
+	}
+	return xmlResponse(http.StatusOK, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">`+
+		`<GetCallerIdentityResult><Account>123456789012</Account><Arn>arn:aws:iam::123456789012:user/test</Arn>`+
+		`<UserId>AIDA</UserId></GetCallerIdentityResult></GetCallerIdentityResponse>`), nil
+}
+
+func xmlResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"text/xml"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func newExpiredTokenTestClient(expiredResponses int32) (*sts.Client, *countingProvider, *scriptedHTTPClient) {
+	provider := &countingProvider{}
+	httpClient := &scriptedHTTPClient{expiredResponses: expiredResponses}
+	cfg := withExpiredTokenRetry(aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.NewCredentialsCache(provider),
+		HTTPClient:  httpClient,
+	})
+	return sts.NewFromConfig(cfg), provider, httpClient
+}
+
+func TestExpiredTokenRefreshedAndRetriedOnce(t *testing.T) {
+	client, provider, httpClient := newExpiredTokenTestClient(1)
+
+	identity, err := client.GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		t.Fatalf("GetCallerIdentity: %v", err)
+	}
+	if got := aws.ToString(identity.Account); got != "123456789012" {
+		t.Errorf("account = %q, want 123456789012", got)
+	}
+	if got := httpClient.requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+	// The credentials are retrieved once for the first attempt and once after the single
+	// invalidation of the cache.
+	if got := provider.retrievals.Load(); got != 2 {
+		t.Errorf("credential retrievals = %d, want 2 (one cache invalidation)", got)
+	}
+}
+
+func TestExpiredTokenNotRetriedTwice(t *testing.T) {
+	client, provider, httpClient := newExpiredTokenTestClient(10)
+
+	_, err := client.GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+	if !isExpiredTokenError(err) {
+		t.Fatalf("err = %v, want an ExpiredToken error", err)
+	}
+	if got := httpClient.requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2 (a single retry)", got)
+	}
+	if got := provider.retrievals.Load(); got != 2 {
+		t.Errorf("credential retrievals = %d, want 2 (one cache invalidation)", got)
+	}
+
+	// The next operation gets its own refresh and retry.
+	httpClient.requests.Store(0)
+	httpClient.expiredResponses = 1
+	if _, err := client.GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{}); err != nil {
+		t.Fatalf("GetCallerIdentity: %v", err)
+	}
+	if got := provider.retrievals.Load(); got != 3 {
+		t.Errorf("credential retrievals = %d, want 3", got)
+	}
+}
+
+func TestExpiredTokenRetryWrapsConfiguredRetryer(t *testing.T) {
+	configured := aws.NopRetryer{}
+	cfg := withExpiredTokenRetry(aws.Config{
+		Credentials: aws.NewCredentialsCache(&countingProvider{}),
+		Retryer:     func() aws.Retryer { return configured },
+	})
+
+	retryer, ok := cfg.Retryer().(*expiredTokenRetryer)
+	if !ok {
+		t.Fatalf("retryer = %T, want *expiredTokenRetryer", cfg.Retryer())
+	}
+	if retryer.Retryer != configured {
+		t.Errorf("wrapped retryer = %T, want the configured retryer", retryer.Retryer)
+	}
+}
@@ -1,21 +1,56 @@
 package aws
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+// bucketCreateAttempts and bucketCreateBackoff bound the retries of a bucket creation aborted
+// by a concurrent operation; the backoff doubles after every attempt.
+const bucketCreateAttempts = 5
+
+var bucketCreateBackoff = 2 * time.Second
+
+// S3API is the subset of the S3 client operations used by S3Service, implemented by *s3.Client.
+type S3API interface {
+	CreateBucket(ctx context.Context, params *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error)
+	PutBucketTagging(ctx context.Context, params *s3.PutBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.PutBucketTaggingOutput, error)
+	PutPublicAccessBlock(ctx context.Context, params *s3.PutPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.PutPublicAccessBlockOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error)
+	GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error)
+	PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error)
+}
+
 // S3Service represents a service for interacting with an S3 bucket.
 // It contains an S3 client and the name of the bucket to operate on.
 type S3Service struct {
-	Client     *s3.Client
+	Client     S3API
 	BucketName string
 	Region     string
+	// StorageClass is the storage class of the uploaded objects. Defaults to STANDARD when empty.
+	StorageClass string
+	// ObjectOwnership is the object ownership of a created bucket. Defaults to
+	// BucketOwnerEnforced when empty, which disables object ACLs.
+	ObjectOwnership string
+	// PublicRead uploads the objects with the public-read canned ACL, and lets a created bucket
+	// accept public object ACLs. It requires the ObjectWriter or BucketOwnerPreferred ownership.
+	PublicRead bool
+	// Tags are the tags of a created bucket, besides the ManagedByTagKey tag.
+	Tags map[string]string
 }
 
 // Create creates an S3 bucket using the AWS SDK for Go v2.
@@ -24,23 +59,275 @@ type S3Service struct {
 // The bucket name is specified by the S3Service's BucketName field, and the AWS region
 // is determined by the providers.AWSRegion constant.
 //
+// A creation failing with OperationAborted, because a concurrent run is operating on the same
+// bucket, is retried with a backoff until the competing operation completes. A bucket already
+// owned by the caller is left unchanged and is not treated as an error.
+//
+// The created bucket is tagged with the service's tags and as managed by this tool, and has
+// the ObjectOwnership of the service. With PublicRead, the block
+// public access settings of the created bucket are relaxed to accept public object ACLs, while
+// still blocking public bucket policies.
+//
 // Returns:
-//   - nil if the bucket is created successfully.
+//   - nil if the bucket is created successfully or is already owned by the caller.
 //   - an error if the bucket creation fails, including the bucket name and the underlying error.
 func (s *S3Service) Create() error {
+	ownership := s.objectOwnership()
+	if err := ValidateObjectOwnership(ownership, s.PublicRead); err != nil {
+		return err
+	}
+
 	// Create the bucket
-	slog.Info("Creating S3 bucket", "BucketName", s.BucketName)
-	_, err := s.Client.CreateBucket(context.TODO(), &s3.CreateBucketInput{
-		Bucket: aws.String(s.BucketName),
-		CreateBucketConfiguration: &types.CreateBucketConfiguration{
-			LocationConstraint: types.BucketLocationConstraint(s.Region),
-		},
-	})
+	slog.Info("Creating S3 bucket", "BucketName", s.BucketName, "ObjectOwnership", ownership)
+	backoff := bucketCreateBackoff
+	var err error
+	for attempt := 1; attempt <= bucketCreateAttempts; attempt++ {
+		_, err = s.Client.CreateBucket(context.TODO(), &s3.CreateBucketInput{
+			Bucket: aws.String(s.BucketName),
+			CreateBucketConfiguration: &types.CreateBucketConfiguration{
+				LocationConstraint: types.BucketLocationConstraint(s.Region),
+			},
+			ObjectOwnership: types.ObjectOwnership(ownership),
+		})
+		if !isOperationAbortedError(err) || attempt == bucketCreateAttempts {
+			break
+		}
+
+		slog.Warn("Bucket creation aborted by a concurrent operation, retrying.",
+			"BucketName", s.BucketName, "Attempt", attempt, "Wait", backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	var alreadyOwned *types.BucketAlreadyOwnedByYou
+	if errors.As(err, &alreadyOwned) {
+		slog.Warn("S3 bucket already exists, skipping creation.", "BucketName", s.BucketName)
+		if s.PublicRead {
+			slog.Warn("The object ownership and block public access settings of the existing bucket are left unchanged, and must allow public object ACLs.",
+				"BucketName", s.BucketName)
+		}
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create bucket %s: %w", s.BucketName, err)
 	}
 
+	if _, err := s.Client.PutBucketTagging(context.TODO(), &s3.PutBucketTaggingInput{
+		Bucket:  aws.String(s.BucketName),
+		Tagging: &types.Tagging{TagSet: s3Tags(s.Tags)},
+	}); err != nil {
+		return fmt.Errorf("failed to tag bucket %s: %w", s.BucketName, err)
+	}
+
+	if s.PublicRead {
+		// New buckets block public ACLs, which would reject the public-read uploads
+		slog.Info("Allowing public object ACLs on S3 bucket", "BucketName", s.BucketName)
+		_, err = s.Client.PutPublicAccessBlock(context.TODO(), &s3.PutPublicAccessBlockInput{
+			Bucket: aws.String(s.BucketName),
+			PublicAccessBlockConfiguration: &types.PublicAccessBlockConfiguration{
+				BlockPublicAcls:       aws.Bool(false),
+				IgnorePublicAcls:      aws.Bool(false),
+				BlockPublicPolicy:     aws.Bool(true),
+				RestrictPublicBuckets: aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to allow public object ACLs on bucket %s: %w", s.BucketName, err)
+		}
+	}
+
 	slog.Info("S3 Bucket created successfully", "BucketName", s.BucketName)
 
 	return nil
 }
+
+// Upload stores body in the S3 bucket under the given object key with the given content type,
+// using the service's storage class, and the public-read canned ACL when PublicRead is set.
+//
+// Returns:
+//   - nil if the object is uploaded successfully.
+//   - an error if the upload fails, including the bucket name, object key and the underlying error.
+func (s *S3Service) Upload(key string, body []byte, contentType string) error {
+	storageClass := s.StorageClass
+	if storageClass == "" {
+		storageClass = string(types.StorageClassStandard)
+	}
+	if err := ValidateStorageClass(storageClass); err != nil {
+		return err
+	}
+
+	slog.Info("Uploading object to S3 bucket", "BucketName", s.BucketName, "Key", key, "StorageClass", storageClass)
+	_, err := s.Client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:       aws.String(s.BucketName),
+		Key:          aws.String(key),
+		Body:         bytes.NewReader(body),
+		ContentType:  aws.String(contentType),
+		StorageClass: types.StorageClass(storageClass),
+		ACL:          s.objectACL(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to bucket %s: %w", key, s.BucketName, err)
+	}
+
+	return nil
+}
+
+// readableStorageClasses are the S3 storage classes whose objects can be read right away. The
+// objects of the archive classes, such as GLACIER and DEEP_ARCHIVE, must be restored before
+// they are read, so STS could not fetch the JWKS and openid-configuration stored in them.
+var readableStorageClasses = []types.StorageClass{
+	types.StorageClassStandard,
+	types.StorageClassStandardIa,
+	types.StorageClassOnezoneIa,
+	types.StorageClassIntelligentTiering,
+	types.StorageClassGlacierIr,
+}
+
+// ValidateStorageClass checks that storageClass is an S3 storage class whose objects can be
+// read without a restore, see readableStorageClasses.
+func ValidateStorageClass(storageClass string) error {
+	if slices.Contains(readableStorageClasses, types.StorageClass(storageClass)) {
+		return nil
+	}
+
+	return fmt.Errorf("storage class %q must be one of %q, whose objects can be read without a restore", storageClass, readableStorageClasses)
+}
+
+// ValidateBucketName checks that bucketName follows the S3 general purpose bucket naming rules:
+// 3 to 63 lowercase letters, digits, dots and hyphens, starting and ending with a letter or a
+// digit, without adjacent dots and not formatted as an IP address.
+func ValidateBucketName(bucketName string) error {
+	switch {
+	case len(bucketName) < 3 || len(bucketName) > 63:
+		return fmt.Errorf("bucket name %q must be between 3 and 63 characters long", bucketName)
+	case !bucketNamePattern.MatchString(bucketName):
+		return fmt.Errorf("bucket name %q must only contain lowercase letters, digits, '.' and '-', and start and end with a letter or a digit", bucketName)
+	case strings.Contains(bucketName, ".."):
+		return fmt.Errorf("bucket name %q must not contain adjacent dots", bucketName)
+	case net.ParseIP(bucketName) != nil:
+		return fmt.Errorf("bucket name %q must not be formatted as an IP address", bucketName)
+	}
+
+	return nil
+}
+
+var bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]*[a-z0-9]$`)
+
+// ValidateObjectOwnership checks that ownership is one of the S3 object ownership settings known
+// to the SDK and, when the objects are uploaded with a public ACL, that it does not disable ACLs.
+func ValidateObjectOwnership(ownership string, publicRead bool) error {
+	known := false
+	for _, value := range types.ObjectOwnership("").Values() {
+		if ownership == string(value) {
+			known = true
+		}
+	}
+	if !known {
+		return fmt.Errorf("unknown object ownership %q", ownership)
+	}
+
+	if publicRead && ownership == string(types.ObjectOwnershipBucketOwnerEnforced) {
+		return fmt.Errorf("public objects need ACLs, which are disabled by the %s object ownership: use %s or %s",
+			ownership, types.ObjectOwnershipBucketOwnerPreferred, types.ObjectOwnershipObjectWriter)
+	}
+
+	return nil
+}
+
+// objectOwnership returns the object ownership of a created bucket, BucketOwnerEnforced by default.
+func (s *S3Service) objectOwnership() string {
+	if s.ObjectOwnership == "" {
+		return string(types.ObjectOwnershipBucketOwnerEnforced)
+	}
+	return s.ObjectOwnership
+}
+
+// objectACL returns the canned ACL of the uploaded objects, none unless PublicRead is set.
+func (s *S3Service) objectACL() types.ObjectCannedACL {
+	if s.PublicRead {
+		return types.ObjectCannedACLPublicRead
+	}
+	return ""
+}
+
+// BucketURL returns the virtual-hosted style HTTPS URL of the S3 bucket in the given region.
+func BucketURL(bucketName, region string) string {
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucketName, region)
+}
+
+// ObjectURL returns the virtual-hosted style HTTPS URL of the object stored under key
+// in the given bucket. The key is normalized with JoinObjectKey, so that the URL always
+// agrees with the key the object is stored under.
+func ObjectURL(bucketName, region, key string) string {
+	return BucketURL(bucketName, region) + "/" + JoinObjectKey(key)
+}
+
+// JoinObjectKey joins the parts of an S3 object key with single slashes, dropping the empty
+// parts and the leading, trailing and duplicate slashes of each part. For example "prefix/"
+// and "/.well-known/jwks.json" are joined into "prefix/.well-known/jwks.json".
+func JoinObjectKey(parts ...string) string {
+	var segments []string
+	for _, part := range parts {
+		for _, segment := range strings.Split(part, "/") {
+			if segment != "" {
+				segments = append(segments, segment)
+			}
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// ObjectVersion describes a version of an object stored in a versioned S3 bucket.
+type ObjectVersion struct {
+	Key          string
+	VersionID    string
+	LastModified time.Time
+	IsLatest     bool
+}
+
+// ListObjectVersions lists all the versions of the object stored under key in the S3 bucket.
+//
+// Returns:
+//   - []ObjectVersion: The versions of the object, including the current one.
+//   - error: An error if listing the object versions fails.
+func (s *S3Service) ListObjectVersions(key string) ([]ObjectVersion, error) {
+	var versions []ObjectVersion
+	paginator := s3.NewListObjectVersionsPaginator(s.Client, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(s.BucketName),
+		Prefix: aws.String(key),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list versions of %s in bucket %s: %w", key, s.BucketName, err)
+		}
+		for _, version := range page.Versions {
+			// The prefix also matches longer keys
+			if aws.ToString(version.Key) != key {
+				continue
+			}
+			versions = append(versions, ObjectVersion{
+				Key:          key,
+				VersionID:    aws.ToString(version.VersionId),
+				LastModified: aws.ToTime(version.LastModified),
+				IsLatest:     aws.ToBool(version.IsLatest),
+			})
+		}
+	}
+
+	return versions, nil
+}
+
+// DeleteObjectVersion permanently deletes the given version of the object stored under key.
+func (s *S3Service) DeleteObjectVersion(key, versionID string) error {
+	slog.Info("Deleting object version", "BucketName", s.BucketName, "Key", key, "VersionId", versionID)
+	_, err := s.Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket:    aws.String(s.BucketName),
+		Key:       aws.String(key),
+		VersionId: aws.String(versionID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete version %s of %s in bucket %s: %w", versionID, key, s.BucketName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// fakeS3 is an S3API whose CreateBucket fails with OperationAborted for the first
+// abortedCreates calls. Other operations used by S3Service.Create succeed, the last
+// CreateBucket and PutPublicAccessBlock inputs being recorded. The lifecycle configuration
+// of the bucket is kept in lifecycleRules, which is missing while nil.
+type fakeS3 struct {
+	S3API
+	abortedCreates    int
+	createCalls       int
+	taggingCalls      int
+	createInput       *s3.CreateBucketInput
+	publicAccessBlock *s3.PutPublicAccessBlockInput
+	lifecycleRules    []types.LifecycleRule
+	lifecyclePuts     int
+}
+
+func (f *fakeS3) CreateBucket(_ context.Context, params *s3.CreateBucketInput, _ ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	f.createCalls++
+	f.createInput = params
+	if f.createCalls <= f.abortedCreates {
+		return nil, &smithy.GenericAPIError{Code: operationAbortedErrorCode, Message: "A conflicting conditional operation is currently in progress"}
+	}
+	return &s3.CreateBucketOutput{}, nil
+}
+
+func (f *fakeS3) PutBucketTagging(context.Context, *s3.PutBucketTaggingInput, ...func(*s3.Options)) (*s3.PutBucketTaggingOutput, error) {
+	f.taggingCalls++
+	return &s3.PutBucketTaggingOutput{}, nil
+}
+
+func (f *fakeS3) PutPublicAccessBlock(_ context.Context, params *s3.PutPublicAccessBlockInput, _ ...func(*s3.Options)) (*s3.PutPublicAccessBlockOutput, error) {
+	f.publicAccessBlock = params
+	return &s3.PutPublicAccessBlockOutput{}, nil
+}
+
+func (f *fakeS3) GetBucketLifecycleConfiguration(context.Context, *s3.GetBucketLifecycleConfigurationInput, ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	if f.lifecycleRules == nil {
+		return nil, &smithy.GenericAPIError{Code: noSuchLifecycleConfigurationErrorCode, Message: "The lifecycle configuration does not exist"}
+	}
+	return &s3.GetBucketLifecycleConfigurationOutput{Rules: f.lifecycleRules}, nil
+}
+
+func (f *fakeS3) PutBucketLifecycleConfiguration(_ context.Context, params *s3.PutBucketLifecycleConfigurationInput, _ ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	f.lifecyclePuts++
+	f.lifecycleRules = params.LifecycleConfiguration.Rules
+	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
+}
+
+func withoutBucketCreateBackoff(t *testing.T) {
+	t.Helper()
+	backoff := bucketCreateBackoff
+	bucketCreateBackoff = 0
+	t.Cleanup(func() { bucketCreateBackoff = backoff })
+}
+
+func TestS3CreateRetriesOperationAborted(t *testing.T) {
+	withoutBucketCreateBackoff(t)
+	client := &fakeS3{abortedCreates: 1}
+	service := &S3Service{Client: client, BucketName: "my-bucket", Region: "eu-west-1"}
+
+	if err := service.Create(); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if client.createCalls != 2 {
+		t.Errorf("CreateBucket calls = %d, want 2", client.createCalls)
+	}
+	if client.taggingCalls != 1 {
+		t.Errorf("PutBucketTagging calls = %d, want 1", client.taggingCalls)
+	}
+}
+
+func TestS3CreateGivesUpAfterMaxAttempts(t *testing.T) {
+	withoutBucketCreateBackoff(t)
+	client := &fakeS3{abortedCreates: bucketCreateAttempts + 1}
+	service := &S3Service{Client: client, BucketName: "my-bucket", Region: "eu-west-1"}
+
+	err := service.Create()
+	if !isOperationAbortedError(err) {
+		t.Fatalf("err = %v, want an OperationAborted error", err)
+	}
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want the API error to be wrapped", err)
+	}
+	if client.createCalls != bucketCreateAttempts {
+		t.Errorf("CreateBucket calls = %d, want %d", client.createCalls, bucketCreateAttempts)
+	}
+	if client.taggingCalls != 0 {
+		t.Errorf("PutBucketTagging calls = %d, want 0", client.taggingCalls)
+	}
+}
+
+func TestS3CreateObjectOwnership(t *testing.T) {
+	tests := []struct {
+		name              string
+		ownership         string
+		publicRead        bool
+		wantOwnership     types.ObjectOwnership
+		wantAccessAllowed bool
+	}{
+		{name: "private by default", wantOwnership: types.ObjectOwnershipBucketOwnerEnforced},
+		{name: "public read", ownership: string(types.ObjectOwnershipBucketOwnerPreferred), publicRead: true,
+			wantOwnership: types.ObjectOwnershipBucketOwnerPreferred, wantAccessAllowed: true},
+		{name: "public read as object writer", ownership: string(types.ObjectOwnershipObjectWriter), publicRead: true,
+			wantOwnership: types.ObjectOwnershipObjectWriter, wantAccessAllowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeS3{}
+			service := &S3Service{Client: client, BucketName: "my-bucket", Region: "eu-west-1",
+				ObjectOwnership: tt.ownership, PublicRead: tt.publicRead}
+
+			if err := service.Create(); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if client.createInput == nil || client.createInput.ObjectOwnership != tt.wantOwnership {
+				t.Errorf("CreateBucket input = %+v, want the %s object ownership", client.createInput, tt.wantOwnership)
+			}
+
+			if !tt.wantAccessAllowed {
+				if client.publicAccessBlock != nil {
+					t.Errorf("PutPublicAccessBlock called for a private bucket")
+				}
+				return
+			}
+			if client.publicAccessBlock == nil {
+				t.Fatal("PutPublicAccessBlock not called, the public-read uploads would be rejected")
+			}
+			block := client.publicAccessBlock.PublicAccessBlockConfiguration
+			if aws.ToString(client.publicAccessBlock.Bucket) != "my-bucket" || aws.ToBool(block.BlockPublicAcls) || aws.ToBool(block.IgnorePublicAcls) ||
+				!aws.ToBool(block.BlockPublicPolicy) || !aws.ToBool(block.RestrictPublicBuckets) {
+				t.Errorf("PutPublicAccessBlock input = %+v, want public ACLs allowed and public policies blocked", block)
+			}
+		})
+	}
+}
+
+func TestValidateObjectOwnership(t *testing.T) {
+	tests := []struct {
+		ownership  string
+		publicRead bool
+		wantErr    bool
+	}{
+		{ownership: "BucketOwnerEnforced"},
+		{ownership: "BucketOwnerPreferred"},
+		{ownership: "ObjectWriter"},
+		{ownership: "BucketOwnerEnforced", publicRead: true, wantErr: true},
+		{ownership: "BucketOwnerPreferred", publicRead: true},
+		{ownership: "ObjectWriter", publicRead: true},
+		{ownership: "Unknown", wantErr: true},
+		{ownership: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s,public=%t", tt.ownership, tt.publicRead), func(t *testing.T) {
+			err := ValidateObjectOwnership(tt.ownership, tt.publicRead)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateObjectOwnership() = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateStorageClass(t *testing.T) {
+	tests := []struct {
+		storageClass string
+		wantErr      bool
+	}{
+		{storageClass: "STANDARD"},
+		{storageClass: "STANDARD_IA"},
+		{storageClass: "ONEZONE_IA"},
+		{storageClass: "INTELLIGENT_TIERING"},
+		{storageClass: "GLACIER_IR"},
+		{storageClass: "GLACIER", wantErr: true},
+		{storageClass: "DEEP_ARCHIVE", wantErr: true},
+		{storageClass: "REDUCED_REDUNDANCY", wantErr: true},
+		{storageClass: "standard", wantErr: true},
+		{storageClass: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.storageClass, func(t *testing.T) {
+			err := ValidateStorageClass(tt.storageClass)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateStorageClass() = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// AssumeRoleWithWebIdentity exchanges the web identity token for temporary credentials of
+// the role with the given ARN. The request is not signed, so it does not depend on the
+// credentials of cfg, only on its region and the STS endpoint override of opts.
+//
+// Parameters:
+//   - cfg: The AWS configuration.
+//   - opts: The options holding the STS endpoint override.
+//   - roleARN: The ARN of the role to assume.
+//   - token: The signed web identity token.
+//   - sessionName: The role session name.
+//
+// Returns:
+//   - *sts.AssumeRoleWithWebIdentityOutput: The temporary credentials and assumed role details.
+//   - error: An error if STS rejects the token or the request fails.
+func AssumeRoleWithWebIdentity(cfg aws.Config, opts ClientOptions, roleARN, token, sessionName string) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+	client := NewSTSClient(cfg, opts)
+	out, err := client.AssumeRoleWithWebIdentity(context.TODO(), &sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(roleARN),
+		RoleSessionName:  aws.String(sessionName),
+		WebIdentityToken: aws.String(token),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume role %s with web identity: %w", roleARN, err)
+	}
+
+	return out, nil
+}
+
+// CallerIdentityWithCredentials returns the caller identity of the given temporary
+// credentials, e.g. the assumed-role ARN of the credentials returned by
+// AssumeRoleWithWebIdentity.
+func CallerIdentityWithCredentials(cfg aws.Config, opts ClientOptions, creds *types.Credentials) (*sts.GetCallerIdentityOutput, error) {
+	if creds == nil {
+		return nil, fmt.Errorf("no credentials returned")
+	}
+
+	cfg = cfg.Copy()
+	cfg.Credentials = aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
+		aws.ToString(creds.AccessKeyId),
+		aws.ToString(creds.SecretAccessKey),
+		aws.ToString(creds.SessionToken),
+	))
+
+	return clientIdentity(cfg, opts)
+}
@@ -0,0 +1,104 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// MaxTags is the largest number of user tags of a resource, including ManagedByTagKey.
+	MaxTags = 50
+	// maxTagKeyLength and maxTagValueLength are the largest tag key and value, in characters.
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// tagPattern matches the characters allowed in the tag keys and values of IAM and S3.
+var tagPattern = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]*$`)
+
+// ValidateTags checks the tags against the constraints shared by IAM and S3: at most MaxTags
+// tags including ManagedByTagKey, keys of 1 to 128 and values of up to 256 letters, digits,
+// spaces and "_.:/=+-@" characters, and no key using the reserved "aws:" prefix or
+// ManagedByTagKey, which is always set by this tool.
+//
+// Returns:
+//   - nil if every tag is valid.
+//   - an error joining one error per invalid tag with errors.Join.
+func ValidateTags(tags map[string]string) error {
+	var errs []error
+	if len(tags)+1 > MaxTags {
+		errs = append(errs, fmt.Errorf("%d tags exceed the limit of %d tags, including the %s tag", len(tags), MaxTags-1, ManagedByTagKey))
+	}
+
+	for _, key := range sortedTagKeys(tags) {
+		value := tags[key]
+		switch {
+		case key == "" || utf8.RuneCountInString(key) > maxTagKeyLength:
+			errs = append(errs, fmt.Errorf("tag key %q must be 1 to %d characters long", key, maxTagKeyLength))
+		case !tagPattern.MatchString(key):
+			errs = append(errs, fmt.Errorf("tag key %q must only contain letters, digits, spaces and '_.:/=+-@'", key))
+		case strings.HasPrefix(strings.ToLower(key), "aws:"):
+			errs = append(errs, fmt.Errorf("tag key %q must not use the reserved aws: prefix", key))
+		case key == ManagedByTagKey:
+			errs = append(errs, fmt.Errorf("tag key %s is reserved, it is always set to %s", key, ManagedByTagValue))
+		}
+
+		switch {
+		case utf8.RuneCountInString(value) > maxTagValueLength:
+			errs = append(errs, fmt.Errorf("value of tag %q must be at most %d characters long", key, maxTagValueLength))
+		case !tagPattern.MatchString(value):
+			errs = append(errs, fmt.Errorf("value of tag %q must only contain letters, digits, spaces and '_.:/=+-@'", key))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// resourceTags returns the tags of a created resource: the given tags and the ManagedByTagKey
+// tag marking it as created by this tool, sorted by key.
+func resourceTags(tags map[string]string) ([]string, map[string]string) {
+	merged := make(map[string]string, len(tags)+1)
+	for key, value := range tags {
+		merged[key] = value
+	}
+	merged[ManagedByTagKey] = ManagedByTagValue
+	return sortedTagKeys(merged), merged
+}
+
+// iamTags returns the resource tags as IAM tags.
+func iamTags(tags map[string]string) []iamTypes.Tag {
+	keys, merged := resourceTags(tags)
+	iamTags := make([]iamTypes.Tag, 0, len(keys))
+	for _, key := range keys {
+		iamTags = append(iamTags, iamTypes.Tag{Key: aws.String(key), Value: aws.String(merged[key])})
+	}
+	return iamTags
+}
+
+// s3Tags returns the resource tags as S3 tags.
+func s3Tags(tags map[string]string) []s3Types.Tag {
+	keys, merged := resourceTags(tags)
+	s3Tags := make([]s3Types.Tag, 0, len(keys))
+	for _, key := range keys {
+		s3Tags = append(s3Tags, s3Types.Tag{Key: aws.String(key), Value: aws.String(merged[key])})
+	}
+	return s3Tags
+}
+
+// sortedTagKeys returns the keys of the tags in lexical order.
+func sortedTagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,396 @@
+package aws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	// PolicyVersion is the IAM policy language version used for generated policies.
+	PolicyVersion = "2012-10-17"
+
+	actionAssumeRoleWithWebIdentity = "sts:AssumeRoleWithWebIdentity"
+	actionSetSourceIdentity         = "sts:SetSourceIdentity"
+	conditionSourceIdentity         = "sts:SourceIdentity"
+	conditionSourceIP               = "aws:SourceIp"
+	conditionSourceVPCE             = "aws:SourceVpce"
+)
+
+// vpceIDPattern matches the IDs of VPC endpoints, e.g. vpce-1a2b3c4d or vpce-0123456789abcdef0.
+var vpceIDPattern = regexp.MustCompile(`^vpce-(?:[0-9a-f]{8}|[0-9a-f]{17})$`)
+
+// TrustPolicyInput holds the values used to render the trust policy of an IAM role
+// that is assumed with tokens issued by an OIDC identity provider.
+type TrustPolicyInput struct {
+	// ProviderARN is the ARN of the IAM OIDC identity provider trusted by the role.
+	ProviderARN string
+	// Issuer is the issuer URL of the OIDC identity provider.
+	Issuer string
+	// Audiences are the accepted values of the token "aud" claim, usually the client IDs of
+	// the IAM OIDC provider.
+	Audiences []string
+	// Subject is the expected value of the token "sub" claim. A subject with the * or ?
+	// wildcards is a pattern matched with StringLike.
+	Subject string
+	// AllowSourceIdentity adds the sts:SetSourceIdentity action to the policy.
+	AllowSourceIdentity bool
+	// SourceIdentityMatchesSubject constrains the source identity to the token "sub" claim.
+	SourceIdentityMatchesSubject bool
+	// SourceIPs are the IP addresses or CIDR blocks the role may be assumed from, matched
+	// against aws:SourceIp. Any source IP is allowed when empty.
+	SourceIPs []string
+	// SourceVPCEs are the IDs of the VPC endpoints the role may be assumed through, matched
+	// against aws:SourceVpce. Any network path is allowed when empty.
+	SourceVPCEs []string
+}
+
+// PolicyDocument represents an IAM policy document.
+type PolicyDocument struct {
+	Version   string            `json:"Version"`
+	Statement []PolicyStatement `json:"Statement"`
+}
+
+// PolicyStatement represents a single statement of an IAM policy document.
+type PolicyStatement struct {
+	Effect    string                    `json:"Effect"`
+	Principal map[string]string         `json:"Principal,omitempty"`
+	Action    []string                  `json:"Action"`
+	Condition map[string]map[string]any `json:"Condition,omitempty"`
+}
+
+// ConditionKeyPrefix converts an issuer URL into the prefix IAM uses for the
+// OIDC condition keys, i.e. the issuer without its scheme and trailing slash.
+// For example "https://example.com/" becomes "example.com".
+func ConditionKeyPrefix(issuer string) string {
+	prefix := strings.TrimPrefix(issuer, "https://")
+	return strings.TrimSuffix(prefix, "/")
+}
+
+// AudienceConditionKey returns the IAM condition key matched against the "aud" claim of the
+// tokens of the issuer, e.g. "example.com:aud".
+func AudienceConditionKey(issuer string) string {
+	return ConditionKeyPrefix(issuer) + ":aud"
+}
+
+// SubjectConditionKey returns the IAM condition key matched against the "sub" claim of the
+// tokens of the issuer, e.g. "example.com:sub".
+func SubjectConditionKey(issuer string) string {
+	return ConditionKeyPrefix(issuer) + ":sub"
+}
+
+// OIDCProviderARN returns the ARN of the IAM OIDC identity provider for the given
+// account and issuer URL.
+func OIDCProviderARN(accountID, issuer string) string {
+	return fmt.Sprintf("arn:aws:iam::%s:oidc-provider/%s", accountID, ConditionKeyPrefix(issuer))
+}
+
+// TrustPolicy builds the trust policy document allowing the OIDC identity provider
+// to assume a role with web identity tokens matching the given audiences and subject.
+//
+// A single audience is rendered as a string condition and several audiences as a list
+// condition, which StringEquals matches when the token audience is any of them. A subject
+// with wildcards is rendered as a StringLike condition.
+//
+// When AllowSourceIdentity is set, the sts:SetSourceIdentity action is allowed by its own
+// statement, with the same audience and subject conditions. When SourceIdentityMatchesSubject
+// is also set, that statement requires the source identity to equal the token "sub" claim.
+// The condition on sts:SourceIdentity is kept out of the sts:AssumeRoleWithWebIdentity
+// statement, which it would otherwise deny whenever no source identity is set.
+//
+// SourceIPs and SourceVPCEs add an IpAddress condition on aws:SourceIp and a StringEquals
+// condition on aws:SourceVpce. As all the conditions of a statement must be met, the request
+// must then come from one of the source IPs, or through one of the VPC endpoints, in addition
+// to carrying a token with the expected audience and subject. When both are set, each is
+// rendered in its own statement, so that either network path is allowed: aws:SourceIp is not
+// present on the requests made through a VPC endpoint, so a statement requiring both would
+// never match.
+//
+// Returns:
+//   - PolicyDocument: The trust policy document.
+//   - error: An error if a required input is missing.
+func TrustPolicy(in TrustPolicyInput) (PolicyDocument, error) {
+	if in.ProviderARN == "" {
+		return PolicyDocument{}, fmt.Errorf("provider ARN is required")
+	}
+	if in.Issuer == "" {
+		return PolicyDocument{}, fmt.Errorf("issuer is required")
+	}
+
+	stringEquals := map[string]any{}
+	switch len(in.Audiences) {
+	case 0:
+	case 1:
+		stringEquals[AudienceConditionKey(in.Issuer)] = in.Audiences[0]
+	default:
+		stringEquals[AudienceConditionKey(in.Issuer)] = in.Audiences
+	}
+	stringLike := map[string]any{}
+	if strings.ContainsAny(in.Subject, "*?") {
+		stringLike[SubjectConditionKey(in.Issuer)] = in.Subject
+	} else if in.Subject != "" {
+		stringEquals[SubjectConditionKey(in.Issuer)] = in.Subject
+	}
+
+	if err := ValidateSourceIPs(in.SourceIPs); err != nil {
+		return PolicyDocument{}, err
+	}
+	if err := ValidateSourceVPCEs(in.SourceVPCEs); err != nil {
+		return PolicyDocument{}, err
+	}
+	// Each network path the role may be assumed through gets its own statement
+	var networkConditions []map[string]map[string]any
+	if value := policyValue(in.SourceIPs); value != nil {
+		networkConditions = append(networkConditions, map[string]map[string]any{"IpAddress": {conditionSourceIP: value}})
+	}
+	if value := policyValue(in.SourceVPCEs); value != nil {
+		networkConditions = append(networkConditions, map[string]map[string]any{"StringEquals": {conditionSourceVPCE: value}})
+	}
+	if len(networkConditions) == 0 {
+		networkConditions = append(networkConditions, nil)
+	}
+
+	claimConditions := map[string]map[string]any{}
+	if len(stringEquals) > 0 {
+		claimConditions["StringEquals"] = stringEquals
+	}
+	if len(stringLike) > 0 {
+		claimConditions["StringLike"] = stringLike
+	}
+
+	statements := make([]PolicyStatement, 0, len(networkConditions))
+	for _, network := range networkConditions {
+		statement := PolicyStatement{
+			Effect:    "Allow",
+			Principal: map[string]string{"Federated": in.ProviderARN},
+			Action:    []string{actionAssumeRoleWithWebIdentity},
+			Condition: mergeConditions(claimConditions, network),
+		}
+		statements = append(statements, statement)
+	}
+
+	if in.AllowSourceIdentity {
+		var sourceIdentity map[string]map[string]any
+		if in.SourceIdentityMatchesSubject {
+			sourceIdentity = map[string]map[string]any{
+				"StringEquals": {conditionSourceIdentity: fmt.Sprintf("${%s}", SubjectConditionKey(in.Issuer))},
+			}
+		}
+		statements = append(statements, PolicyStatement{
+			Effect:    "Allow",
+			Principal: map[string]string{"Federated": in.ProviderARN},
+			Action:    []string{actionSetSourceIdentity},
+			Condition: mergeConditions(claimConditions, sourceIdentity),
+		})
+	}
+
+	return PolicyDocument{
+		Version:   PolicyVersion,
+		Statement: statements,
+	}, nil
+}
+
+// mergeConditions returns the conditions of both condition blocks, or nil when both are empty.
+func mergeConditions(a, b map[string]map[string]any) map[string]map[string]any {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+
+	merged := map[string]map[string]any{}
+	for _, conditions := range []map[string]map[string]any{a, b} {
+		for operator, values := range conditions {
+			if merged[operator] == nil {
+				merged[operator] = map[string]any{}
+			}
+			for key, value := range values {
+				merged[operator][key] = value
+			}
+		}
+	}
+	return merged
+}
+
+// RenderTrustPolicy renders the trust policy built by TrustPolicy as indented JSON.
+func RenderTrustPolicy(in TrustPolicyInput) ([]byte, error) {
+	policy, err := TrustPolicy(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trust policy: %w", err)
+	}
+
+	policyJSON, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal trust policy: %w", err)
+	}
+
+	return policyJSON, nil
+}
+
+// CheckTrustPolicy reports whether the trust policy document of a role, as returned by IAM,
+// allows tokens of the OIDC identity provider with one of the audiences and the subject of in
+// to assume the role. StringEquals and StringLike conditions on the "aud" and "sub" keys are evaluated;
+// other conditions are ignored.
+//
+// Returns:
+//   - nil if an Allow statement of the document trusts the provider for these claims.
+//   - an error describing why no statement matches.
+func CheckTrustPolicy(document string, in TrustPolicyInput) error {
+	var policy struct {
+		Statement []struct {
+			Effect    string
+			Principal map[string]any
+			Action    any
+			Condition map[string]map[string]any
+		}
+	}
+	if err := json.Unmarshal([]byte(document), &policy); err != nil {
+		return fmt.Errorf("failed to parse trust policy: %w", err)
+	}
+
+	claims := map[string][]string{
+		AudienceConditionKey(in.Issuer): in.Audiences,
+		SubjectConditionKey(in.Issuer):  {in.Subject},
+	}
+
+	trusted := false
+	for _, statement := range policy.Statement {
+		if statement.Effect != "Allow" || !containsValue(statement.Principal["Federated"], in.ProviderARN) ||
+			!containsValue(statement.Action, actionAssumeRoleWithWebIdentity) {
+			continue
+		}
+		trusted = true
+
+		if err := checkClaimConditions(statement.Condition, claims); err == nil {
+			return nil
+		}
+	}
+
+	if !trusted {
+		return fmt.Errorf("no statement allows %s for %s", actionAssumeRoleWithWebIdentity, in.ProviderARN)
+	}
+	return fmt.Errorf("the conditions do not match aud %q and sub %q", in.Audiences, in.Subject)
+}
+
+// checkClaimConditions evaluates the StringEquals and StringLike conditions on the given claims,
+// a condition being met when any of the values of its claim matches.
+func checkClaimConditions(conditions map[string]map[string]any, claims map[string][]string) error {
+	for operator, values := range conditions {
+		for key, expected := range values {
+			claim, ok := claims[key]
+			if !ok || (operator != "StringEquals" && operator != "StringLike") {
+				continue
+			}
+			matches := slices.ContainsFunc(claim, func(value string) bool {
+				if operator == "StringEquals" {
+					return containsValue(expected, value)
+				}
+				return matchesPattern(expected, value)
+			})
+			if !matches {
+				return fmt.Errorf("condition %s on %s does not match %q", operator, key, claim)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateAudiences checks that the token audiences are a non-empty subset of the audiences
+// accepted by the IAM OIDC provider, so that STS accepts the token.
+func ValidateAudiences(tokenAudiences, acceptedAudiences []string) error {
+	if len(tokenAudiences) == 0 {
+		return fmt.Errorf("at least one token audience is required")
+	}
+	for _, audience := range tokenAudiences {
+		if !slices.Contains(acceptedAudiences, audience) {
+			return fmt.Errorf("token audience %q is not one of the accepted audiences %q", audience, acceptedAudiences)
+		}
+	}
+	return nil
+}
+
+// ValidateSourceIPs checks that each source IP of a trust policy is an IPv4 or IPv6 address or
+// CIDR block, e.g. 203.0.113.0/24, without host bits set past the prefix length.
+func ValidateSourceIPs(sourceIPs []string) error {
+	var errs []error
+	for _, sourceIP := range sourceIPs {
+		if _, err := netip.ParseAddr(sourceIP); err == nil {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(sourceIP)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("source IP %q must be an IP address or CIDR block", sourceIP))
+		case prefix.Masked() != prefix:
+			errs = append(errs, fmt.Errorf("source IP %q has host bits set, expected %s", sourceIP, prefix.Masked()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateSourceVPCEs checks that each VPC endpoint of a trust policy is a VPC endpoint ID,
+// e.g. vpce-0123456789abcdef0.
+func ValidateSourceVPCEs(vpceIDs []string) error {
+	var errs []error
+	for _, vpceID := range vpceIDs {
+		if !vpceIDPattern.MatchString(vpceID) {
+			errs = append(errs, fmt.Errorf("VPC endpoint %q must be a VPC endpoint ID, e.g. vpce-0123456789abcdef0", vpceID))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// policyValue returns the values of a condition as IAM serializes them: nil when empty, a
+// string for a single value and a list otherwise.
+func policyValue(values []string) any {
+	switch len(values) {
+	case 0:
+		return nil
+	case 1:
+		return values[0]
+	default:
+		return values
+	}
+}
+
+// containsValue reports whether a policy value, a string or a list of strings, contains want.
+func containsValue(value any, want string) bool {
+	for _, v := range policyValues(value) {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesPattern reports whether want matches one of the StringLike patterns of a policy value,
+// where "*" matches any sequence of characters, including "/", and "?" any single character.
+func matchesPattern(value any, want string) bool {
+	for _, pattern := range policyValues(value) {
+		expr := regexp.QuoteMeta(pattern)
+		expr = strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(expr)
+		if regexp.MustCompile("^" + expr + "$").MatchString(want) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyValues returns the strings of a policy value, which IAM serializes as a string or a list.
+func policyValues(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package aws
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testProviderARN = "arn:aws:iam::123456789012:oidc-provider/example.com"
+
+// compactJSON removes the insignificant whitespace of the JSON document.
+func compactJSON(t *testing.T, document string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(document)); err != nil {
+		t.Fatalf("json.Compact: %v", err)
+	}
+	return buf.String()
+}
+
+func TestRenderTrustPolicyConditions(t *testing.T) {
+	tests := []struct {
+		name string
+		in   TrustPolicyInput
+		want string
+	}{
+		{
+			name: "single audience is a string",
+			in:   TrustPolicyInput{Audiences: []string{"sts.amazonaws.com"}, Subject: "system:serviceaccount:default:app"},
+			want: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow",
+				"Principal":{"Federated":"arn:aws:iam::123456789012:oidc-provider/example.com"},
+				"Action":["sts:AssumeRoleWithWebIdentity"],
+				"Condition":{"StringEquals":{"example.com:aud":"sts.amazonaws.com","example.com:sub":"system:serviceaccount:default:app"}}}]}`,
+		},
+		{
+			name: "several audiences are a list",
+			in:   TrustPolicyInput{Audiences: []string{"sts.amazonaws.com", "my-client"}, Subject: "app"},
+			want: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow",
+				"Principal":{"Federated":"arn:aws:iam::123456789012:oidc-provider/example.com"},
+				"Action":["sts:AssumeRoleWithWebIdentity"],
+				"Condition":{"StringEquals":{"example.com:aud":["sts.amazonaws.com","my-client"],"example.com:sub":"app"}}}]}`,
+		},
+		{
+			name: "wildcard subject uses StringLike",
+			in:   TrustPolicyInput{Audiences: []string{"sts.amazonaws.com"}, Subject: "project_path:group/*:ref_type:branch:ref:?ain"},
+			want: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow",
+				"Principal":{"Federated":"arn:aws:iam::123456789012:oidc-provider/example.com"},
+				"Action":["sts:AssumeRoleWithWebIdentity"],
+				"Condition":{"StringEquals":{"example.com:aud":"sts.amazonaws.com"},
+					"StringLike":{"example.com:sub":"project_path:group/*:ref_type:branch:ref:?ain"}}}]}`,
+		},
+		{
+			name: "source IPs coexist with the claim conditions",
+			in: TrustPolicyInput{Audiences: []string{"sts.amazonaws.com"}, Subject: "app",
+				SourceIPs: []string{"203.0.113.0/24", "2001:db8::/32"}},
+			want: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow",
+				"Principal":{"Federated":"arn:aws:iam::123456789012:oidc-provider/example.com"},
+				"Action":["sts:AssumeRoleWithWebIdentity"],
+				"Condition":{"IpAddress":{"aws:SourceIp":["203.0.113.0/24","2001:db8::/32"]},
+					"StringEquals":{"example.com:aud":"sts.amazonaws.com","example.com:sub":"app"}}}]}`,
+		},
+		{
+			name: "source VPC endpoint coexists with the claim conditions",
+			in: TrustPolicyInput{Audiences: []string{"sts.amazonaws.com"}, Subject: "app",
+				SourceVPCEs: []string{"vpce-0123456789abcdef0"}},
+			want: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow",
+				"Principal":{"Federated":"arn:aws:iam::123456789012:oidc-provider/example.com"},
+				"Action":["sts:AssumeRoleWithWebIdentity"],
+				"Condition":{"StringEquals":{"aws:SourceVpce":"vpce-0123456789abcdef0","example.com:aud":"sts.amazonaws.com","example.com:sub":"app"}}}]}`,
+		},
+		{
+			name: "source IPs and VPC endpoint are alternative statements",
+			in: TrustPolicyInput{Audiences: []string{"sts.amazonaws.com"}, Subject: "app",
+				SourceIPs: []string{"203.0.113.0/24"}, SourceVPCEs: []string{"vpce-0123456789abcdef0"}},
+			want: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow",
+				"Principal":{"Federated":"arn:aws:iam::123456789012:oidc-provider/example.com"},
+				"Action":["sts:AssumeRoleWithWebIdentity"],
+				"Condition":{"IpAddress":{"aws:SourceIp":"203.0.113.0/24"},
+					"StringEquals":{"example.com:aud":"sts.amazonaws.com","example.com:sub":"app"}}},
+				{"Effect":"Allow",
+				"Principal":{"Federated":"arn:aws:iam::123456789012:oidc-provider/example.com"},
+				"Action":["sts:AssumeRoleWithWebIdentity"],
+				"Condition":{"StringEquals":{"aws:SourceVpce":"vpce-0123456789abcdef0","example.com:aud":"sts.amazonaws.com","example.com:sub":"app"}}}]}`,
+		},
+		{
+			name: "source identity is allowed by its own statement",
+			in:   TrustPolicyInput{Audiences: []string{"sts.amazonaws.com"}, Subject: "app", AllowSourceIdentity: true},
+			want: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow",
+				"Principal":{"Federated":"arn:aws:iam::123456789012:oidc-provider/example.com"},
+				"Action":["sts:AssumeRoleWithWebIdentity"],
+				"Condition":{"StringEquals":{"example.com:aud":"sts.amazonaws.com","example.com:sub":"app"}}},
+				{"Effect":"Allow",
+				"Principal":{"Federated":"arn:aws:iam::123456789012:oidc-provider/example.com"},
+				"Action":["sts:SetSourceIdentity"],
+				"Condition":{"StringEquals":{"example.com:aud":"sts.amazonaws.com","example.com:sub":"app"}}}]}`,
+		},
+		{
+			name: "source identity matching the subject is only required to set it",
+			in: TrustPolicyInput{Audiences: []string{"sts.amazonaws.com"}, Subject: "app",
+				AllowSourceIdentity: true, SourceIdentityMatchesSubject: true},
+			want: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow",
+				"Principal":{"Federated":"arn:aws:iam::123456789012:oidc-provider/example.com"},
+				"Action":["sts:AssumeRoleWithWebIdentity"],
+				"Condition":{"StringEquals":{"example.com:aud":"sts.amazonaws.com","example.com:sub":"app"}}},
+				{"Effect":"Allow",
+				"Principal":{"Federated":"arn:aws:iam::123456789012:oidc-provider/example.com"},
+				"Action":["sts:SetSourceIdentity"],
+				"Condition":{"StringEquals":{"example.com:aud":"sts.amazonaws.com","example.com:sub":"app",
+					"sts:SourceIdentity":"${example.com:sub}"}}}]}`,
+		},
+		{
+			name: "no audience nor subject has no condition",
+			in:   TrustPolicyInput{},
+			want: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow",
+				"Principal":{"Federated":"arn:aws:iam::123456789012:oidc-provider/example.com"},
+				"Action":["sts:AssumeRoleWithWebIdentity"]}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.in.ProviderARN = testProviderARN
+			tt.in.Issuer = "https://example.com/"
+			policy, err := RenderTrustPolicy(tt.in)
+			if err != nil {
+				t.Fatalf("RenderTrustPolicy: %v", err)
+			}
+			if got, want := compactJSON(t, string(policy)), compactJSON(t, tt.want); got != want {
+				t.Errorf("policy =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateAudiences(t *testing.T) {
+	accepted := []string{"sts.amazonaws.com", "my-client"}
+	if err := ValidateAudiences([]string{"my-client"}, accepted); err != nil {
+		t.Errorf("ValidateAudiences: %v", err)
+	}
+	if err := ValidateAudiences([]string{"my-client", "other"}, accepted); err == nil {
+		t.Error("ValidateAudiences accepted an audience outside the accepted audiences")
+	}
+	if err := ValidateAudiences(nil, accepted); err == nil {
+		t.Error("ValidateAudiences accepted no audience")
+	}
+}
+
+func TestTrustPolicyRejectsInvalidNetworkConditions(t *testing.T) {
+	tests := []TrustPolicyInput{
+		{SourceIPs: []string{"203.0.113.1/24"}},
+		{SourceIPs: []string{"not-an-ip"}},
+		{SourceVPCEs: []string{"vpc-0123456789abcdef0"}},
+	}
+
+	for _, in := range tests {
+		in.ProviderARN = testProviderARN
+		in.Issuer = "https://example.com"
+		if _, err := TrustPolicy(in); err == nil {
+			t.Errorf("TrustPolicy(%v, %v) accepted an invalid network condition", in.SourceIPs, in.SourceVPCEs)
+		}
+	}
+}
+
+func TestCheckTrustPolicy(t *testing.T) {
+	token := TrustPolicyInput{
+		ProviderARN: testProviderARN,
+		Issuer:      "https://example.com",
+		Audiences:   []string{"sts.amazonaws.com"},
+		Subject:     "my-role",
+	}
+	rendered, err := RenderTrustPolicy(token)
+	if err != nil {
+		t.Fatalf("RenderTrustPolicy: %v", err)
+	}
+
+	statement := func(effect, principal, action, conditions string) string {
+		return `{"Version":"2012-10-17","Statement":[{"Effect":"` + effect + `","Principal":{"Federated":"` + principal +
+			`"},"Action":"` + action + `","Condition":{` + conditions + `}}]}`
+	}
+	tests := []struct {
+		name     string
+		document string
+		in       TrustPolicyInput
+		wantErr  string
+	}{
+		{name: "rendered policy", document: string(rendered), in: token},
+		{
+			name: "one of several audiences",
+			document: statement("Allow", testProviderARN, "sts:AssumeRoleWithWebIdentity",
+				`"StringEquals":{"example.com:aud":["sts.amazonaws.com","my-client"],"example.com:sub":"my-role"}`),
+			in: TrustPolicyInput{ProviderARN: testProviderARN, Issuer: "https://example.com", Audiences: []string{"other", "my-client"}, Subject: "my-role"},
+		},
+		{
+			name: "subject pattern",
+			document: statement("Allow", testProviderARN, "sts:AssumeRoleWithWebIdentity",
+				`"StringEquals":{"example.com:aud":"sts.amazonaws.com"},"StringLike":{"example.com:sub":"my-*"}`),
+			in: token,
+		},
+		{
+			name: "other conditions ignored",
+			document: statement("Allow", testProviderARN, "sts:AssumeRoleWithWebIdentity",
+				`"StringEquals":{"example.com:aud":"sts.amazonaws.com","example.com:sub":"my-role"},"IpAddress":{"aws:SourceIp":"203.0.113.0/24"}`),
+			in: token,
+		},
+		{
+			name: "audience mismatch",
+			document: statement("Allow", testProviderARN, "sts:AssumeRoleWithWebIdentity",
+				`"StringEquals":{"example.com:aud":"my-client","example.com:sub":"my-role"}`),
+			in:      token,
+			wantErr: "the conditions do not match",
+		},
+		{
+			name: "subject mismatch",
+			document: statement("Allow", testProviderARN, "sts:AssumeRoleWithWebIdentity",
+				`"StringEquals":{"example.com:aud":"sts.amazonaws.com"},"StringLike":{"example.com:sub":"other-*"}`),
+			in:      token,
+			wantErr: "the conditions do not match",
+		},
+		{
+			name: "other provider",
+			document: statement("Allow", "arn:aws:iam::123456789012:oidc-provider/other.example.com", "sts:AssumeRoleWithWebIdentity",
+				`"StringEquals":{"example.com:aud":"sts.amazonaws.com","example.com:sub":"my-role"}`),
+			in:      token,
+			wantErr: "no statement allows sts:AssumeRoleWithWebIdentity",
+		},
+		{
+			name: "deny statement",
+			document: statement("Deny", testProviderARN, "sts:AssumeRoleWithWebIdentity",
+				`"StringEquals":{"example.com:aud":"sts.amazonaws.com","example.com:sub":"my-role"}`),
+			in:      token,
+			wantErr: "no statement allows sts:AssumeRoleWithWebIdentity",
+		},
+		{
+			name: "other action",
+			document: statement("Allow", testProviderARN, "sts:AssumeRole",
+				`"StringEquals":{"example.com:aud":"sts.amazonaws.com","example.com:sub":"my-role"}`),
+			in:      token,
+			wantErr: "no statement allows sts:AssumeRoleWithWebIdentity",
+		},
+		{name: "invalid document", document: "{", in: token, wantErr: "failed to parse trust policy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckTrustPolicy(tt.document, tt.in)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckTrustPolicy: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
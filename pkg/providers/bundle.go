@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BundleVersion is the version of the bundle format produced by EncodeBundle.
+const BundleVersion = 1
+
+// Bundle carries the issuer, the JWKS and a signed JWT, so that a whole OIDC test setup can be
+// passed around as a single opaque value, e.g. one environment variable or secret.
+//
+// The JWKS is kept as the exact content of the JWKS file, so that decoding a bundle writes
+// back the very same file.
+type Bundle struct {
+	Version int    `json:"version"`
+	Issuer  string `json:"issuer"`
+	JWKS    string `json:"jwks"`
+	JWT     string `json:"jwt"`
+}
+
+// NewBundle bundles the JWKS file in the specified directory with the issuer and the signed JWT.
+func NewBundle(filePath, issuer string, signedJWT []byte) (*Bundle, error) {
+	jwks, err := os.ReadFile(filepath.Join(filePath, TLSDirName, JWKSFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+
+	return &Bundle{
+		Version: BundleVersion,
+		Issuer:  issuer,
+		JWKS:    string(jwks),
+		JWT:     string(signedJWT),
+	}, nil
+}
+
+// EncodeBundle encodes the bundle as standard base64 of its JSON representation.
+func EncodeBundle(bundle *Bundle) (string, error) {
+	bundleJSON, err := json.Marshal(bundle)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal bundle: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(bundleJSON), nil
+}
+
+// DecodeBundle decodes a bundle encoded by EncodeBundle. Surrounding whitespace is ignored.
+//
+// Returns:
+//   - *Bundle: The decoded bundle.
+//   - error: An error if the value is not a base64-encoded bundle of a supported version.
+func DecodeBundle(encoded string) (*Bundle, error) {
+	bundleJSON, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode bundle: %w", err)
+	}
+
+	bundle := &Bundle{}
+	if err := json.Unmarshal(bundleJSON, bundle); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle: %w", err)
+	}
+	if bundle.Version != BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d, expected %d", bundle.Version, BundleVersion)
+	}
+
+	return bundle, nil
+}
+
+// WriteBundle writes the issuer, the JWKS and the JWT of the bundle to the issuer, JWKS and JWT
+// files in the specified directory, with their exact content, so that a decoded bundle round
+// trips. The JWT file can be used as AWS_WEB_IDENTITY_TOKEN_FILE.
+func WriteBundle(filePath string, bundle *Bundle) error {
+	dir := filepath.Join(filePath, TLSDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory for the bundle: %w", err)
+	}
+
+	issuerFile := filepath.Join(dir, IssuerFileName)
+	jwksFile := filepath.Join(dir, JWKSFileName)
+	jwtFile := filepath.Join(dir, JWTFileName)
+	if err := writeFilesAtomic(
+		atomicFile{name: issuerFile, data: []byte(bundle.Issuer), perm: 0644},
+		atomicFile{name: jwksFile, data: []byte(bundle.JWKS), perm: 0644},
+		atomicFile{name: jwtFile, data: []byte(bundle.JWT), perm: 0600},
+	); err != nil {
+		return fmt.Errorf("failed to write bundle to files: %w", err)
+	}
+	slog.Info("Bundle written to", slog.String("issuer", issuerFile), slog.String("jwks", jwksFile), slog.String("jwt", jwtFile))
+
+	return nil
+}
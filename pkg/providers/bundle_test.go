@@ -0,0 +1,55 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	dir := newTestKeyPairDir(t)
+	signingKey, err := CreateJSONWebKeySet(dir, JWKSOptions{MinKeySize: 2048})
+	if err != nil {
+		t.Fatalf("CreateJSONWebKeySet: %v", err)
+	}
+	signedJWT, err := CreateJWT(signingKey, JWTOptions{Issuer: "https://oidc.example.com"})
+	if err != nil {
+		t.Fatalf("CreateJWT: %v", err)
+	}
+	bundle, err := NewBundle(dir, "https://oidc.example.com", signedJWT)
+	if err != nil {
+		t.Fatalf("NewBundle: %v", err)
+	}
+	encoded, err := EncodeBundle(bundle)
+	if err != nil {
+		t.Fatalf("EncodeBundle: %v", err)
+	}
+
+	decoded, err := DecodeBundle(" " + encoded + "\n")
+	if err != nil {
+		t.Fatalf("DecodeBundle: %v", err)
+	}
+	outputDir := t.TempDir()
+	if err := WriteBundle(outputDir, decoded); err != nil {
+		t.Fatalf("WriteBundle: %v", err)
+	}
+
+	jwks, err := os.ReadFile(filepath.Join(dir, TLSDirName, JWKSFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		IssuerFileName: "https://oidc.example.com",
+		JWKSFileName:   string(jwks),
+		JWTFileName:    string(signedJWT),
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(outputDir, TLSDirName, name))
+		if err != nil {
+			t.Fatalf("the bundle was not written to %s: %v", name, err)
+		}
+		if string(got) != content {
+			t.Errorf("%s =\n%s\nwant\n%s", name, got, content)
+		}
+	}
+}
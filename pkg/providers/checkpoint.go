@@ -0,0 +1,223 @@
+package providers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ProvisioningStateVersion is the version of the provisioning state file format.
+const ProvisioningStateVersion = 1
+
+// ProvisioningState records the AWS resources provisioned by CreateIdentityProvider in the
+// provisioning state file of the output directory, so that a run interrupted or failed midway
+// resumes where it stopped instead of calling AWS again for the steps already completed.
+//
+// The state holds one Checkpoint per configuration, keyed by the AWS account ID and a hash of
+// the inputs defining the provisioned resources, so that changing any of them, or the
+// credentials of another account, starts from a fresh checkpoint. Deleting the file forces a
+// full run.
+type ProvisioningState struct {
+	// Version is the format version of the file, ProvisioningStateVersion.
+	Version int `json:"version"`
+	// Checkpoints are the progress of each configuration provisioned from the output directory.
+	Checkpoints map[string]*Checkpoint `json:"checkpoints"`
+}
+
+// Checkpoint records the steps of CreateIdentityProvider completed for a configuration.
+type Checkpoint struct {
+	// Issuer is the issuer URL of the configuration, for inspection.
+	Issuer string `json:"issuer"`
+	// BucketName is the name of the bucket of the configuration, when not skipped.
+	BucketName string `json:"bucketName,omitempty"`
+	// BucketCreated reports whether the bucket was created, tagged and configured.
+	BucketCreated bool `json:"bucketCreated,omitempty"`
+	// UploadedObjects maps the key of each uploaded object to the hex-encoded SHA-256 of its
+	// body, so that a document is uploaded again when it changes.
+	UploadedObjects map[string]string `json:"uploadedObjects,omitempty"`
+	// LifecycleRule reports whether the lifecycle rule of the bucket was put.
+	LifecycleRule bool `json:"lifecycleRule,omitempty"`
+	// ProviderARN is the ARN of the created IAM OIDC provider.
+	ProviderARN string `json:"providerArn,omitempty"`
+	// RoleARN is the ARN of the created IAM role.
+	RoleARN string `json:"roleArn,omitempty"`
+	// TrustPolicySHA256 is the hex-encoded SHA-256 of the trust policy the role was created or
+	// updated with, so that the role is updated again when the policy changes.
+	TrustPolicySHA256 string `json:"trustPolicySha256,omitempty"`
+	// UpdatedAt is the time the last step completed.
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ReadProvisioningState reads the provisioning state of the specified directory, or returns
+// an empty state when no run recorded one.
+func ReadProvisioningState(filePath string) (*ProvisioningState, error) {
+	state := &ProvisioningState{Version: ProvisioningStateVersion, Checkpoints: map[string]*Checkpoint{}}
+
+	data, err := os.ReadFile(filepath.Join(filePath, ProvisioningStateFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provisioning state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse provisioning state %s, delete it to run every step again: %w",
+			filepath.Join(filePath, ProvisioningStateFileName), err)
+	}
+	if state.Version != ProvisioningStateVersion {
+		return nil, fmt.Errorf("unsupported provisioning state version %d, expected %d", state.Version, ProvisioningStateVersion)
+	}
+	if state.Checkpoints == nil {
+		state.Checkpoints = map[string]*Checkpoint{}
+	}
+
+	return state, nil
+}
+
+// checkpointKey returns the key of the checkpoint of cfg in the provisioning state: the AWS
+// account ID and the truncated SHA-256 of the inputs defining the provisioned resources.
+// Local settings, such as the JWT options or the output format, are not part of it.
+func checkpointKey(cfg *Config, accountID string) (string, error) {
+	inputs, err := json.Marshal(struct {
+		Issuer              string
+		BucketName          string
+		Region              string
+		KeyPrefix           string
+		StorageClass        string
+		ObjectOwnership     string
+		Public              bool
+		SkipBucket          bool
+		NoDiscovery         bool
+		LifecycleExpireDays int
+		LifecyclePrefix     string
+		Thumbprints         []string
+		Audiences           []string
+		RoleName            string
+		Tags                map[string]string
+		EndpointURL         string
+		S3Endpoint          string
+		IAMEndpoint         string
+	}{
+		Issuer:              cfg.Issuer(),
+		BucketName:          cfg.BucketName,
+		Region:              cfg.Region,
+		KeyPrefix:           cfg.KeyPrefix,
+		StorageClass:        cfg.StorageClass,
+		ObjectOwnership:     cfg.BucketObjectOwnership(),
+		Public:              cfg.Public,
+		SkipBucket:          cfg.SkipBucket,
+		NoDiscovery:         cfg.NoDiscovery,
+		LifecycleExpireDays: cfg.LifecycleExpireDays,
+		LifecyclePrefix:     cfg.LifecyclePrefix,
+		Thumbprints:         cfg.Thumbprints,
+		Audiences:           cfg.AcceptedAudiences(),
+		RoleName:            cfg.RoleName,
+		Tags:                cfg.Tags,
+		EndpointURL:         cfg.Endpoints.EndpointURL,
+		S3Endpoint:          cfg.Endpoints.S3Endpoint,
+		IAMEndpoint:         cfg.Endpoints.IAMEndpoint,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal checkpoint inputs: %w", err)
+	}
+
+	sum := sha256.Sum256(inputs)
+	return accountID + ":" + hex.EncodeToString(sum[:8]), nil
+}
+
+// checkpointer consults and updates the checkpoint of a configuration in the provisioning
+// state file. A nil checkpointer, used when checkpointing is disabled, reports no step as
+// completed and records nothing.
+type checkpointer struct {
+	filePath   string
+	state      *ProvisioningState
+	checkpoint *Checkpoint
+}
+
+// openCheckpointer returns the checkpointer of cfg in the provisioning state of its output
+// directory, or nil when cfg.NoCheckpoint is set.
+func openCheckpointer(cfg *Config, accountID string) (*checkpointer, error) {
+	if cfg.NoCheckpoint {
+		return nil, nil
+	}
+
+	state, err := ReadProvisioningState(cfg.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+	key, err := checkpointKey(cfg, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint, ok := state.Checkpoints[key]
+	if ok {
+		slog.Info("Resuming from provisioning state.", slog.String("file", filepath.Join(cfg.OutputDir, ProvisioningStateFileName)),
+			slog.String("checkpoint", key), slog.Time("updatedAt", checkpoint.UpdatedAt))
+	} else {
+		checkpoint = &Checkpoint{Issuer: cfg.Issuer()}
+		if !cfg.SkipBucket {
+			checkpoint.BucketName = cfg.BucketName
+		}
+		state.Checkpoints[key] = checkpoint
+	}
+
+	return &checkpointer{filePath: cfg.OutputDir, state: state, checkpoint: checkpoint}, nil
+}
+
+// bucketCreated reports whether the bucket was created by a previous run.
+func (c *checkpointer) bucketCreated() bool {
+	return c != nil && c.checkpoint.BucketCreated
+}
+
+// objectUploaded reports whether the object was uploaded by a previous run with this body.
+func (c *checkpointer) objectUploaded(objectKey string, body []byte) bool {
+	return c != nil && c.checkpoint.UploadedObjects[objectKey] == sha256Hex(body)
+}
+
+// lifecycleRulePut reports whether the lifecycle rule was put by a previous run.
+func (c *checkpointer) lifecycleRulePut() bool {
+	return c != nil && c.checkpoint.LifecycleRule
+}
+
+// providerCreated reports whether the IAM OIDC provider was created by a previous run.
+func (c *checkpointer) providerCreated() bool {
+	return c != nil && c.checkpoint.ProviderARN != ""
+}
+
+// roleCreated reports whether the IAM role was created by a previous run with this trust policy.
+func (c *checkpointer) roleCreated(trustPolicy []byte) bool {
+	return c != nil && c.checkpoint.RoleARN != "" && c.checkpoint.TrustPolicySHA256 == sha256Hex(trustPolicy)
+}
+
+// record applies update to the checkpoint and writes the provisioning state. Failing to write
+// the state is only logged, as the next run then repeats the step, which is idempotent.
+func (c *checkpointer) record(update func(checkpoint *Checkpoint)) {
+	if c == nil {
+		return
+	}
+
+	update(c.checkpoint)
+	c.checkpoint.UpdatedAt = time.Now().UTC()
+
+	data, err := json.MarshalIndent(c.state, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(c.filePath, ProvisioningStateFileName), data, 0644)
+	}
+	if err != nil {
+		slog.Warn("Failed to write provisioning state, the next run repeats this step.", slog.Any("error", err))
+	}
+}
+
+// sha256Hex returns the hex-encoded SHA-256 of data.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,175 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newCheckpointTestConfig(t *testing.T) *Config {
+	t.Helper()
+
+	return &Config{OutputDir: t.TempDir(), BucketName: "my-oidc-bucket", Region: "eu-west-1", RoleName: "ci"}
+}
+
+func TestCheckpointerResumesCompletedSteps(t *testing.T) {
+	cfg := newCheckpointTestConfig(t)
+	jwks, trustPolicy := []byte(`{"keys":[]}`), []byte(`{"Version":"2012-10-17"}`)
+
+	checkpoint, err := openCheckpointer(cfg, "123456789012")
+	if err != nil {
+		t.Fatalf("openCheckpointer: %v", err)
+	}
+	if checkpoint.bucketCreated() || checkpoint.objectUploaded(JWKSObjectKey, jwks) || checkpoint.providerCreated() {
+		t.Fatal("a fresh checkpoint reports completed steps")
+	}
+
+	// The run stops after the provider is created, before the role
+	checkpoint.record(func(c *Checkpoint) { c.BucketCreated = true })
+	checkpoint.record(func(c *Checkpoint) {
+		c.UploadedObjects = map[string]string{JWKSObjectKey: sha256Hex(jwks)}
+	})
+	checkpoint.record(func(c *Checkpoint) { c.ProviderARN = "arn:aws:iam::123456789012:oidc-provider/example.com" })
+
+	resumed, err := openCheckpointer(cfg, "123456789012")
+	if err != nil {
+		t.Fatalf("openCheckpointer: %v", err)
+	}
+	if !resumed.bucketCreated() {
+		t.Error("the bucket creation is not skipped")
+	}
+	if !resumed.objectUploaded(JWKSObjectKey, jwks) {
+		t.Error("the upload of the unchanged JWKS is not skipped")
+	}
+	if resumed.objectUploaded(JWKSObjectKey, []byte(`{"keys":[{}]}`)) {
+		t.Error("the upload of the changed JWKS is skipped")
+	}
+	if !resumed.providerCreated() {
+		t.Error("the provider creation is not skipped")
+	}
+	if resumed.lifecycleRulePut() || resumed.roleCreated(trustPolicy) {
+		t.Error("steps that did not complete are skipped")
+	}
+
+	resumed.record(func(c *Checkpoint) {
+		c.RoleARN = "arn:aws:iam::123456789012:role/ci"
+		c.TrustPolicySHA256 = sha256Hex(trustPolicy)
+	})
+	resumed, err = openCheckpointer(cfg, "123456789012")
+	if err != nil {
+		t.Fatalf("openCheckpointer: %v", err)
+	}
+	if !resumed.roleCreated(trustPolicy) {
+		t.Error("the role creation with the same trust policy is not skipped")
+	}
+	if resumed.roleCreated([]byte(`{"Version":"2012-10-17","Statement":[]}`)) {
+		t.Error("the role update with a changed trust policy is skipped")
+	}
+}
+
+func TestCheckpointerDisabled(t *testing.T) {
+	cfg := newCheckpointTestConfig(t)
+	cfg.NoCheckpoint = true
+
+	checkpoint, err := openCheckpointer(cfg, "123456789012")
+	if err != nil {
+		t.Fatalf("openCheckpointer: %v", err)
+	}
+	if checkpoint != nil {
+		t.Fatal("openCheckpointer returned a checkpointer with NoCheckpoint set")
+	}
+	checkpoint.record(func(c *Checkpoint) { c.BucketCreated = true })
+	if checkpoint.bucketCreated() {
+		t.Error("a disabled checkpointer reports completed steps")
+	}
+	if _, err := os.Stat(filepath.Join(cfg.OutputDir, ProvisioningStateFileName)); !os.IsNotExist(err) {
+		t.Error("a disabled checkpointer wrote the provisioning state")
+	}
+}
+
+func TestCheckpointKeyInvalidation(t *testing.T) {
+	base := newCheckpointTestConfig(t)
+	baseKey, err := checkpointKey(base, "123456789012")
+	if err != nil {
+		t.Fatalf("checkpointKey: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		accountID  string
+		update     func(cfg *Config)
+		wantSameAs bool
+	}{
+		{name: "unchanged", update: func(*Config) {}, wantSameAs: true},
+		{name: "JWT options", update: func(cfg *Config) { cfg.JWT.Subject = "other" }, wantSameAs: true},
+		{name: "account", accountID: "210987654321", update: func(*Config) {}},
+		{name: "bucket", update: func(cfg *Config) { cfg.BucketName = "other-bucket" }},
+		{name: "region", update: func(cfg *Config) { cfg.Region = "us-east-1" }},
+		{name: "key prefix", update: func(cfg *Config) { cfg.KeyPrefix = "tenant" }},
+		{name: "audiences", update: func(cfg *Config) { cfg.Audiences = []string{"my-client"} }},
+		{name: "role", update: func(cfg *Config) { cfg.RoleName = "other" }},
+		{name: "tags", update: func(cfg *Config) { cfg.Tags = map[string]string{"team": "platform"} }},
+		{name: "public", update: func(cfg *Config) { cfg.Public = true }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := *base
+			tt.update(&cfg)
+			accountID := tt.accountID
+			if accountID == "" {
+				accountID = "123456789012"
+			}
+
+			key, err := checkpointKey(&cfg, accountID)
+			if err != nil {
+				t.Fatalf("checkpointKey: %v", err)
+			}
+			if !strings.HasPrefix(key, accountID+":") {
+				t.Errorf("key = %q, want the account ID prefix", key)
+			}
+			if (key == baseKey) != tt.wantSameAs {
+				t.Errorf("key = %q, base key = %q, want same %t", key, baseKey, tt.wantSameAs)
+			}
+		})
+	}
+}
+
+func TestCheckpointerStartsFreshWhenInputsChange(t *testing.T) {
+	cfg := newCheckpointTestConfig(t)
+	checkpoint, err := openCheckpointer(cfg, "123456789012")
+	if err != nil {
+		t.Fatalf("openCheckpointer: %v", err)
+	}
+	checkpoint.record(func(c *Checkpoint) { c.BucketCreated = true })
+
+	cfg.BucketName = "other-bucket"
+	changed, err := openCheckpointer(cfg, "123456789012")
+	if err != nil {
+		t.Fatalf("openCheckpointer: %v", err)
+	}
+	if changed.bucketCreated() {
+		t.Error("the bucket of the previous configuration is reported as created")
+	}
+	changed.record(func(c *Checkpoint) {})
+
+	state, err := ReadProvisioningState(cfg.OutputDir)
+	if err != nil {
+		t.Fatalf("ReadProvisioningState: %v", err)
+	}
+	if len(state.Checkpoints) != 2 {
+		t.Errorf("state has %d checkpoints, want one per configuration", len(state.Checkpoints))
+	}
+}
+
+func TestReadProvisioningStateUnsupportedVersion(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ProvisioningStateFileName), []byte(`{"version":2,"checkpoints":{}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadProvisioningState(dir); err == nil || !strings.Contains(err.Error(), "unsupported provisioning state version 2") {
+		t.Fatalf("err = %v, want the unsupported version error", err)
+	}
+}
@@ -0,0 +1,196 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	awsProvider "github.com/chuhaoyuu/aws-oidc-sts/pkg/providers/aws"
+)
+
+// Config holds the inputs used to provision an identity provider.
+type Config struct {
+	// OutputDir is the directory where the generated files are written.
+	OutputDir string
+	// BucketName is the name of the S3 bucket hosting the identity provider documents.
+	BucketName string
+	// Region is the AWS region of the created resources.
+	Region string
+	// KeyPrefix is the prefix of the keys of the uploaded objects, which then also is the path
+	// of the issuer URL. Leading, trailing and duplicate slashes are ignored.
+	KeyPrefix string
+	// StorageClass is the S3 storage class of the uploaded documents.
+	StorageClass string
+	// LifecycleExpireDays makes S3 expire the objects under LifecyclePrefix after this many
+	// days, e.g. rotation archives. No lifecycle rule is put when zero.
+	LifecycleExpireDays int
+	// LifecyclePrefix is the prefix, under KeyPrefix, of the objects expired after
+	// LifecycleExpireDays. Defaults to ArchiveObjectPrefix.
+	LifecyclePrefix string
+	// ObjectOwnership is the object ownership of the created S3 bucket. Defaults to
+	// BucketOwnerEnforced, or to BucketOwnerPreferred when Public is set.
+	ObjectOwnership string
+	// Public uploads the documents with the public-read canned ACL, for buckets whose
+	// documents are not made public otherwise, e.g. by a bucket policy or a CDN.
+	Public bool
+	// SkipBucket skips all S3 work and provisions IAM against an issuer hosted elsewhere.
+	SkipBucket bool
+	// IssuerOverride is the URL of an issuer hosted outside of S3, used with SkipBucket.
+	IssuerOverride string
+	// JWKSURIOverride is the JWKS URL of an issuer hosted outside of S3, used with SkipBucket.
+	JWKSURIOverride string
+	// Thumbprints are the IAM OIDC provider thumbprints. When empty, they are fetched from the JWKS host.
+	Thumbprints []string
+	// Offline skips dialing the JWKS host to check the supplied Thumbprints against the
+	// certificate chain it presents.
+	Offline bool
+	// NoDiscovery skips the generation, upload and checks of the openid-configuration, for
+	// discovery documents managed by another system. The JWKS is still handled.
+	NoDiscovery bool
+	// DiscoveryYAML also writes the openid-configuration as YAML for review. It is never uploaded.
+	DiscoveryYAML bool
+	// Audiences are the client IDs of the IAM OIDC provider, accepted in the "aud" claim by the
+	// role trust policy. Defaults to JWTAudience when empty.
+	Audiences []string
+	// RoleName is the name of the IAM role to create. No role is created when empty.
+	RoleName string
+	// Tags are applied to the created S3 bucket, IAM OIDC provider and IAM role, besides the
+	// ManagedBy tag which is always set.
+	Tags map[string]string
+	// VerifyReachable waits until the uploaded documents are served by the issuer before
+	// creating the IAM OIDC provider.
+	VerifyReachable bool
+	// ReachableTimeout bounds the wait for the issuer documents to propagate, both with
+	// VerifyReachable and for an external issuer. A zero timeout makes a single attempt.
+	ReachableTimeout time.Duration
+	// WebIdentitySessionName is the role session name used with web identity credentials.
+	WebIdentitySessionName string
+	// Endpoints holds the AWS endpoint overrides. Its Region and WebIdentitySessionName are ignored.
+	Endpoints awsProvider.ClientOptions
+	// NoCheckpoint disables the provisioning state file, so that every step of the run calls
+	// AWS again, e.g. after resources were deleted outside of this tool.
+	NoCheckpoint bool
+	// Strict turns the warnings of the sanity checks into errors.
+	Strict bool
+	// AllowSourceIdentity allows sts:SetSourceIdentity in the generated trust policy.
+	AllowSourceIdentity bool
+	// SourceIdentityMatchesSubject requires the source identity to match the token subject.
+	SourceIdentityMatchesSubject bool
+	// SourceIPs restricts the generated trust policy to requests from these IP addresses or
+	// CIDR blocks, on top of the audience and subject conditions.
+	SourceIPs []string
+	// SourceVPCEs restricts the generated trust policy to requests through these VPC
+	// endpoints, on top of the audience and subject conditions.
+	SourceVPCEs []string
+	// JWKS holds the settings applied to the generated JWKS.
+	JWKS JWKSOptions
+	// JWT holds the settings applied to the generated JWT.
+	JWT JWTOptions
+}
+
+// Issuer returns the issuer URL of the identity provider, which is the URL of the
+// S3 bucket hosting the discovery document and the JWKS, or the external issuer when set.
+func (c *Config) Issuer() string {
+	if c.IssuerOverride != "" {
+		return strings.TrimSuffix(c.IssuerOverride, "/")
+	}
+	if prefix := awsProvider.JoinObjectKey(c.KeyPrefix); prefix != "" {
+		return awsProvider.ObjectURL(c.BucketName, c.Region, prefix)
+	}
+	return awsProvider.BucketURL(c.BucketName, c.Region)
+}
+
+// ObjectKey returns the key of the S3 object storing the document at the given .well-known
+// path, under KeyPrefix.
+func (c *Config) ObjectKey(key string) string {
+	return awsProvider.JoinObjectKey(c.KeyPrefix, key)
+}
+
+// JWKSURI returns the URL the JWKS is served from.
+func (c *Config) JWKSURI() string {
+	if c.JWKSURIOverride != "" {
+		return c.JWKSURIOverride
+	}
+	if c.SkipBucket {
+		return c.Issuer() + "/" + JWKSObjectKey
+	}
+	return awsProvider.ObjectURL(c.BucketName, c.Region, c.ObjectKey(JWKSObjectKey))
+}
+
+// LifecycleRulePrefix returns the prefix of the objects expired by the lifecycle rule, under
+// KeyPrefix and ending with a slash so that it never matches longer sibling names. It is an
+// error for the prefix to cover the .well-known documents, which must never expire.
+func (c *Config) LifecycleRulePrefix() (string, error) {
+	lifecyclePrefix := c.LifecyclePrefix
+	if lifecyclePrefix == "" {
+		lifecyclePrefix = ArchiveObjectPrefix
+	}
+
+	if awsProvider.JoinObjectKey(lifecyclePrefix) == "" {
+		return "", fmt.Errorf("lifecycle prefix %q would expire every object under the key prefix", lifecyclePrefix)
+	}
+
+	rulePrefix := c.ObjectKey(lifecyclePrefix) + "/"
+	for _, key := range []string{JWKSObjectKey, OpenIDConfigurationObjectKey} {
+		if strings.HasPrefix(c.ObjectKey(key), rulePrefix) {
+			return "", fmt.Errorf("lifecycle prefix %q would expire %s", lifecyclePrefix, c.ObjectKey(key))
+		}
+	}
+
+	return rulePrefix, nil
+}
+
+// BucketObjectOwnership returns the object ownership of the created S3 bucket: ObjectOwnership
+// when set, else BucketOwnerPreferred when Public is set, as object ACLs are disabled by the
+// default BucketOwnerEnforced ownership.
+func (c *Config) BucketObjectOwnership() string {
+	switch {
+	case c.ObjectOwnership != "":
+		return c.ObjectOwnership
+	case c.Public:
+		return string(types.ObjectOwnershipBucketOwnerPreferred)
+	default:
+		return string(types.ObjectOwnershipBucketOwnerEnforced)
+	}
+}
+
+// AcceptedAudiences returns the audiences accepted by the identity provider.
+func (c *Config) AcceptedAudiences() []string {
+	if len(c.Audiences) == 0 {
+		return []string{JWTAudience}
+	}
+	return c.Audiences
+}
+
+// polledJWKSURI returns the JWKS URL to poll directly when the discovery document is not
+// managed by this tool, or an empty string to follow the discovery document.
+func (c *Config) polledJWKSURI() string {
+	if c.NoDiscovery {
+		return c.JWKSURI()
+	}
+	return ""
+}
+
+// Subject returns the "sub" claim of the generated JWT, which is also the one trusted by the
+// role: JWT.Subject when set, otherwise the role name, so that CloudTrail events and trust
+// conditions name the workload, and JWTSubject when no role is created.
+func (c *Config) Subject() string {
+	switch {
+	case c.JWT.Subject != "":
+		return c.JWT.Subject
+	case c.RoleName != "":
+		return c.RoleName
+	default:
+		return JWTSubject
+	}
+}
+
+// ClientOptions returns the options used to configure the AWS SDK: the endpoint overrides and
+// shared files of Endpoints, with the Region and WebIdentitySessionName of the Config.
+func (c *Config) ClientOptions() awsProvider.ClientOptions {
+	opts := c.Endpoints
+	opts.Region = c.Region
+	opts.WebIdentitySessionName = c.WebIdentitySessionName
+	return opts
+}
@@ -0,0 +1,121 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	awsProvider "github.com/chuhaoyuu/aws-oidc-sts/pkg/providers/aws"
+)
+
+func TestClientOptionsSharedFiles(t *testing.T) {
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE",
+		"AWS_REGION", "AWS_DEFAULT_REGION", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN"} {
+		t.Setenv(name, "")
+	}
+
+	dir := t.TempDir()
+	credentialsFile := filepath.Join(dir, "credentials")
+	configFile := filepath.Join(dir, "config")
+	if err := os.WriteFile(credentialsFile, []byte("[default]\naws_access_key_id = AKIDFROMFILE\naws_secret_access_key = secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configFile, []byte("[default]\nregion = eu-west-3\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{
+		Region:                 "us-east-1",
+		WebIdentitySessionName: "session",
+		Endpoints: awsProvider.ClientOptions{
+			Region:          "ignored",
+			EndpointURL:     "http://localhost:4566",
+			CredentialsFile: credentialsFile,
+			ConfigFile:      configFile,
+		},
+	}
+	opts := cfg.ClientOptions()
+	if opts.CredentialsFile != credentialsFile || opts.ConfigFile != configFile {
+		t.Fatalf("shared files = %q, %q, want %q, %q", opts.CredentialsFile, opts.ConfigFile, credentialsFile, configFile)
+	}
+	if opts.Region != "us-east-1" || opts.WebIdentitySessionName != "session" || opts.EndpointURL != "http://localhost:4566" {
+		t.Fatalf("unexpected options %+v", opts)
+	}
+
+	// Without a region, the one of the config file is resolved, proving both files are loaded.
+	opts.Region = ""
+	awsCfg, err := awsProvider.LoadConfig(opts)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if awsCfg.Region != "eu-west-3" {
+		t.Errorf("region = %q, want the region of the config file", awsCfg.Region)
+	}
+	credentials, err := awsCfg.Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("Retrieve: %v", err)
+	}
+	if credentials.AccessKeyID != "AKIDFROMFILE" {
+		t.Errorf("access key ID = %q, want the one of the credentials file", credentials.AccessKeyID)
+	}
+}
+
+func TestConfigIssuerAndObjectKeyPrefixSlashes(t *testing.T) {
+	tests := []struct {
+		prefix     string
+		wantIssuer string
+		wantKey    string
+	}{
+		{prefix: "", wantIssuer: "https://my-bucket.s3.eu-west-1.amazonaws.com", wantKey: ".well-known/jwks.json"},
+		{prefix: "/", wantIssuer: "https://my-bucket.s3.eu-west-1.amazonaws.com", wantKey: ".well-known/jwks.json"},
+		{prefix: "tenant", wantIssuer: "https://my-bucket.s3.eu-west-1.amazonaws.com/tenant", wantKey: "tenant/.well-known/jwks.json"},
+		{prefix: "/tenant", wantIssuer: "https://my-bucket.s3.eu-west-1.amazonaws.com/tenant", wantKey: "tenant/.well-known/jwks.json"},
+		{prefix: "tenant/", wantIssuer: "https://my-bucket.s3.eu-west-1.amazonaws.com/tenant", wantKey: "tenant/.well-known/jwks.json"},
+		{prefix: "//team//tenant//", wantIssuer: "https://my-bucket.s3.eu-west-1.amazonaws.com/team/tenant", wantKey: "team/tenant/.well-known/jwks.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run("prefix="+tt.prefix, func(t *testing.T) {
+			cfg := &Config{BucketName: "my-bucket", Region: "eu-west-1", KeyPrefix: tt.prefix}
+			if got := cfg.Issuer(); got != tt.wantIssuer {
+				t.Errorf("Issuer() = %q, want %q", got, tt.wantIssuer)
+			}
+			if got := cfg.ObjectKey(JWKSObjectKey); got != tt.wantKey {
+				t.Errorf("ObjectKey() = %q, want %q", got, tt.wantKey)
+			}
+			if got := cfg.ObjectKey("/" + JWKSObjectKey); got != tt.wantKey {
+				t.Errorf("ObjectKey() of a key with a leading slash = %q, want %q", got, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestConfigBucketObjectOwnership(t *testing.T) {
+	tests := []struct {
+		name      string
+		ownership string
+		public    bool
+		want      string
+		wantValid bool
+	}{
+		{name: "private default", want: "BucketOwnerEnforced", wantValid: true},
+		{name: "public default", public: true, want: "BucketOwnerPreferred", wantValid: true},
+		{name: "private explicit", ownership: "ObjectWriter", want: "ObjectWriter", wantValid: true},
+		{name: "public explicit", ownership: "ObjectWriter", public: true, want: "ObjectWriter", wantValid: true},
+		{name: "public with ACLs disabled", ownership: "BucketOwnerEnforced", public: true, want: "BucketOwnerEnforced"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{ObjectOwnership: tt.ownership, Public: tt.public}
+			got := cfg.BucketObjectOwnership()
+			if got != tt.want {
+				t.Errorf("BucketObjectOwnership() = %q, want %q", got, tt.want)
+			}
+			if err := awsProvider.ValidateObjectOwnership(got, cfg.Public); (err == nil) != tt.wantValid {
+				t.Errorf("ValidateObjectOwnership() = %v, want valid %t", err, tt.wantValid)
+			}
+		})
+	}
+}
@@ -1,12 +1,67 @@
 package providers
 
+import "time"
+
+const (
+	// DefaultJWKSMaxBytes and DefaultJWKSMaxKeys are conservative soft limits for the
+	// generated JWKS, well below the size at which STS fails to fetch the keys.
+	DefaultJWKSMaxBytes = 16 * 1024
+	DefaultJWKSMaxKeys  = 10
+)
+
+const (
+	// DefaultRSAKeySize is the size of the generated RSA keys. Keys smaller than
+	// DefaultMinKeySize are rejected unless a different minimum is configured.
+	DefaultRSAKeySize = 4096
+	DefaultMinKeySize = 2048
+)
+
+// DefaultReachableTimeout is the default time spent waiting for the issuer documents to
+// propagate after their upload.
+const DefaultReachableTimeout = 5 * time.Minute
+
+const (
+	// JWTLifetime is the validity of a JWT without an explicit expiration time. Tokens
+	// expiring after JWTFarFutureThreshold are reported as likely mistakes.
+	JWTLifetime           = 24 * time.Hour
+	JWTFarFutureThreshold = 7 * 24 * time.Hour
+)
+
 const (
-	RSAPrivateKeyFile = "private-key.pem"
-	RSAPublicKeyFile  = "public-key.pem"
-	TLSDirName        = "tls"
-	JWTIssuer         = "https://example.com"
-	JWTAudience       = "sts.amazonaws.com"
-	JWTSubject        = "aws-oidc-sts"
-	JWKSFileName      = "jwks.json"
-	JWKSUsage         = "sig"
+	RSAPrivateKeyFile               = "private-key.pem"
+	RSAPublicKeyFile                = "public-key.pem"
+	CertificateFile                 = "certificate.pem"
+	CertificateValidity             = 10 * 365 * 24 * time.Hour
+	TLSDirName                      = "tls"
+	JWTIssuer                       = "https://example.com"
+	JWTAudience                     = "sts.amazonaws.com"
+	JWTType                         = "JWT"
+	JWTSubject                      = "aws-oidc-sts"
+	JWKSFileName                    = "jwks.json"
+	JWKSWrappedFileName             = "jwks-wrapped.json"
+	JWTFileName                     = "token.jwt"
+	IssuerFileName                  = "issuer"
+	JWKSUsage                       = "sig"
+	X5TAlgorithmSHA1                = "sha1"
+	X5TAlgorithmSHA256              = "sha256"
+	X5TAlgorithmBoth                = "both"
+	KeyIDHashSHA1                   = "sha1"
+	KeyIDHashSHA256                 = "sha256"
+	JWSFormatCompact                = "compact"
+	JWSFormatJSON                   = "json"
+	TrustPolicyFileName             = "trust-policy.json"
+	OpenIDConfigurationFileName     = "openid-configuration"
+	OpenIDConfigurationYAMLFileName = "openid-configuration.yaml"
+	JWKSObjectKey                   = ".well-known/jwks.json"
+	OpenIDConfigurationObjectKey    = ".well-known/openid-configuration"
+	ArchiveObjectPrefix             = "archive"
+	NextPrivateKeyFile              = "next-private-key.pem"
+	NextPublicKeyFile               = "next-public-key.pem"
+	PreviousPrivateKeyFile          = "previous-private-key.pem"
+	PreviousPublicKeyFile           = "previous-public-key.pem"
+	RotationStateFileName           = "rotation-state.json"
+	ProvisioningStateFileName       = ".aws-oidc-sts-state.json"
+	ActiveKeyFileName               = "active-kid"
+	KeyLayoutFlat                   = "flat"
+	KeyLayoutNested                 = "nested"
 )
@@ -0,0 +1,95 @@
+package providers
+
+// Creates a self-signed certificate for the RSA key pair used with AWS OIDC STS
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CreateSelfSignedCertificate creates a self-signed X.509 certificate for the RSA private key
+// stored in the specified directory and writes it PEM-encoded to the certificate file.
+// If the certificate file already exists for the key, the function skips the creation. A
+// certificate of another key, e.g. left over after the key pair was regenerated, is replaced.
+//
+// The certificate is what the x5t and x5t#S256 thumbprints of the JWKS are computed from.
+//
+// Parameters:
+//   - keyPairFilePath: The base directory where the RSA key pair is stored.
+//
+// Returns:
+//   - An error if the private key cannot be parsed or the certificate cannot be created or written.
+//   - nil if the certificate is created successfully or already exists.
+func CreateSelfSignedCertificate(keyPairFilePath string) error {
+	return createSelfSignedCertificate(keyPairFilePath, nil)
+}
+
+// createSelfSignedCertificate creates the self-signed certificate of the signer, or of the
+// private key stored in the specified directory when signer is nil.
+func createSelfSignedCertificate(keyPairFilePath string, signer crypto.Signer) error {
+	dir, err := keyPairDir(keyPairFilePath)
+	if err != nil {
+		return err
+	}
+	if signer == nil {
+		privateKey, err := ParsePrivateKeyFromFile(keyPairFilePath)
+		if err != nil {
+			return fmt.Errorf("failed to parse private key: %w", err)
+		}
+		signer = privateKey
+	}
+
+	certificateFile := filepath.Join(dir, CertificateFile)
+	if _, err := os.Stat(certificateFile); err == nil {
+		certificate, err := ParseCertificateFromFile(keyPairFilePath)
+		if err != nil {
+			return fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		if publicKey, ok := certificate.PublicKey.(*rsa.PublicKey); ok && publicKey.Equal(signer.Public()) {
+			slog.Debug("Certificate file already exists, skipping creation.", slog.String("file", certificateFile))
+			return nil
+		}
+		slog.Warn("Certificate does not match the key pair, creating a new one.", slog.String("file", certificateFile))
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("failed to generate certificate serial number: %w", err)
+	}
+
+	notBefore := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: JWTSubject},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(CertificateValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	certificateBytes, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	certificatePEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: certificateBytes,
+	})
+
+	slog.Info("Writing certificate to", slog.String("file", certificateFile))
+	if err := writeFileAtomic(certificateFile, certificatePEM, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate to file: %w", err)
+	}
+
+	return nil
+}
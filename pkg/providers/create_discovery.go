@@ -0,0 +1,141 @@
+package providers
+
+// Creates the OpenID Connect discovery document for use with AWS OIDC STS
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	awsProvider "github.com/chuhaoyuu/aws-oidc-sts/pkg/providers/aws"
+	"gopkg.in/yaml.v3"
+)
+
+// OpenIDConfiguration represents the OpenID Connect discovery document served under
+// the issuer's /.well-known/openid-configuration path.
+type OpenIDConfiguration struct {
+	Issuer                           string   `json:"issuer" yaml:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri" yaml:"jwks_uri"`
+	ResponseTypesSupported           []string `json:"response_types_supported" yaml:"response_types_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported" yaml:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported" yaml:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                  []string `json:"claims_supported" yaml:"claims_supported"`
+}
+
+// CreateOpenIDConfiguration generates the OpenID Connect discovery document for the given
+// issuer and writes it to the openid-configuration file in the specified directory.
+//
+// The jwks_uri of the document points at the JWKS published under the issuer's
+// .well-known path, which is where CreateIdentityProvider uploads the JWKS.
+//
+// Parameters:
+//   - filePath: The base directory where the discovery document is written.
+//   - issuer: The issuer URL of the identity provider.
+//
+// Returns:
+//   - *OpenIDConfiguration: The generated discovery document.
+//   - error: An error if marshaling or writing the document fails.
+func CreateOpenIDConfiguration(filePath, issuer string) (*OpenIDConfiguration, error) {
+	discovery := &OpenIDConfiguration{
+		Issuer:                           issuer,
+		JWKSURI:                          issuer + "/" + JWKSObjectKey,
+		ResponseTypesSupported:           []string{"id_token"},
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: []string{"RS256"},
+		ClaimsSupported:                  []string{"aud", "exp", "iat", "iss", "nbf", "sub"},
+	}
+
+	discoveryJSON, err := json.MarshalIndent(discovery, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal openid-configuration: %w", err)
+	}
+
+	discoveryFilePath := filepath.Join(filePath, TLSDirName, OpenIDConfigurationFileName)
+	if err := writeFileAtomic(discoveryFilePath, discoveryJSON, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write openid-configuration to file: %w", err)
+	}
+
+	return discovery, nil
+}
+
+// WriteOpenIDConfigurationYAML writes the discovery document as YAML next to the JSON document,
+// for human review only: the document served by the issuer must stay JSON, as required by the
+// OpenID Connect Discovery specification, so the YAML file is never uploaded.
+func WriteOpenIDConfigurationYAML(filePath string, discovery *OpenIDConfiguration) error {
+	discoveryYAML, err := yaml.Marshal(discovery)
+	if err != nil {
+		return fmt.Errorf("failed to marshal openid-configuration as YAML: %w", err)
+	}
+
+	discoveryFilePath := filepath.Join(filePath, TLSDirName, OpenIDConfigurationYAMLFileName)
+	if err := writeFileAtomic(discoveryFilePath, discoveryYAML, 0644); err != nil {
+		return fmt.Errorf("failed to write openid-configuration YAML to file: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyOpenIDConfiguration checks that the discovery document served by the issuer, as
+// returned by FetchOpenIDConfiguration, is consistent with where the identity provider
+// documents are uploaded: the issuer must match the configured issuer and the jwks_uri must
+// point at the S3 object the JWKS is uploaded to.
+//
+// The document generated by CreateOpenIDConfiguration always is, but the one served may not
+// be, e.g. when a stale document is cached or another document is served under the issuer.
+// A jwks_uri that does not resolve to the uploaded JWKS is a common cause of STS failing to
+// fetch the signing keys, so the check is meant to run before the IAM OIDC provider is created.
+func VerifyOpenIDConfiguration(cfg *Config, discovery *OpenIDConfiguration) error {
+	if strings.TrimSuffix(discovery.Issuer, "/") != cfg.Issuer() {
+		return fmt.Errorf("issuer %q in openid-configuration does not match the configured issuer %q",
+			discovery.Issuer, cfg.Issuer())
+	}
+
+	jwksURL := awsProvider.ObjectURL(cfg.BucketName, cfg.Region, cfg.ObjectKey(JWKSObjectKey))
+	if discovery.JWKSURI != jwksURL {
+		return fmt.Errorf("jwks_uri %q in openid-configuration does not match the JWKS upload location %q",
+			discovery.JWKSURI, jwksURL)
+	}
+
+	return nil
+}
+
+// FetchOpenIDConfiguration retrieves the discovery document served under the issuer's
+// .well-known path and validates it: the document must parse, its issuer must equal the
+// requested issuer and it must advertise an HTTPS jwks_uri.
+//
+// Parameters:
+//   - issuer: The issuer URL of the identity provider.
+//
+// Returns:
+//   - *OpenIDConfiguration: The discovery document served by the issuer.
+//   - error: An error if the document cannot be fetched, parsed or is invalid.
+func FetchOpenIDConfiguration(issuer string) (*OpenIDConfiguration, error) {
+	discoveryURL := strings.TrimSuffix(issuer, "/") + "/" + OpenIDConfigurationObjectKey
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(discoveryURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", discoveryURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPStatusError{URL: discoveryURL, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	discovery := &OpenIDConfiguration{}
+	if err := json.NewDecoder(resp.Body).Decode(discovery); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", discoveryURL, err)
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return nil, fmt.Errorf("issuer %q in %s does not match the issuer %q", discovery.Issuer, discoveryURL, issuer)
+	}
+	if !strings.HasPrefix(discovery.JWKSURI, "https://") {
+		return nil, fmt.Errorf("jwks_uri %q in %s must be an https URL", discovery.JWKSURI, discoveryURL)
+	}
+
+	return discovery, nil
+}
@@ -0,0 +1,50 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyOpenIDConfiguration(t *testing.T) {
+	cfg := &Config{OutputDir: newTestKeyPairDir(t), BucketName: "my-oidc-bucket", Region: "eu-west-1", KeyPrefix: "tenant"}
+	generated, err := CreateOpenIDConfiguration(cfg.OutputDir, cfg.Issuer())
+	if err != nil {
+		t.Fatalf("CreateOpenIDConfiguration: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		served  OpenIDConfiguration
+		wantErr string
+	}{
+		{name: "generated document", served: *generated},
+		{name: "issuer with trailing slash", served: OpenIDConfiguration{Issuer: cfg.Issuer() + "/", JWKSURI: generated.JWKSURI}},
+		{
+			name:    "other issuer",
+			served:  OpenIDConfiguration{Issuer: "https://my-oidc-bucket.s3.eu-west-1.amazonaws.com", JWKSURI: generated.JWKSURI},
+			wantErr: "does not match the configured issuer",
+		},
+		{
+			name: "jwks_uri outside the key prefix",
+			served: OpenIDConfiguration{Issuer: cfg.Issuer(),
+				JWKSURI: "https://my-oidc-bucket.s3.eu-west-1.amazonaws.com/.well-known/jwks.json"},
+			wantErr: `jwks_uri "https://my-oidc-bucket.s3.eu-west-1.amazonaws.com/.well-known/jwks.json" in openid-configuration ` +
+				`does not match the JWKS upload location "https://my-oidc-bucket.s3.eu-west-1.amazonaws.com/tenant/.well-known/jwks.json"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyOpenIDConfiguration(cfg, &tt.served)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("VerifyOpenIDConfiguration: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
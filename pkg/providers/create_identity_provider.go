@@ -0,0 +1,401 @@
+package providers
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsProvider "github.com/chuhaoyuu/aws-oidc-sts/pkg/providers/aws"
+)
+
+// CreateIdentityProvider provisions an OIDC identity provider trusted by AWS STS.
+//
+// cfg is first checked with ValidateConfig, which reports every invalid input at once.
+// The function then performs the following steps:
+//  1. Creates the JWKS from the key pair in the output directory.
+//  2. Creates the openid-configuration, unless NoDiscovery is set.
+//  3. Signs a JWT for the issuer, warning when neither its audiences nor the client IDs
+//     include the STS audience (an error when Strict is set).
+//  4. Creates the S3 bucket and uploads the JWKS and openid-configuration, unless SkipBucket is set,
+//     and makes the objects under the lifecycle prefix expire when LifecycleExpireDays is set.
+//  5. Waits until the uploaded documents are reachable when VerifyReachable is set, and checks
+//     the jwks_uri of the served openid-configuration points at the uploaded JWKS. Unless
+//     Public is set, the objects are private and a 403 fails at once instead of being retried.
+//  6. Creates the IAM OIDC provider for the issuer.
+//  7. Writes the role trust policy and creates the IAM role when RoleName is set.
+//
+// Unless NoCheckpoint is set, the AWS steps completed are recorded in the provisioning state
+// file of the output directory (see ProvisioningState), and skipped by the next runs of the
+// same configuration in the same account: a run failing midway resumes where it stopped. The
+// documents are uploaded again when they change, and the role is updated again when its trust
+// policy changes. The local steps always run.
+//
+// With SkipBucket, the JWKS is hosted and signed elsewhere: steps 1 to 5 are replaced by
+// checking the external issuer serves a valid discovery document and JWKS, and no key pair
+// is read. The thumbprints are still checked when creating the IAM OIDC provider.
+//
+// It returns the identifiers of the provisioned resources.
+func CreateIdentityProvider(cfg *Config) (*IdentityProviderResult, error) {
+	if err := ValidateConfig(cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	var keyID string
+	var signedJWT []byte
+	if cfg.SkipBucket {
+		// The JWKS is hosted elsewhere and signed by its owner, only make sure the external
+		// issuer is usable
+		if err := verifyExternalIssuer(cfg); err != nil {
+			return nil, fmt.Errorf("invalid external issuer: %w", err)
+		}
+		if err := checkSTSAudience(nil, cfg.AcceptedAudiences(), cfg.Strict); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Join(cfg.OutputDir, TLSDirName), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory for the trust policy: %w", err)
+		}
+	} else {
+		var err error
+		if keyID, signedJWT, err = createIssuerDocuments(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	awsCfg, err := awsProvider.AwsClient(cfg.ClientOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS client: %w", err)
+	}
+
+	accountID, err := awsProvider.AccountID(awsCfg, cfg.ClientOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AWS account ID: %w", err)
+	}
+
+	checkpoint, err := openCheckpointer(cfg, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !cfg.SkipBucket {
+		var lifecyclePrefix string
+		if cfg.LifecycleExpireDays > 0 {
+			if lifecyclePrefix, err = cfg.LifecycleRulePrefix(); err != nil {
+				return nil, err
+			}
+		}
+
+		s3Service := &awsProvider.S3Service{
+			Client:          awsProvider.NewS3Client(awsCfg, cfg.ClientOptions()),
+			BucketName:      cfg.BucketName,
+			Region:          cfg.Region,
+			StorageClass:    cfg.StorageClass,
+			ObjectOwnership: cfg.BucketObjectOwnership(),
+			PublicRead:      cfg.Public,
+			Tags:            cfg.Tags,
+		}
+		if checkpoint.bucketCreated() {
+			slog.Info("Skipping S3 bucket creation, already completed.", slog.String("bucket", cfg.BucketName))
+		} else {
+			if err := awsProvider.Create(awsProvider.Builder(s3Service)); err != nil {
+				return nil, fmt.Errorf("failed to create S3 bucket: %w", err)
+			}
+			checkpoint.record(func(c *Checkpoint) { c.BucketCreated = true })
+		}
+
+		if err := uploadIdentityProviderDocuments(cfg, s3Service, checkpoint); err != nil {
+			return nil, err
+		}
+
+		if cfg.LifecycleExpireDays > 0 {
+			if checkpoint.lifecycleRulePut() {
+				slog.Info("Skipping lifecycle rule, already completed.", slog.String("bucket", cfg.BucketName))
+			} else {
+				if err := s3Service.PutLifecycleRule(lifecyclePrefix, cfg.LifecycleExpireDays); err != nil {
+					return nil, fmt.Errorf("failed to put lifecycle rule: %w", err)
+				}
+				checkpoint.record(func(c *Checkpoint) { c.LifecycleRule = true })
+			}
+		}
+
+		if cfg.VerifyReachable {
+			if !cfg.Public {
+				slog.Warn("Documents uploaded without the public-read ACL, they are only reachable when a bucket policy allows public reads.",
+					slog.String("bucket", cfg.BucketName))
+			}
+			discovery, err := waitUntilReachable(cfg.Issuer(), cfg.polledJWKSURI(), cfg.ReachableTimeout, cfg.Public)
+			if err != nil {
+				return nil, fmt.Errorf("issuer documents not reachable: %w", err)
+			}
+			// Make sure the served openid-configuration points at the uploaded JWKS
+			if discovery != nil {
+				if err := VerifyOpenIDConfiguration(cfg, discovery); err != nil {
+					return nil, fmt.Errorf("inconsistent openid-configuration: %w", err)
+				}
+			}
+		}
+	}
+
+	providerARN := awsProvider.OIDCProviderARN(accountID, cfg.Issuer())
+	if checkpoint.providerCreated() {
+		slog.Info("Skipping IAM OIDC provider creation, already completed.", slog.String("arn", providerARN))
+	} else {
+		if err := createOIDCProvider(cfg, awsCfg); err != nil {
+			return nil, err
+		}
+		checkpoint.record(func(c *Checkpoint) { c.ProviderARN = providerARN })
+	}
+
+	result := &IdentityProviderResult{
+		Issuer:          cfg.Issuer(),
+		JWKSURI:         cfg.JWKSURI(),
+		KeyID:           keyID,
+		Subject:         cfg.Subject(),
+		ProviderARN:     providerARN,
+		Audiences:       cfg.AcceptedAudiences(),
+		TrustPolicyFile: filepath.Join(cfg.OutputDir, TLSDirName, TrustPolicyFileName),
+	}
+	if signedJWT != nil {
+		if result.TokenExpiration, err = TokenExpiration(signedJWT); err != nil {
+			return nil, err
+		}
+	}
+
+	trustPolicy, err := CreateTrustPolicy(cfg, result.ProviderARN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trust policy: %w", err)
+	}
+
+	if cfg.RoleName != "" {
+		if checkpoint.roleCreated(trustPolicy) {
+			result.RoleARN = awsProvider.RoleARN(accountID, cfg.RoleName)
+			slog.Info("Skipping IAM role creation, already completed.", slog.String("arn", result.RoleARN))
+		} else {
+			if result.RoleARN, err = createRole(cfg, awsCfg, accountID, trustPolicy); err != nil {
+				return nil, err
+			}
+			checkpoint.record(func(c *Checkpoint) {
+				c.RoleARN = result.RoleARN
+				c.TrustPolicySHA256 = sha256Hex(trustPolicy)
+			})
+		}
+		slog.Info("Role ready to be assumed with web identity", "RoleArn", result.RoleARN)
+	}
+
+	return result, nil
+}
+
+// createIssuerDocuments creates the JWKS and, unless NoDiscovery is set, the
+// openid-configuration of the issuer hosted in S3 from the key pair in the output directory,
+// and signs a JWT for the issuer.
+//
+// Returns:
+//   - string: The key ID (kid) of the signing key.
+//   - []byte: The signed JWT.
+//   - error: An error if a document cannot be created or the JWT audiences are invalid.
+func createIssuerDocuments(cfg *Config) (string, []byte, error) {
+	jwksOptions := cfg.JWKS
+	jwksOptions.Strict = cfg.Strict
+	jwkKey, err := CreateJSONWebKeySet(cfg.OutputDir, jwksOptions)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create JSON Web Key Set: %w", err)
+	}
+
+	if !cfg.NoDiscovery {
+		discovery, err := CreateOpenIDConfiguration(cfg.OutputDir, cfg.Issuer())
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to create openid-configuration: %w", err)
+		}
+		if cfg.DiscoveryYAML {
+			if err := WriteOpenIDConfigurationYAML(cfg.OutputDir, discovery); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+
+	jwtOptions := cfg.JWT
+	jwtOptions.Issuer = cfg.Issuer()
+	jwtOptions.Subject = cfg.Subject()
+	if len(jwtOptions.Audiences) == 0 {
+		jwtOptions.Audiences = cfg.AcceptedAudiences()
+	}
+	if err := awsProvider.ValidateAudiences(jwtOptions.Audiences, cfg.AcceptedAudiences()); err != nil {
+		return "", nil, fmt.Errorf("invalid JWT audiences: %w", err)
+	}
+	if err := checkSTSAudience(jwtOptions.Audiences, cfg.AcceptedAudiences(), cfg.Strict); err != nil {
+		return "", nil, err
+	}
+	if cfg.JWKS.Signer != nil {
+		jwtOptions.Signer = cfg.JWKS.Signer
+	}
+	signedJWT, err := CreateJWT(jwkKey, jwtOptions)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create JWT: %w", err)
+	}
+
+	slog.Info("JWT created successfully", "JWT", string(signedJWT), "Subject", jwtOptions.Subject)
+
+	keyID, _ := jwkKey.KeyID()
+	return keyID, signedJWT, nil
+}
+
+// verifyExternalIssuer checks the issuer hosted outside of S3 serves a valid discovery
+// document and JWKS and, when a JWKS URI is supplied, that the document advertises it.
+// With NoDiscovery, only the JWKS is checked.
+// Documents still propagating are waited for up to cfg.ReachableTimeout.
+func verifyExternalIssuer(cfg *Config) error {
+	discovery, err := WaitUntilReachable(cfg.Issuer(), cfg.polledJWKSURI(), cfg.ReachableTimeout)
+	if err != nil {
+		return err
+	}
+
+	if discovery != nil && cfg.JWKSURIOverride != "" && discovery.JWKSURI != cfg.JWKSURIOverride {
+		return fmt.Errorf("jwks_uri %q served by the issuer does not match the supplied JWKS URI %q",
+			discovery.JWKSURI, cfg.JWKSURIOverride)
+	}
+
+	return nil
+}
+
+// checkSTSAudience warns when neither the JWT audiences nor the client IDs of the IAM OIDC
+// provider include JWTAudience, the audience STS expects by default, which usually makes every
+// AssumeRoleWithWebIdentity call fail. Multi-audience setups relying on other client IDs are
+// still allowed, unless strict is set, which turns the warning into an error.
+func checkSTSAudience(jwtAudiences, clientIDs []string, strict bool) error {
+	if slices.Contains(jwtAudiences, JWTAudience) || slices.Contains(clientIDs, JWTAudience) {
+		return nil
+	}
+
+	if strict {
+		return fmt.Errorf("neither the JWT audiences %v nor the client IDs %v include %s", jwtAudiences, clientIDs, JWTAudience)
+	}
+	slog.Warn("Neither the JWT audiences nor the client IDs include the STS audience, AssumeRoleWithWebIdentity may fail.",
+		slog.Any("jwtAudiences", jwtAudiences), slog.Any("clientIDs", clientIDs), slog.String("expected", JWTAudience))
+
+	return nil
+}
+
+// createOIDCProvider creates the IAM OIDC provider for the issuer. When no thumbprint is
+// supplied in cfg, the thumbprint is fetched from the host serving the JWKS. Otherwise, unless
+// cfg.Offline is set, the supplied thumbprints are checked against the certificate chain of
+// the host, a mismatch being reported, or an error with cfg.Strict.
+func createOIDCProvider(cfg *Config, awsCfg aws.Config) error {
+	thumbprints := cfg.Thumbprints
+	if len(thumbprints) > 0 && !cfg.Offline {
+		if err := CheckThumbprints(cfg.JWKSURI(), thumbprints); err != nil {
+			if cfg.Strict {
+				return fmt.Errorf("invalid thumbprints: %w", err)
+			}
+			slog.Warn("Supplied thumbprints may be stale, STS may distrust the identity provider.", slog.Any("error", err))
+		}
+	}
+	if len(thumbprints) == 0 {
+		thumbprint, err := FetchThumbprint(cfg.JWKSURI())
+		if err != nil {
+			return fmt.Errorf("failed to fetch thumbprint: %w", err)
+		}
+		thumbprints = []string{thumbprint}
+	}
+
+	if err := awsProvider.Create(awsProvider.Builder(&awsProvider.OIDCProviderService{
+		Client:      awsProvider.NewIAMClient(awsCfg, cfg.ClientOptions()),
+		URL:         cfg.Issuer(),
+		ClientIDs:   cfg.AcceptedAudiences(),
+		Thumbprints: thumbprints,
+		Tags:        cfg.Tags,
+	})); err != nil {
+		return fmt.Errorf("failed to create IAM OIDC provider: %w", err)
+	}
+
+	return nil
+}
+
+// createRole creates the IAM role named cfg.RoleName with the given trust policy and returns
+// its ARN.
+func createRole(cfg *Config, awsCfg aws.Config, accountID string, trustPolicy []byte) (string, error) {
+	if err := awsProvider.Create(awsProvider.Builder(&awsProvider.RoleService{
+		Client:      awsProvider.NewIAMClient(awsCfg, cfg.ClientOptions()),
+		RoleName:    cfg.RoleName,
+		TrustPolicy: string(trustPolicy),
+		Tags:        cfg.Tags,
+	})); err != nil {
+		return "", fmt.Errorf("failed to create IAM role: %w", err)
+	}
+
+	return awsProvider.RoleARN(accountID, cfg.RoleName), nil
+}
+
+// uploadIdentityProviderDocuments uploads the generated JWKS and openid-configuration files
+// to their .well-known object keys, under the key prefix, in the S3 bucket. The openid-configuration is skipped
+// with NoDiscovery. The documents already uploaded with the same content according to the
+// checkpoint, which may be nil, are not uploaded again.
+func uploadIdentityProviderDocuments(cfg *Config, s3Service *awsProvider.S3Service, checkpoint *checkpointer) error {
+	type identityDocument struct {
+		fileName  string
+		objectKey string
+	}
+	documents := []identityDocument{{JWKSFileName, JWKSObjectKey}}
+	if !cfg.NoDiscovery {
+		documents = append(documents, identityDocument{OpenIDConfigurationFileName, OpenIDConfigurationObjectKey})
+	}
+
+	for _, document := range documents {
+		body, err := os.ReadFile(filepath.Join(cfg.OutputDir, TLSDirName, document.fileName))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", document.fileName, err)
+		}
+		objectKey := cfg.ObjectKey(document.objectKey)
+		if checkpoint.objectUploaded(objectKey, body) {
+			slog.Info("Skipping upload, already completed.", slog.String("key", objectKey))
+			continue
+		}
+		if err := s3Service.Upload(objectKey, body, "application/json"); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", document.fileName, err)
+		}
+		checkpoint.record(func(c *Checkpoint) {
+			if c.UploadedObjects == nil {
+				c.UploadedObjects = map[string]string{}
+			}
+			c.UploadedObjects[objectKey] = sha256Hex(body)
+		})
+	}
+
+	return nil
+}
+
+// CreateTrustPolicy renders the trust policy of the role assumed with the generated JWT
+// and writes it to the trust policy file in the output directory.
+//
+// The policy trusts the given OIDC provider ARN and requires the token audience to be one of
+// the accepted audiences and the subject to match the claim of the generated JWT, i.e.
+// cfg.Subject(). Source identity is allowed when enabled in cfg, and the source IPs and VPC
+// endpoints of cfg further restrict where the role may be assumed from.
+//
+// Returns:
+//   - []byte: The rendered trust policy document.
+//   - error: An error if rendering or writing the policy fails.
+func CreateTrustPolicy(cfg *Config, providerARN string) ([]byte, error) {
+	policyJSON, err := awsProvider.RenderTrustPolicy(awsProvider.TrustPolicyInput{
+		ProviderARN:                  providerARN,
+		Issuer:                       cfg.Issuer(),
+		Audiences:                    cfg.AcceptedAudiences(),
+		Subject:                      cfg.Subject(),
+		AllowSourceIdentity:          cfg.AllowSourceIdentity,
+		SourceIdentityMatchesSubject: cfg.SourceIdentityMatchesSubject,
+		SourceIPs:                    cfg.SourceIPs,
+		SourceVPCEs:                  cfg.SourceVPCEs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	policyFilePath := filepath.Join(cfg.OutputDir, TLSDirName, TrustPolicyFileName)
+	if err := writeFileAtomic(policyFilePath, policyJSON, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write trust policy to file: %w", err)
+	}
+	slog.Info("Trust policy written to", slog.String("file", policyFilePath))
+
+	return policyJSON, nil
+}
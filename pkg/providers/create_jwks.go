@@ -1,62 +1,61 @@
 package providers
 
 import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log/slog"
-	"os"
 	"path/filepath"
+	"regexp"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	awsProvider "github.com/chuhaoyuu/aws-oidc-sts/pkg/providers/aws"
 	"github.com/lestrrat-go/jwx/v3/jwa"
 	"github.com/lestrrat-go/jwx/v3/jwk"
 )
 
-func CreateIdentityProvider(filePath, bucketName, region string) error {
-	// Create the JWKS file
-	jwkKey, err := CreateJSONWebKeySet(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create JSON Web Key Set: %w", err)
-	}
-
-	signedJWT, err := CreateJWT(jwkKey)
-	if err != nil {
-		return fmt.Errorf("failed to create JWT: %w", err)
-	}
-
-	slog.Info("JWT created successfully", "JWT", string(signedJWT))
-
-	cfg, err := awsProvider.AwsClient(region)
-	if err != nil {
-		return fmt.Errorf("failed to create AWS client: %w", err)
+// ValidateKeyID checks that a user-supplied key ID only contains URL-safe characters, i.e. the
+// unreserved characters of RFC 3986, so that it can be referenced in URLs and runbooks as is.
+func ValidateKeyID(keyID string) error {
+	if !urlSafeKeyID.MatchString(keyID) {
+		return fmt.Errorf("key ID %q must only contain letters, digits, '-', '.', '_' and '~'", keyID)
 	}
+	return nil
+}
 
-	if err := awsProvider.Create(awsProvider.Builder(&awsProvider.S3Service{
-		Client:     s3.NewFromConfig(cfg),
-		BucketName: bucketName,
-		Region:     region,
-	})); err != nil {
-		return fmt.Errorf("failed to create S3 bucket: %w", err)
+// ValidateKeyIDHash checks that the hash algorithm of the computed key IDs is KeyIDHashSHA1 or
+// KeyIDHashSHA256. An empty algorithm selects the default, KeyIDHashSHA256.
+func ValidateKeyIDHash(hashAlgorithm string) error {
+	switch hashAlgorithm {
+	case "", KeyIDHashSHA1, KeyIDHashSHA256:
+		return nil
+	default:
+		return fmt.Errorf("key ID hash must be %s or %s, got %q", KeyIDHashSHA1, KeyIDHashSHA256, hashAlgorithm)
 	}
-
-	return nil
 }
 
 // keyIDFromPublicKey generates a unique key identifier (key ID) from the given public key.
 // The publicKey parameter can be of any type that represents a public key.
 // This function is typically used to create a key ID for use in JSON Web Key Sets (JWKS).
 // The returned key ID is a string that uniquely identifies the provided public key.
-func keyIDFromPublicKey(publicKey any) string {
+//
+// The key ID is the hex-encoded hash of the DER-encoded public key, with SHA-1 when
+// hashAlgorithm is KeyIDHashSHA1, for relying parties expecting legacy key IDs, and
+// SHA-256 otherwise. hashAlgorithm must have been checked with ValidateKeyIDHash.
+func keyIDFromPublicKey(publicKey any, hashAlgorithm string) string {
 	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
 	if err != nil {
 		panic(fmt.Errorf("failed to marshal public key: %w", err))
 	}
 
 	hash := sha256.New()
+	if hashAlgorithm == KeyIDHashSHA1 {
+		hash = sha1.New()
+	}
 	hash.Write(publicKeyBytes)
 	hashedBytes := hash.Sum(nil)
 
@@ -65,92 +64,482 @@ func keyIDFromPublicKey(publicKey any) string {
 	return keyID
 }
 
+// VerifyKeyFingerprint checks that the key ID computed from the public key of the key pair
+// in the specified directory, or of the signer when set, is expectedKeyID. Pipelines pinning
+// their key use it to fail before a regenerated or swapped key is published or used to sign.
+// The key ID is computed with the keyIDHash algorithm, see keyIDFromPublicKey.
+func VerifyKeyFingerprint(filePath string, signer Signer, expectedKeyID, keyIDHash string) error {
+	if signer != nil {
+		publicKey, err := signerPublicKey(signer)
+		if err != nil {
+			return err
+		}
+		return checkKeyFingerprint(publicKey, expectedKeyID, keyIDHash)
+	}
+
+	privateKey, err := ParsePrivateKeyFromFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return checkKeyFingerprint(&privateKey.PublicKey, expectedKeyID, keyIDHash)
+}
+
+// checkKeyFingerprint returns an error when the key ID computed from publicKey with the
+// keyIDHash algorithm is not expectedKeyID.
+func checkKeyFingerprint(publicKey *rsa.PublicKey, expectedKeyID, keyIDHash string) error {
+	if err := ValidateKeyIDHash(keyIDHash); err != nil {
+		return err
+	}
+	if keyID := keyIDFromPublicKey(publicKey, keyIDHash); keyID != expectedKeyID {
+		return fmt.Errorf("key ID %s of the key pair does not match the expected key ID %s, the key may have been regenerated or swapped",
+			keyID, expectedKeyID)
+	}
+	return nil
+}
+
+// keyPairKeyID returns the key ID the key pair is published with: keyID when set, otherwise
+// the name of its directory in the nested key layout, or the key ID the public key is published
+// with (see publishedKeyIDOrHash).
+func keyPairKeyID(filePath string, publicKey *rsa.PublicKey, keyID, keyIDHash string) (string, error) {
+	if err := ValidateKeyIDHash(keyIDHash); err != nil {
+		return "", err
+	}
+
+	published := publishedKeyID(filePath, publicKey)
+	if keyID != "" {
+		if err := ValidateKeyID(keyID); err != nil {
+			return "", err
+		}
+		if published != "" && published != keyID {
+			slog.Warn("Key ID differs from the one the key is published with, tokens referencing it will no longer verify.",
+				slog.String("kid", keyID), slog.String("publishedKid", published))
+		}
+		return keyID, nil
+	}
+
+	activeKeyID, err := activeNestedKeyID(filePath)
+	if err != nil {
+		return "", err
+	}
+	if activeKeyID != "" {
+		return activeKeyID, nil
+	}
+	return publishedKeyIDOrHash(filePath, publicKey, keyIDHash), nil
+}
+
+// publishedKeyIDOrHash returns the label the public key is published with in the JWK Set of the
+// specified directory, so that a label set once is kept when the set is regenerated, and the
+// key ID computed with the keyIDHash algorithm otherwise. A published key ID computed with the
+// other hash algorithm is not kept, so that changing the algorithm applies to every key.
+func publishedKeyIDOrHash(filePath string, publicKey *rsa.PublicKey, keyIDHash string) string {
+	keyID := keyIDFromPublicKey(publicKey, keyIDHash)
+	published := publishedKeyID(filePath, publicKey)
+	switch published {
+	case "", keyID:
+		return keyID
+	case keyIDFromPublicKey(publicKey, KeyIDHashSHA1), keyIDFromPublicKey(publicKey, KeyIDHashSHA256):
+		slog.Warn("Key ID hash changed, tokens referencing the previous key ID will no longer verify.",
+			slog.String("kid", keyID), slog.String("publishedKid", published))
+		return keyID
+	default:
+		return published
+	}
+}
+
+// publishedKeyID returns the key ID of the public key in the JWK Set of the specified
+// directory, or an empty string when there is no JWK Set or the key is not part of it.
+func publishedKeyID(filePath string, publicKey *rsa.PublicKey) string {
+	jwkSet, err := jwk.ReadFile(filepath.Join(filePath, TLSDirName, JWKSFileName))
+	if err != nil {
+		return ""
+	}
+
+	for i := 0; i < jwkSet.Len(); i++ {
+		key, _ := jwkSet.Key(i)
+		var rsaPublicKey rsa.PublicKey
+		if err := jwk.Export(key, &rsaPublicKey); err != nil || !rsaPublicKey.Equal(publicKey) {
+			continue
+		}
+		if keyID, ok := key.KeyID(); ok {
+			return keyID
+		}
+	}
+
+	return ""
+}
+
+// urlSafeKeyID matches key IDs made of RFC 3986 unreserved characters.
+var urlSafeKeyID = regexp.MustCompile(`^[A-Za-z0-9._~-]+$`)
+
+// JWKSOptions holds the optional settings applied when generating a JSON Web Key Set.
+type JWKSOptions struct {
+	// AdditionalKeyFiles are the paths of additional PEM-encoded RSA private keys to publish.
+	AdditionalKeyFiles []string
+	// MaxBytes is the size above which the JWK Set is reported. Defaults to DefaultJWKSMaxBytes.
+	MaxBytes int
+	// MaxKeys is the key count above which the JWK Set is reported. Defaults to DefaultJWKSMaxKeys.
+	MaxKeys int
+	// Strict turns the limit warnings into errors.
+	Strict bool
+	// KeyID is a label used as the key ID of the key pair instead of the one computed from
+	// its public key, or the one it is already published with. It must only contain URL-safe
+	// characters.
+	KeyID string
+	// ExpectedKeyID is the key ID the public key of the key pair must hash to, whatever
+	// KeyID is, when the key is pinned. The JWK Set is not created on a mismatch.
+	ExpectedKeyID string
+	// KeyIDHash is the hash algorithm of the key IDs computed from the public keys,
+	// KeyIDHashSHA1 or KeyIDHashSHA256. Defaults to KeyIDHashSHA256.
+	KeyIDHash string
+	// MinKeySize is the smallest RSA key size allowed for the key pair and the additional
+	// keys. Defaults to DefaultMinKeySize.
+	MinKeySize int
+	// Signer holds the private key of the key pair instead of the private key file. The
+	// returned key is then its public JWK, and JWTs must be signed with the Signer.
+	Signer Signer
+	// X5TAlgorithm selects the certificate thumbprints published for the key pair: X5TAlgorithmSHA1
+	// for x5t, X5TAlgorithmSHA256 for x5t#S256 or X5TAlgorithmBoth. Defaults to X5TAlgorithmSHA256.
+	X5TAlgorithm string
+	// Wrapper holds the properties of a copy of the JWK Set written to JWKSWrappedFileName for
+	// consumers expecting other top-level properties than "keys". No copy is written when nil,
+	// and the standard JWK Set is never changed. See ReadJWKSWrapper.
+	Wrapper map[string]any
+}
+
 // CreateJSONWebKeySet generates a JSON Web Key Set (JWKS) from a given private key file.
 // It parses the private and public keys from the specified file, creates a JWK for the private key,
 // and adds the corresponding public key to the JWK Set. The resulting JWKS is then written to a file.
 //
+// Additional RSA private keys, e.g. the keys of a different size during a phased key upgrade,
+// can be provided through opts.AdditionalKeyFiles. Their public keys are published in the same set
+// with their own key IDs, and the largest key is returned to sign new tokens.
+//
+// During a staged rotation (see RotateKeys), the next or previous key of the rotation state is
+// published too, with the key ID it is already published with, but never signs new tokens.
+// In the nested key layout (see KeyLayout), the key pairs of the other subdirectories are
+// published the same way, with their directory name as key ID.
+//
+// The public key of the key pair also carries the x5t and/or x5t#S256 thumbprints, selected by
+// opts.X5TAlgorithm, of its self-signed certificate, which is created when missing.
+//
+// With opts.Signer, e.g. a key held in an HSM, the key pair is read from the Signer rather than
+// from the key files, and the returned key is its public JWK, always used to sign new tokens.
+//
 // Parameters:
 //   - filePath: The path to the private key file.
+//   - opts: The options applied to the generated JWK Set.
 //
 // Returns:
-//   - jwk.Key: The generated JWK for the private key.
+//   - jwk.Key: The generated JWK for the private key with the largest modulus.
 //   - error: An error if any step in the process fails.
 //
 // The function performs the following steps:
 //  1. Parses the private and public keys from the provided file.
 //  2. Creates a new JWK Set.
-//  3. Extracts the key ID (kid) from the public key.
+//  3. Extracts the key ID (kid) from the public key and checks it against opts.ExpectedKeyID
+//     when set. The key pair is published with opts.KeyID when set, otherwise with the key ID
+//     it is already published with in the existing JWK Set, so that regenerating the set
+//     with an unchanged key never changes its key ID, and with the computed key ID otherwise.
 //  4. Imports the private key into a JWK and sets its key ID, usage, and algorithm.
-//  5. Extracts the public key from the private key and adds it to the JWK Set.
-//  6. Marshals the JWK Set into JSON format.
-//  7. Writes the JSON-formatted JWK Set to a file in the specified directory.
+//  5. Extracts the public key from the private key, sets its certificate thumbprints
+//     and adds it to the JWK Set.
+//  6. Repeats steps 3 to 5 for each additional private key, the key staged by a rotation and
+//     the other key pairs of the nested layout, without certificate thumbprints.
+//  7. Validates the required parameters of every key in the JWK Set.
+//  8. Marshals the JWK Set into JSON format.
+//  9. Checks the size and key count of the JWK Set against the configured limits.
+//  10. Writes the JSON-formatted JWK Set to a file in the specified directory.
+//  11. With opts.Wrapper, writes the wrapped copy of the JWK Set next to it.
 //
 // Errors are returned if any of the following occur:
 //   - Parsing the private or public key fails.
+//   - A key is smaller than opts.MinKeySize.
 //   - Importing the private key into a JWK fails.
 //   - Setting the key ID, usage, or algorithm for the JWK fails.
+//   - The key ID computed from the public key does not match opts.ExpectedKeyID.
 //   - Creating the public key from the private key fails.
+//   - Creating or parsing the certificate fails, or it does not match the private key.
+//   - Two keys share the same key ID.
+//   - A key is missing a parameter required by its key type.
 //   - Marshaling the JWK Set into JSON format fails.
+//   - The JWK Set exceeds the configured limits in strict mode.
 //   - Writing the JWK Set to a file fails.
-func CreateJSONWebKeySet(filePath string) (jwk.Key, error) {
+func CreateJSONWebKeySet(filePath string, opts JWKSOptions) (jwk.Key, error) {
 
-	privateKey, err := ParsePrivateKeyFromFile(filePath)
+	var privateKey *rsa.PrivateKey
+	var publicKey *rsa.PublicKey
+	if opts.Signer != nil {
+		signerKey, err := signerPublicKey(opts.Signer)
+		if err != nil {
+			return nil, err
+		}
+		publicKey = signerKey
+	} else {
+		var err error
+		privateKey, err = ParsePrivateKeyFromFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+
+		if _, err := ParsePublicKeyFromFile(filePath); err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		publicKey = &privateKey.PublicKey
+	}
+
+	if err := checkKeySize(publicKey.N.BitLen(), opts.MinKeySize); err != nil {
+		return nil, err
+	}
+
+	if opts.ExpectedKeyID != "" {
+		if err := checkKeyFingerprint(publicKey, opts.ExpectedKeyID, opts.KeyIDHash); err != nil {
+			return nil, err
+		}
+	}
+
+	keyID, err := keyPairKeyID(filePath, publicKey, opts.KeyID, opts.KeyIDHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// The keys of a Signer are not accessible, so only their public key is imported
+	privateKeys := []*rsa.PrivateKey{privateKey}
+	publicKeys := []*rsa.PublicKey{publicKey}
+	keyIDs := []string{keyID}
+	for _, keyFile := range opts.AdditionalKeyFiles {
+		additionalKey, err := ParsePrivateKeyFromPEMFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse additional private key %s: %w", keyFile, err)
+		}
+		if err := checkKeySize(additionalKey.N.BitLen(), opts.MinKeySize); err != nil {
+			return nil, fmt.Errorf("additional private key %s: %w", keyFile, err)
+		}
+		privateKeys = append(privateKeys, additionalKey)
+		publicKeys = append(publicKeys, &additionalKey.PublicKey)
+		keyIDs = append(keyIDs, keyIDFromPublicKey(&additionalKey.PublicKey, opts.KeyIDHash))
+	}
+
+	// Publish the key staged by a rotation, which must not sign new tokens
+	signingCandidates := len(publicKeys)
+	stagedKeyFile, err := rotationStagedKeyFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if stagedKeyFile != "" {
+		stagedKey, err := ParsePrivateKeyFromPEMFile(stagedKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse staged private key %s: %w", stagedKeyFile, err)
+		}
+		stagedKeyID := publishedKeyIDOrHash(filePath, &stagedKey.PublicKey, opts.KeyIDHash)
+		privateKeys = append(privateKeys, stagedKey)
+		publicKeys = append(publicKeys, &stagedKey.PublicKey)
+		keyIDs = append(keyIDs, stagedKeyID)
+	}
+
+	// Publish the other key pairs of the nested layout, which must not sign new tokens either
+	nestedIDs, err := nestedKeyIDs(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key: %w", err)
+		return nil, err
+	}
+	for _, nestedKeyID := range nestedIDs {
+		nestedKeyFile := filepath.Join(filePath, TLSDirName, nestedKeyID, RSAPrivateKeyFile)
+		nestedKey, err := ParsePrivateKeyFromPEMFile(nestedKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key %s: %w", nestedKeyFile, err)
+		}
+		if err := checkKeySize(nestedKey.N.BitLen(), opts.MinKeySize); err != nil {
+			return nil, fmt.Errorf("private key %s: %w", nestedKeyFile, err)
+		}
+		privateKeys = append(privateKeys, nestedKey)
+		publicKeys = append(publicKeys, &nestedKey.PublicKey)
+		keyIDs = append(keyIDs, nestedKeyID)
 	}
 
-	publicKey, err := ParsePublicKeyFromFile(filePath)
+	// Load the certificate the x5t thumbprints are computed from
+	var certificateSigner crypto.Signer = privateKey
+	if opts.Signer != nil {
+		certificateSigner = opts.Signer
+	}
+	if err := createSelfSignedCertificate(filePath, certificateSigner); err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	certificate, err := ParseCertificateFromFile(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key: %w", err)
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	if certificatePublicKey, ok := certificate.PublicKey.(*rsa.PublicKey); !ok || !certificatePublicKey.Equal(publicKey) {
+		return nil, fmt.Errorf("certificate does not match the private key")
 	}
 
 	// Create a new JWK Set
 	jwkSet := jwk.NewSet()
 
-	// Extract the key ID (kid) from the public key
-	keyID := keyIDFromPublicKey(publicKey)
+	var signingKey jwk.Key
+	signingKeyBits := 0
+	seenKeyIDs := make(map[string]bool, len(keyIDs))
+	for i, key := range publicKeys {
+		if seenKeyIDs[keyIDs[i]] {
+			return nil, fmt.Errorf("duplicate key ID %s in JWK Set", keyIDs[i])
+		}
+		seenKeyIDs[keyIDs[i]] = true
+
+		var rawKey any = privateKeys[i]
+		if privateKeys[i] == nil {
+			rawKey = key
+		}
+		jwkPrivateKey, err := signingJWK(rawKey, keyIDs[i])
+		if err != nil {
+			return nil, err
+		}
+
+		// Extract the public key from the private key
+		jwkPublicKey, err := jwk.PublicKeyOf(jwkPrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create public key from private key: %w", err)
+		}
+
+		// Set the certificate thumbprints of the key pair
+		if i == 0 {
+			if err := setCertificateThumbprints(jwkPublicKey, certificate, opts.X5TAlgorithm); err != nil {
+				return nil, err
+			}
+		}
+
+		// Add the public key to the JWK Set
+		if err := jwkSet.AddKey(jwkPublicKey); err != nil {
+			return nil, fmt.Errorf("failed to add public key to JWK Set: %w", err)
+		}
+
+		// Sign new tokens with the largest key, or with the Signer when set
+		if bits := key.N.BitLen(); bits > signingKeyBits && i < signingCandidates && (opts.Signer == nil || i == 0) {
+			signingKey = jwkPrivateKey
+			signingKeyBits = bits
+		}
+	}
+	if len(publicKeys) > 1 {
+		signingKeyID, _ := signingKey.KeyID()
+		slog.Info("Selected signing key", slog.String("kid", signingKeyID), slog.Int("bits", signingKeyBits))
+	}
+
+	// Make sure every key carries the parameters required by its type
+	if err := validateJWKSet(jwkSet); err != nil {
+		return nil, err
+	}
+
+	// Marshal the JWK Set into JSON format
+	jwkSetJSON, err := json.MarshalIndent(jwkSet, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JWK Set: %w", err)
+	}
+
+	// Guard against a JWK Set growing too large for STS to fetch
+	if err := checkJWKSLimits(jwkSetJSON, jwkSet.Len(), opts); err != nil {
+		return nil, err
+	}
+
+	// Write the JWK Set to a file
+	jwkFilePath := filepath.Join(filePath, TLSDirName, JWKSFileName)
+	if err := writeFileAtomic(jwkFilePath, jwkSetJSON, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write JWK Set to file: %w", err)
+	}
 
+	if opts.Wrapper != nil {
+		if err := writeWrappedJWKS(filePath, jwkSetJSON, opts.Wrapper); err != nil {
+			return nil, err
+		}
+	}
+
+	return signingKey, nil
+}
+
+// signingJWK imports the RSA private key into a JWK and sets its key ID, usage and algorithm.
+// The public key of a Signer is imported instead of its inaccessible private key.
+func signingJWK(privateKey any, keyID string) (jwk.Key, error) {
 	// Import the RSA private key into a JWK
 	jwkPrivateKey, err := jwk.Import(privateKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to import private key into JWK: %w", err)
 	}
 
+	if err := setKeyMetadata(jwkPrivateKey, keyID, jwa.RS256()); err != nil {
+		return nil, err
+	}
+
+	return jwkPrivateKey, nil
+}
+
+// setKeyMetadata sets the key ID, the signature usage and the algorithm of the JWK.
+func setKeyMetadata(key jwk.Key, keyID string, algorithm jwa.SignatureAlgorithm) error {
 	// Set the key ID (kid) for the JWK
-	if err := jwkPrivateKey.Set(jwk.KeyIDKey, keyID); err != nil {
-		return nil, fmt.Errorf("failed to set key ID: %w", err)
+	if err := key.Set(jwk.KeyIDKey, keyID); err != nil {
+		return fmt.Errorf("failed to set key ID: %w", err)
 	}
 
 	// Set the key type (use) for the JWK
-	if err := jwkPrivateKey.Set(jwk.KeyUsageKey, JWKSUsage); err != nil {
-		return nil, fmt.Errorf("failed to set key usage: %w", err)
+	if err := key.Set(jwk.KeyUsageKey, JWKSUsage); err != nil {
+		return fmt.Errorf("failed to set key usage: %w", err)
 	}
 
 	// Set the algorithm (alg) for the JWK
-	if err := jwkPrivateKey.Set(jwk.AlgorithmKey, jwa.RS256()); err != nil {
-		return nil, fmt.Errorf("failed to set algorithm: %w", err)
+	if err := key.Set(jwk.AlgorithmKey, algorithm); err != nil {
+		return fmt.Errorf("failed to set algorithm: %w", err)
 	}
 
-	// Extract the public key from the private key
-	jwkPublicKey, err := jwk.PublicKeyOf(jwkPrivateKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create public key from private key: %w", err)
+	return nil
+}
+
+// checkJWKSLimits warns when the marshaled JWK Set exceeds the size or key count limits of
+// opts, which usually means old keys were not pruned after a rotation. Very large sets can
+// make STS fail to fetch or parse the JWKS. In strict mode, exceeding a limit is an error.
+func checkJWKSLimits(jwkSetJSON []byte, keyCount int, opts JWKSOptions) error {
+	maxBytes := opts.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultJWKSMaxBytes
+	}
+	maxKeys := opts.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = DefaultJWKSMaxKeys
 	}
 
-	// Add the public key to the JWK Set
-	jwkSet.AddKey(jwkPublicKey)
+	if len(jwkSetJSON) <= maxBytes && keyCount <= maxKeys {
+		return nil
+	}
 
-	// Marshal the JWK Set into JSON format
-	jwkSetJSON, err := json.MarshalIndent(jwkSet, "", "  ")
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal JWK Set: %w", err)
+	if opts.Strict {
+		return fmt.Errorf("JWK Set of %d bytes with %d keys exceeds the limits of %d bytes and %d keys",
+			len(jwkSetJSON), keyCount, maxBytes, maxKeys)
 	}
+	slog.Warn("JWK Set exceeds the recommended limits, consider pruning old keys.",
+		slog.Int("bytes", len(jwkSetJSON)), slog.Int("keys", keyCount),
+		slog.Int("maxBytes", maxBytes), slog.Int("maxKeys", maxKeys))
 
-	// Write the JWK Set to a file
-	jwkFilePath := filepath.Join(filePath, TLSDirName, JWKSFileName)
-	if err := os.WriteFile(jwkFilePath, jwkSetJSON, 0644); err != nil {
-		return nil, fmt.Errorf("failed to write JWK Set to file: %w", err)
+	return nil
+}
+
+// setCertificateThumbprints sets the x5t (SHA-1) and/or x5t#S256 (SHA-256) thumbprints of the
+// certificate on the key, as selected by algorithm. SHA-1 is deprecated and only meant for
+// legacy verifiers, so an empty algorithm selects SHA-256.
+func setCertificateThumbprints(key jwk.Key, certificate *x509.Certificate, algorithm string) error {
+	if algorithm == "" {
+		algorithm = X5TAlgorithmSHA256
+	}
+	if algorithm != X5TAlgorithmSHA1 && algorithm != X5TAlgorithmSHA256 && algorithm != X5TAlgorithmBoth {
+		return fmt.Errorf("unsupported x5t algorithm %q, expected %s, %s or %s",
+			algorithm, X5TAlgorithmSHA1, X5TAlgorithmSHA256, X5TAlgorithmBoth)
 	}
 
-	return jwkPrivateKey, nil
+	if algorithm == X5TAlgorithmSHA1 || algorithm == X5TAlgorithmBoth {
+		thumbprint := sha1.Sum(certificate.Raw)
+		if err := key.Set(jwk.X509CertThumbprintKey, base64.RawURLEncoding.EncodeToString(thumbprint[:])); err != nil {
+			return fmt.Errorf("failed to set x5t: %w", err)
+		}
+	}
+	if algorithm == X5TAlgorithmSHA256 || algorithm == X5TAlgorithmBoth {
+		thumbprint := sha256.Sum256(certificate.Raw)
+		if err := key.Set(jwk.X509CertThumbprintS256Key, base64.RawURLEncoding.EncodeToString(thumbprint[:])); err != nil {
+			return fmt.Errorf("failed to set x5t#S256: %w", err)
+		}
+	}
+
+	return nil
 }
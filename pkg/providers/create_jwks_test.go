@@ -0,0 +1,483 @@
+package providers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+)
+
+// fixtureKeyID and fixtureSHA1KeyID are the SHA-256 and SHA-1 key IDs of the key pair of
+// testdata, computed with openssl rsa -in testdata/private-key.pem -pubout -outform DER | sha256sum
+// and sha1sum.
+const (
+	fixtureKeyID     = "69be20670e2cae2cc4391b49c3fcf28606dea6211d1bc7d4264fb653da01e786"
+	fixtureSHA1KeyID = "858c3359601c8b7dd92e478ece452fb41a42faad"
+)
+
+// newFixtureKeyPairDir returns a temporary directory holding the key pair of testdata in the
+// flat layout.
+func newFixtureKeyPairDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, TLSDirName), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{RSAPrivateKeyFile, RSAPublicKeyFile} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, TLSDirName, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// readTestJWKS reads the JWK Set written by CreateJSONWebKeySet in dir.
+func readTestJWKS(t *testing.T, dir string) jwk.Set {
+	t.Helper()
+
+	set, err := jwk.ReadFile(filepath.Join(dir, TLSDirName, JWKSFileName))
+	if err != nil {
+		t.Fatalf("jwk.ReadFile: %v", err)
+	}
+	return set
+}
+
+// modulusBits returns the size of the modulus of the RSA JWK.
+func modulusBits(t *testing.T, key jwk.Key) int {
+	t.Helper()
+
+	var publicKey rsa.PublicKey
+	if err := jwk.Export(key, &publicKey); err != nil {
+		t.Fatalf("jwk.Export: %v", err)
+	}
+	return publicKey.N.BitLen()
+}
+
+func TestCreateJSONWebKeySetAdditionalKeySizes(t *testing.T) {
+	dir := newTestKeyPairDir(t)
+	largerKeyPEM, _, err := generateRSAKeyPairPEM(3072)
+	if err != nil {
+		t.Fatalf("generateRSAKeyPairPEM: %v", err)
+	}
+	largerKeyFile := filepath.Join(t.TempDir(), "larger-private-key.pem")
+	if err := os.WriteFile(largerKeyFile, largerKeyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	signingKey, err := CreateJSONWebKeySet(dir, JWKSOptions{AdditionalKeyFiles: []string{largerKeyFile}, MinKeySize: 2048})
+	if err != nil {
+		t.Fatalf("CreateJSONWebKeySet: %v", err)
+	}
+
+	set := readTestJWKS(t, dir)
+	if set.Len() != 2 {
+		t.Fatalf("JWKS has %d keys, want 2", set.Len())
+	}
+	sizes := map[int]string{}
+	for i := range set.Len() {
+		key, _ := set.Key(i)
+		keyID, _ := key.KeyID()
+		sizes[modulusBits(t, key)] = keyID
+	}
+	if sizes[2048] == "" || sizes[3072] == "" {
+		t.Fatalf("JWKS key sizes = %v, want a 2048-bit and a 3072-bit key", sizes)
+	}
+	if sizes[2048] == sizes[3072] {
+		t.Errorf("both keys have kid %q, want distinct kids", sizes[2048])
+	}
+
+	signingKeyID, _ := signingKey.KeyID()
+	if signingKeyID != sizes[3072] {
+		t.Errorf("signing kid = %q, want the kid %q of the larger key", signingKeyID, sizes[3072])
+	}
+}
+
+func TestCreateJSONWebKeySetCertificateThumbprints(t *testing.T) {
+	tests := []struct {
+		algorithm  string
+		wantSHA1   bool
+		wantSHA256 bool
+	}{
+		{algorithm: "", wantSHA256: true},
+		{algorithm: X5TAlgorithmSHA1, wantSHA1: true},
+		{algorithm: X5TAlgorithmSHA256, wantSHA256: true},
+		{algorithm: X5TAlgorithmBoth, wantSHA1: true, wantSHA256: true},
+	}
+
+	for _, tt := range tests {
+		t.Run("algorithm="+tt.algorithm, func(t *testing.T) {
+			dir := newTestKeyPairDir(t)
+			if _, err := CreateJSONWebKeySet(dir, JWKSOptions{MinKeySize: 2048, X5TAlgorithm: tt.algorithm}); err != nil {
+				t.Fatalf("CreateJSONWebKeySet: %v", err)
+			}
+			certificate, err := ParseCertificateFromFile(dir)
+			if err != nil {
+				t.Fatalf("ParseCertificateFromFile: %v", err)
+			}
+			key, _ := readTestJWKS(t, dir).Key(0)
+
+			sha1Sum := sha1.Sum(certificate.Raw)
+			x5t, ok := key.X509CertThumbprint()
+			if ok != tt.wantSHA1 {
+				t.Errorf("x5t present = %t, want %t", ok, tt.wantSHA1)
+			}
+			if want := base64.RawURLEncoding.EncodeToString(sha1Sum[:]); ok && x5t != want {
+				t.Errorf("x5t = %q, want the recomputed %q", x5t, want)
+			}
+
+			sha256Sum := sha256.Sum256(certificate.Raw)
+			x5tS256, ok := key.X509CertThumbprintS256()
+			if ok != tt.wantSHA256 {
+				t.Errorf("x5t#S256 present = %t, want %t", ok, tt.wantSHA256)
+			}
+			if want := base64.RawURLEncoding.EncodeToString(sha256Sum[:]); ok && x5tS256 != want {
+				t.Errorf("x5t#S256 = %q, want the recomputed %q", x5tS256, want)
+			}
+		})
+	}
+}
+
+func TestCreateJSONWebKeySetReplacesStaleCertificate(t *testing.T) {
+	dir := newTestKeyPairDir(t)
+	if err := CreateSelfSignedCertificate(dir); err != nil {
+		t.Fatalf("CreateSelfSignedCertificate: %v", err)
+	}
+
+	// The key pair is regenerated, leaving the certificate of the former key behind
+	for _, name := range []string{RSAPrivateKeyFile, RSAPublicKeyFile} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, TLSDirName, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := CreateJSONWebKeySet(dir, JWKSOptions{MinKeySize: 2048, X5TAlgorithm: X5TAlgorithmSHA256}); err != nil {
+		t.Fatalf("CreateJSONWebKeySet: %v", err)
+	}
+	certificate, err := ParseCertificateFromFile(dir)
+	if err != nil {
+		t.Fatalf("ParseCertificateFromFile: %v", err)
+	}
+	publicKey, err := ParsePublicKeyFromFile(dir)
+	if err != nil {
+		t.Fatalf("ParsePublicKeyFromFile: %v", err)
+	}
+	if certificatePublicKey, ok := certificate.PublicKey.(*rsa.PublicKey); !ok || !certificatePublicKey.Equal(publicKey) {
+		t.Fatal("the certificate was not recreated for the new key pair")
+	}
+
+	sum := sha256.Sum256(certificate.Raw)
+	key, _ := readTestJWKS(t, dir).Key(0)
+	if x5t, _ := key.X509CertThumbprintS256(); x5t != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Errorf("x5t#S256 = %q, want the thumbprint of the new certificate", x5t)
+	}
+}
+
+func TestSetCertificateThumbprintsUnsupportedAlgorithm(t *testing.T) {
+	dir := newTestKeyPairDir(t)
+	if err := CreateSelfSignedCertificate(dir); err != nil {
+		t.Fatalf("CreateSelfSignedCertificate: %v", err)
+	}
+	certificate, err := ParseCertificateFromFile(dir)
+	if err != nil {
+		t.Fatalf("ParseCertificateFromFile: %v", err)
+	}
+	key, err := jwk.Import(certificate.PublicKey)
+	if err != nil {
+		t.Fatalf("jwk.Import: %v", err)
+	}
+
+	if err := setCertificateThumbprints(key, certificate, "md5"); err == nil {
+		t.Fatal("setCertificateThumbprints accepted the md5 algorithm")
+	}
+}
+
+func TestVerifyKeyFingerprint(t *testing.T) {
+	dir := newTestKeyPairDir(t)
+	publicKey, err := ParsePublicKeyFromFile(dir)
+	if err != nil {
+		t.Fatalf("ParsePublicKeyFromFile: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha1Sum, sha256Sum := sha1.Sum(der), sha256.Sum256(der)
+	sha1KeyID, sha256KeyID := hex.EncodeToString(sha1Sum[:]), hex.EncodeToString(sha256Sum[:])
+
+	tests := []struct {
+		name          string
+		expectedKeyID string
+		keyIDHash     string
+		wantErr       string
+	}{
+		{name: "sha256 match", expectedKeyID: sha256KeyID, keyIDHash: KeyIDHashSHA256},
+		{name: "default hash match", expectedKeyID: sha256KeyID},
+		{name: "sha1 match", expectedKeyID: sha1KeyID, keyIDHash: KeyIDHashSHA1},
+		{name: "mismatch", expectedKeyID: strings.Repeat("0", 64), keyIDHash: KeyIDHashSHA256, wantErr: "does not match the expected key ID"},
+		{name: "other hash", expectedKeyID: sha256KeyID, keyIDHash: KeyIDHashSHA1, wantErr: "does not match the expected key ID"},
+		{name: "unsupported hash", expectedKeyID: sha256KeyID, keyIDHash: "md5", wantErr: "md5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyKeyFingerprint(dir, nil, tt.expectedKeyID, tt.keyIDHash)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("VerifyKeyFingerprint: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMinKeySizeImportedKeys(t *testing.T) {
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakKeyFile := filepath.Join(t.TempDir(), "weak-private-key.pem")
+	if err := os.WriteFile(weakKeyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(weakKey)}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	weakPublicKeyDER, err := x509.MarshalPKIXPublicKey(&weakKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakPublicKeyFile := filepath.Join(t.TempDir(), "weak-public-key.pem")
+	if err := os.WriteFile(weakPublicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: weakPublicKeyDER}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		run     func(dir string) error
+		wantErr string
+	}{
+		{
+			name: "JWKS key pair below configured minimum",
+			run: func(dir string) error {
+				_, err := CreateJSONWebKeySet(dir, JWKSOptions{MinKeySize: 3072})
+				return err
+			},
+			wantErr: "RSA key of 2048 bits is smaller than the minimum key size of 3072 bits",
+		},
+		{
+			name: "JWKS additional key below default minimum",
+			run: func(dir string) error {
+				_, err := CreateJSONWebKeySet(dir, JWKSOptions{AdditionalKeyFiles: []string{weakKeyFile}})
+				return err
+			},
+			wantErr: "RSA key of 1024 bits is smaller than the minimum key size of 2048 bits",
+		},
+		{
+			name: "signing key below configured minimum",
+			run: func(dir string) error {
+				_, err := SigningKey(dir, "", "", nil, 3072)
+				return err
+			},
+			wantErr: "RSA key of 2048 bits is smaller than the minimum key size of 3072 bits",
+		},
+		{
+			name: "public key below default minimum",
+			run: func(dir string) error {
+				_, err := CreatePublicJSONWebKeySet(filepath.Join(dir, TLSDirName, JWKSFileName), weakPublicKeyFile, "", KeyIDHashSHA256, "RS256", 0)
+				return err
+			},
+			wantErr: "RSA key of 1024 bits is smaller than the minimum key size of 2048 bits",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newTestKeyPairDir(t)
+			err := tt.run(dir)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			if _, err := os.Stat(filepath.Join(dir, TLSDirName, JWKSFileName)); !os.IsNotExist(err) {
+				t.Errorf("the JWK Set was written despite the weak key")
+			}
+		})
+	}
+}
+
+func TestCreateJSONWebKeySetKeyIDStability(t *testing.T) {
+	tests := []struct {
+		name       string
+		firstKeyID string
+		wantKeyID  string
+	}{
+		{name: "computed kid", wantKeyID: fixtureKeyID},
+		{name: "labeled kid", firstKeyID: "signing-2024", wantKeyID: "signing-2024"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newFixtureKeyPairDir(t)
+
+			// The label is only given to the first generation, the second one keeps it
+			for i, keyID := range []string{tt.firstKeyID, ""} {
+				signingKey, err := CreateJSONWebKeySet(dir, JWKSOptions{KeyID: keyID, KeyIDHash: KeyIDHashSHA256, MinKeySize: 2048})
+				if err != nil {
+					t.Fatalf("CreateJSONWebKeySet #%d: %v", i+1, err)
+				}
+				if got, _ := signingKey.KeyID(); got != tt.wantKeyID {
+					t.Errorf("signing kid #%d = %q, want %q", i+1, got, tt.wantKeyID)
+				}
+				key, _ := readTestJWKS(t, dir).Key(0)
+				if got, _ := key.KeyID(); got != tt.wantKeyID {
+					t.Errorf("JWKS kid #%d = %q, want %q", i+1, got, tt.wantKeyID)
+				}
+			}
+
+			signingKey, err := SigningKey(dir, "", KeyIDHashSHA256, nil, 2048)
+			if err != nil {
+				t.Fatalf("SigningKey: %v", err)
+			}
+			if got, _ := signingKey.KeyID(); got != tt.wantKeyID {
+				t.Errorf("JWT kid = %q, want %q", got, tt.wantKeyID)
+			}
+		})
+	}
+}
+
+func TestCreateJSONWebKeySetKeyIDHashChange(t *testing.T) {
+	tests := []struct {
+		name       string
+		firstKeyID string
+		wantKeyID  string
+	}{
+		{name: "computed kid follows the hash", wantKeyID: fixtureSHA1KeyID},
+		{name: "labeled kid is kept", firstKeyID: "signing-2024", wantKeyID: "signing-2024"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newFixtureKeyPairDir(t)
+			if _, err := CreateJSONWebKeySet(dir, JWKSOptions{KeyID: tt.firstKeyID, KeyIDHash: KeyIDHashSHA256, MinKeySize: 2048}); err != nil {
+				t.Fatalf("CreateJSONWebKeySet(sha256): %v", err)
+			}
+
+			signingKey, err := CreateJSONWebKeySet(dir, JWKSOptions{KeyIDHash: KeyIDHashSHA1, MinKeySize: 2048})
+			if err != nil {
+				t.Fatalf("CreateJSONWebKeySet(sha1): %v", err)
+			}
+			if got, _ := signingKey.KeyID(); got != tt.wantKeyID {
+				t.Errorf("signing kid = %q, want %q", got, tt.wantKeyID)
+			}
+			key, _ := readTestJWKS(t, dir).Key(0)
+			if got, _ := key.KeyID(); got != tt.wantKeyID {
+				t.Errorf("JWKS kid = %q, want %q", got, tt.wantKeyID)
+			}
+
+			signingKey, err = SigningKey(dir, "", KeyIDHashSHA1, nil, 2048)
+			if err != nil {
+				t.Fatalf("SigningKey: %v", err)
+			}
+			if got, _ := signingKey.KeyID(); got != tt.wantKeyID {
+				t.Errorf("JWT kid = %q, want %q", got, tt.wantKeyID)
+			}
+		})
+	}
+}
+
+func TestCreatePublicJSONWebKeySetKeepsSigningJWKS(t *testing.T) {
+	dir := newFixtureKeyPairDir(t)
+	if _, err := CreateJSONWebKeySet(dir, JWKSOptions{KeyID: "signing"}); err != nil {
+		t.Fatalf("CreateJSONWebKeySet: %v", err)
+	}
+	signingJWKS, err := os.ReadFile(filepath.Join(dir, TLSDirName, JWKSFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outFile := filepath.Join(t.TempDir(), "public", JWKSFileName)
+	if _, err := CreatePublicJSONWebKeySet(outFile, filepath.Join("testdata", RSAPublicKeyFile), "verifier", KeyIDHashSHA256, "RS256", 0); err != nil {
+		t.Fatalf("CreatePublicJSONWebKeySet: %v", err)
+	}
+
+	set, err := jwk.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("jwk.ReadFile: %v", err)
+	}
+	if key, ok := set.Key(0); !ok || set.Len() != 1 {
+		t.Fatalf("got %d keys, want the public key only", set.Len())
+	} else if kid, _ := key.KeyID(); kid != "verifier" {
+		t.Errorf("kid = %q, want verifier", kid)
+	}
+	if after, err := os.ReadFile(filepath.Join(dir, TLSDirName, JWKSFileName)); err != nil || string(after) != string(signingJWKS) {
+		t.Errorf("the signing JWKS was changed, err = %v", err)
+	}
+}
+
+func TestKeyIDFromPublicKey(t *testing.T) {
+	publicKey, err := ParsePublicKeyFromPEMFile(filepath.Join("testdata", RSAPublicKeyFile))
+	if err != nil {
+		t.Fatalf("ParsePublicKeyFromPEMFile: %v", err)
+	}
+
+	tests := []struct {
+		hash string
+		want string
+	}{
+		{hash: "", want: fixtureKeyID},
+		{hash: KeyIDHashSHA256, want: fixtureKeyID},
+		{hash: KeyIDHashSHA1, want: fixtureSHA1KeyID},
+	}
+
+	for _, tt := range tests {
+		t.Run("hash="+tt.hash, func(t *testing.T) {
+			if got := keyIDFromPublicKey(publicKey, tt.hash); got != tt.want {
+				t.Errorf("keyIDFromPublicKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyIDHashUsedForJWKSAndJWT(t *testing.T) {
+	dir := newFixtureKeyPairDir(t)
+	signingKey, err := CreateJSONWebKeySet(dir, JWKSOptions{KeyIDHash: KeyIDHashSHA1, MinKeySize: 2048})
+	if err != nil {
+		t.Fatalf("CreateJSONWebKeySet: %v", err)
+	}
+	key, _ := readTestJWKS(t, dir).Key(0)
+	if got, _ := key.KeyID(); got != fixtureSHA1KeyID {
+		t.Errorf("JWKS kid = %q, want %q", got, fixtureSHA1KeyID)
+	}
+
+	signedJWT, err := CreateJWT(signingKey, JWTOptions{})
+	if err != nil {
+		t.Fatalf("CreateJWT: %v", err)
+	}
+	message, err := jws.Parse(signedJWT)
+	if err != nil {
+		t.Fatalf("jws.Parse: %v", err)
+	}
+	if got, _ := message.Signatures()[0].ProtectedHeaders().KeyID(); got != fixtureSHA1KeyID {
+		t.Errorf("JWT kid = %q, want %q", got, fixtureSHA1KeyID)
+	}
+}
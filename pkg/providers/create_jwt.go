@@ -3,47 +3,254 @@ package providers
 //
 // Creates a new JWT for use with AWS OIDC STS
 import (
+	"bytes"
+	"crypto"
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/lestrrat-go/jwx/v3/jwa"
 	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
 	"github.com/lestrrat-go/jwx/v3/jwt"
 )
 
+// JWTOptions holds the optional settings applied when signing a JWT.
+type JWTOptions struct {
+	// Issuer is the value of the "iss" claim. Defaults to JWTIssuer when empty.
+	Issuer string
+	// Type is the value of the "typ" protected header. Defaults to JWTType when empty.
+	Type string
+	// Audiences are the values of the "aud" claim. Defaults to JWTAudience when empty.
+	Audiences []string
+	// Subject is the value of the "sub" claim. Defaults to JWTSubject when empty.
+	Subject string
+	// IssuedAt is the value of the "iat" claim. Defaults to the current time when zero.
+	IssuedAt time.Time
+	// Expiration is the value of the "exp" claim. Defaults to JWTLifetime after the "iat"
+	// claim when zero.
+	Expiration time.Time
+	// NotBeforeOffset is added to the "iat" claim to compute the "nbf" claim, e.g. a few
+	// negative seconds to tolerate the clock skew of verifiers. Defaults to nbf equal to iat.
+	NotBeforeOffset time.Duration
+	// Signer signs the JWT instead of the signing key, which then only provides the key ID.
+	// It is set when the private key is not accessible, e.g. held in an HSM.
+	Signer crypto.Signer
+	// JWSFormat is the serialization of the signed JWT: JWSFormatCompact, as expected by OIDC
+	// and STS, or JWSFormatJSON for the general JWS JSON serialization. Defaults to
+	// JWSFormatCompact when empty.
+	JWSFormat string
+}
+
+// generalJWS is the general JWS JSON serialization of RFC 7515 section 7.2.1, with the
+// base64url-encoded payload and a single signature.
+type generalJWS struct {
+	Payload    string                `json:"payload"`
+	Signatures []generalJWSSignature `json:"signatures"`
+}
+
+// generalJWSSignature is a signature of the general JWS JSON serialization, with the
+// base64url-encoded protected header and signature.
+type generalJWSSignature struct {
+	Protected string `json:"protected"`
+	Signature string `json:"signature"`
+}
+
+// SigningKey loads the private key of the key pair in the specified directory as a JWK,
+// with the same key ID as published in the JWKS: keyID when set, otherwise the one the key
+// has in the JWK Set of the directory, or the one computed from the public key with the
+// keyIDHash algorithm. With a signer, its public key is loaded instead, and the JWT must be
+// signed with the signer. Keys smaller than minKeySize, or DefaultMinKeySize when not set,
+// are rejected.
+func SigningKey(filePath, keyID, keyIDHash string, signer Signer, minKeySize int) (jwk.Key, error) {
+	if signer != nil {
+		publicKey, err := signerPublicKey(signer)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkKeySize(publicKey.N.BitLen(), minKeySize); err != nil {
+			return nil, err
+		}
+		keyID, err := keyPairKeyID(filePath, publicKey, keyID, keyIDHash)
+		if err != nil {
+			return nil, err
+		}
+		return signingJWK(publicKey, keyID)
+	}
+
+	privateKey, err := ParsePrivateKeyFromFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	if err := checkKeySize(privateKey.N.BitLen(), minKeySize); err != nil {
+		return nil, err
+	}
+
+	keyID, err = keyPairKeyID(filePath, &privateKey.PublicKey, keyID, keyIDHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return signingJWK(privateKey, keyID)
+}
+
 // CreateJWT generates a signed JWT token using the provided private key.
 //
 // The JWT token includes the following claims:
-// - "iss" (Issuer): The entity that issued the JWT, defined by the constant JWTIssuer.
-// - "aud" (Audience): The intended audience for the JWT, defined by the constant JWTAudience.
-// - "sub" (Subject): The subject of the JWT, defined by the constant JWTSubject.
-// - "exp" (Expiration Time): The expiration time of the JWT, set to 24 hours from the current time.
-// - "iat" (Issued At): The time at which the JWT was issued, set to the current time.
+// - "iss" (Issuer): The entity that issued the JWT, set in opts or defined by the constant JWTIssuer.
+// - "aud" (Audience): The intended audiences of the JWT, set in opts or defined by the constant JWTAudience.
+// - "sub" (Subject): The subject of the JWT, set in opts or defined by the constant JWTSubject.
+// - "exp" (Expiration Time): The expiration time of the JWT, set in opts or to JWTLifetime after "iat".
+// - "iat" (Issued At): The time at which the JWT was issued, set in opts or to the current time.
+// - "nbf" (Not Before): The time before which the JWT is invalid, "iat" shifted by the offset set in opts.
+//
+// Explicit "iat" and "exp" values are meant to replay a specific token in tests, so a token
+// that is already expired or expires far in the future is reported but still created. With a
+// not-before offset, a token whose "nbf" is not before its "exp" would never be valid and is
+// not created.
+//
+// The protected header carries the "typ" set in opts (JWTType by default) and the "kid"
+// of the signing key, so that verifiers can select the matching key from the JWKS.
 //
 // Parameters:
 // - signingKey (jwk.Key): The private key used to sign the JWT.
+// - opts (JWTOptions): The optional settings applied to the token.
 //
 // Returns:
-// - ([]byte): The signed JWT token as a byte slice.
+// - ([]byte): The signed JWT token as a byte slice, in the serialization given by opts.JWSFormat.
 // - (error): An error if the token creation or signing process fails.
-func CreateJWT(signingKey jwk.Key) ([]byte, error) {
+func CreateJWT(signingKey jwk.Key, opts JWTOptions) ([]byte, error) {
+	if opts.JWSFormat != "" && opts.JWSFormat != JWSFormatCompact && opts.JWSFormat != JWSFormatJSON {
+		return nil, fmt.Errorf("unsupported JWS format %q, expected %s or %s", opts.JWSFormat, JWSFormatCompact, JWSFormatJSON)
+	}
+
+	issuer := opts.Issuer
+	if issuer == "" {
+		issuer = JWTIssuer
+	}
+
+	audiences := opts.Audiences
+	if len(audiences) == 0 {
+		audiences = []string{JWTAudience}
+	}
+
+	subject := opts.Subject
+	if subject == "" {
+		subject = JWTSubject
+	}
+
+	now := time.Now()
+	issuedAt := opts.IssuedAt
+	if issuedAt.IsZero() {
+		issuedAt = now
+	}
+	expiration := opts.Expiration
+	if expiration.IsZero() {
+		expiration = issuedAt.Add(JWTLifetime)
+	}
+
+	if !expiration.After(now) {
+		slog.Warn("The JWT is already expired.", slog.Time("exp", expiration))
+	} else if expiration.Sub(now) > JWTFarFutureThreshold {
+		slog.Warn("The JWT expires far in the future.", slog.Time("exp", expiration))
+	}
+	if !expiration.After(issuedAt) {
+		slog.Warn("The JWT expires before it was issued.", slog.Time("iat", issuedAt), slog.Time("exp", expiration))
+	}
+
+	notBefore := issuedAt.Add(opts.NotBeforeOffset)
+	if opts.NotBeforeOffset != 0 && !notBefore.Before(expiration) {
+		return nil, fmt.Errorf("nbf %s must be before exp %s", notBefore.Format(time.RFC3339), expiration.Format(time.RFC3339))
+	}
 
 	// Create a new JWT token with the specified claims
-	token, err := jwt.NewBuilder().Claim("iss", JWTIssuer).
-		Claim("aud", JWTAudience).
-		Claim("sub", JWTSubject).
-		Claim("exp", time.Now().Add(time.Hour*24).Unix()).
-		Claim("iat", time.Now().Unix()).
+	token, err := jwt.NewBuilder().Claim("iss", issuer).
+		Claim("aud", audiences).
+		Claim("sub", subject).
+		Claim("exp", expiration.Unix()).
+		Claim("iat", issuedAt.Unix()).
+		Claim("nbf", notBefore.Unix()).
 		Build()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create JWT token: %w", err)
 	}
 
+	// Set the protected headers so that the token type and key ID are explicit
+	headers := jws.NewHeaders()
+	tokenType := opts.Type
+	if tokenType == "" {
+		tokenType = JWTType
+	}
+	if err := headers.Set(jws.TypeKey, tokenType); err != nil {
+		return nil, fmt.Errorf("failed to set token type header: %w", err)
+	}
+	if keyID, ok := signingKey.KeyID(); ok {
+		if err := headers.Set(jws.KeyIDKey, keyID); err != nil {
+			return nil, fmt.Errorf("failed to set key ID header: %w", err)
+		}
+	}
+
 	// Sign the JWT token using the private key
-	signedJWT, err := jwt.Sign(token, jwt.WithKey(jwa.RS256(), signingKey))
+	var key any = signingKey
+	if opts.Signer != nil {
+		key = opts.Signer
+	}
+	signedJWT, err := jwt.Sign(token, jwt.WithKey(jwa.RS256(), key, jws.WithProtectedHeaders(headers)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign JWT token: %w", err)
 	}
 
+	if opts.JWSFormat == JWSFormatJSON {
+		return generalJSONSerialization(signedJWT)
+	}
+
 	return signedJWT, nil
 }
+
+// generalJSONSerialization converts a JWS in compact serialization into the general JWS JSON
+// serialization. jws.WithJSON is not used, as it produces the flattened JSON serialization
+// for a single signature.
+func generalJSONSerialization(compactJWS []byte) ([]byte, error) {
+	parts := strings.Split(string(compactJWS), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("JWS in compact serialization must have 3 parts, got %d", len(parts))
+	}
+
+	serialized, err := json.Marshal(generalJWS{
+		Payload:    parts[1],
+		Signatures: []generalJWSSignature{{Protected: parts[0], Signature: parts[2]}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JWS JSON serialization: %w", err)
+	}
+
+	return serialized, nil
+}
+
+// TokenExpiration returns the expiration time (exp claim) of the signed JWT, without verifying
+// its signature, e.g. to schedule the refresh of a token created by CreateJWT. The JWT may be in
+// compact or JSON serialization.
+func TokenExpiration(signedJWT []byte) (time.Time, error) {
+	claims := signedJWT
+	if bytes.HasPrefix(bytes.TrimSpace(signedJWT), []byte("{")) {
+		message, err := jws.Parse(signedJWT, jws.WithJSON())
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse JWS JSON serialization: %w", err)
+		}
+		claims = message.Payload()
+	}
+
+	token, err := jwt.ParseInsecure(claims)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse JWT: %w", err)
+	}
+
+	expiration, ok := token.Expiration()
+	if !ok {
+		return time.Time{}, fmt.Errorf("JWT has no exp claim")
+	}
+
+	return expiration, nil
+}
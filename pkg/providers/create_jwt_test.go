@@ -0,0 +1,242 @@
+package providers
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var (
+	testKeyPairOnce        sync.Once
+	testPrivateKeyPEM      []byte
+	testPublicKeyPEM       []byte
+	testKeyPairGenerateErr error
+)
+
+// newTestKeyPairDir returns a temporary directory holding a 2048-bit RSA key pair in the
+// flat layout. The key pair is generated once and shared by the tests.
+func newTestKeyPairDir(t *testing.T) string {
+	t.Helper()
+
+	testKeyPairOnce.Do(func() {
+		testPrivateKeyPEM, testPublicKeyPEM, testKeyPairGenerateErr = generateRSAKeyPairPEM(2048)
+	})
+	if testKeyPairGenerateErr != nil {
+		t.Fatalf("generateRSAKeyPairPEM: %v", testKeyPairGenerateErr)
+	}
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, TLSDirName), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, TLSDirName, RSAPrivateKeyFile), testPrivateKeyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, TLSDirName, RSAPublicKeyFile), testPublicKeyPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCreateJWTKeyIDMatchesJWKS(t *testing.T) {
+	dir := newTestKeyPairDir(t)
+	if _, err := CreateJSONWebKeySet(dir, JWKSOptions{MinKeySize: 2048}); err != nil {
+		t.Fatalf("CreateJSONWebKeySet: %v", err)
+	}
+	signingKey, err := SigningKey(dir, "", "", nil, 2048)
+	if err != nil {
+		t.Fatalf("SigningKey: %v", err)
+	}
+	signedJWT, err := CreateJWT(signingKey, JWTOptions{})
+	if err != nil {
+		t.Fatalf("CreateJWT: %v", err)
+	}
+
+	message, err := jws.Parse(signedJWT)
+	if err != nil {
+		t.Fatalf("jws.Parse: %v", err)
+	}
+	keyID, ok := message.Signatures()[0].ProtectedHeaders().KeyID()
+	if !ok || keyID == "" {
+		t.Fatal("JWT has no kid header")
+	}
+
+	set, err := jwk.ReadFile(filepath.Join(dir, TLSDirName, JWKSFileName))
+	if err != nil {
+		t.Fatalf("jwk.ReadFile: %v", err)
+	}
+	publicKey, ok := set.LookupKeyID(keyID)
+	if !ok {
+		t.Fatalf("kid %q of the JWT is not in the JWKS", keyID)
+	}
+	if _, err := jws.Verify(signedJWT, jws.WithKey(jwa.RS256(), publicKey)); err != nil {
+		t.Errorf("the JWT does not verify with the JWKS key of its kid: %v", err)
+	}
+}
+
+func TestCreateJWTNotBeforeOffset(t *testing.T) {
+	signingKey, err := SigningKey(newTestKeyPairDir(t), "", "", nil, 2048)
+	if err != nil {
+		t.Fatalf("SigningKey: %v", err)
+	}
+	issuedAt := time.Now().Truncate(time.Second)
+	expiration := issuedAt.Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		offset  time.Duration
+		wantErr bool
+	}{
+		{name: "no offset", offset: 0},
+		{name: "negative offset", offset: -30 * time.Second},
+		{name: "positive offset", offset: 5 * time.Minute},
+		{name: "nbf at exp", offset: time.Hour, wantErr: true},
+		{name: "nbf after exp", offset: 2 * time.Hour, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signedJWT, err := CreateJWT(signingKey, JWTOptions{IssuedAt: issuedAt, Expiration: expiration, NotBeforeOffset: tt.offset})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "must be before exp") {
+					t.Fatalf("err = %v, want the nbf >= exp error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateJWT: %v", err)
+			}
+
+			token, err := jwt.ParseInsecure(signedJWT)
+			if err != nil {
+				t.Fatalf("jwt.ParseInsecure: %v", err)
+			}
+			iat, _ := token.IssuedAt()
+			nbf, _ := token.NotBefore()
+			if !iat.Equal(issuedAt) {
+				t.Errorf("iat = %v, want %v", iat, issuedAt)
+			}
+			if want := issuedAt.Add(tt.offset); !nbf.Equal(want) {
+				t.Errorf("nbf = %v, want iat + %v = %v", nbf, tt.offset, want)
+			}
+		})
+	}
+}
+
+func TestCreateJWTExpiredWithoutNotBeforeOffset(t *testing.T) {
+	signingKey, err := SigningKey(newTestKeyPairDir(t), "", "", nil, 2048)
+	if err != nil {
+		t.Fatalf("SigningKey: %v", err)
+	}
+	expiration := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// An expired token is still created to replay it in tests
+	signedJWT, err := CreateJWT(signingKey, JWTOptions{Expiration: expiration})
+	if err != nil {
+		t.Fatalf("CreateJWT: %v", err)
+	}
+	got, err := TokenExpiration(signedJWT)
+	if err != nil {
+		t.Fatalf("TokenExpiration: %v", err)
+	}
+	if !got.Equal(expiration) {
+		t.Errorf("exp = %v, want %v", got, expiration)
+	}
+}
+
+func TestCreateJWTDefaultExpirationFollowsIssuedAt(t *testing.T) {
+	signingKey, err := SigningKey(newTestKeyPairDir(t), "", "", nil, 2048)
+	if err != nil {
+		t.Fatalf("SigningKey: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+	}{
+		{name: "issued in the past", issuedAt: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "issued in the future", issuedAt: time.Now().Add(time.Hour).Truncate(time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signedJWT, err := CreateJWT(signingKey, JWTOptions{IssuedAt: tt.issuedAt})
+			if err != nil {
+				t.Fatalf("CreateJWT: %v", err)
+			}
+			expiration, err := TokenExpiration(signedJWT)
+			if err != nil {
+				t.Fatalf("TokenExpiration: %v", err)
+			}
+			if want := tt.issuedAt.Add(JWTLifetime); !expiration.Equal(want) {
+				t.Errorf("exp = %v, want iat + %v = %v", expiration, JWTLifetime, want)
+			}
+		})
+	}
+}
+
+func TestCreateJWTJSONSerialization(t *testing.T) {
+	dir := newTestKeyPairDir(t)
+	signingKey, err := CreateJSONWebKeySet(dir, JWKSOptions{MinKeySize: 2048})
+	if err != nil {
+		t.Fatalf("CreateJSONWebKeySet: %v", err)
+	}
+	expiration := time.Now().Add(time.Hour).Truncate(time.Second)
+	signedJWT, err := CreateJWT(signingKey, JWTOptions{Expiration: expiration, JWSFormat: JWSFormatJSON})
+	if err != nil {
+		t.Fatalf("CreateJWT: %v", err)
+	}
+
+	var serialized map[string]json.RawMessage
+	if err := json.Unmarshal(signedJWT, &serialized); err != nil {
+		t.Fatalf("the JWT is not a JSON document: %v", err)
+	}
+	if _, ok := serialized["signatures"]; !ok {
+		t.Errorf("JWT %s is not in the general JWS JSON serialization", signedJWT)
+	}
+
+	message, err := jws.Parse(signedJWT, jws.WithJSON())
+	if err != nil {
+		t.Fatalf("jws.Parse: %v", err)
+	}
+	keyID, _ := message.Signatures()[0].ProtectedHeaders().KeyID()
+	publicKey, ok := readTestJWKS(t, dir).LookupKeyID(keyID)
+	if !ok {
+		t.Fatalf("kid %q of the JWT is not in the JWKS", keyID)
+	}
+	payload, err := jws.Verify(signedJWT, jws.WithJSON(), jws.WithKey(jwa.RS256(), publicKey))
+	if err != nil {
+		t.Fatalf("jws.Verify: %v", err)
+	}
+	token, err := jwt.Parse(payload, jwt.WithVerify(false), jwt.WithValidate(true))
+	if err != nil {
+		t.Fatalf("jwt.Parse of the payload: %v", err)
+	}
+	if issuer, _ := token.Issuer(); issuer != JWTIssuer {
+		t.Errorf("iss = %q, want %q", issuer, JWTIssuer)
+	}
+
+	// TokenExpiration reads the payload of the JSON serialization like a compact JWT
+	compactJWT, err := CreateJWT(signingKey, JWTOptions{Expiration: expiration})
+	if err != nil {
+		t.Fatalf("CreateJWT: %v", err)
+	}
+	for format, serializedJWT := range map[string][]byte{JWSFormatJSON: signedJWT, JWSFormatCompact: compactJWT} {
+		got, err := TokenExpiration(serializedJWT)
+		if err != nil {
+			t.Fatalf("TokenExpiration of the %s JWT: %v", format, err)
+		}
+		if !got.Equal(expiration) {
+			t.Errorf("TokenExpiration() of the %s JWT = %v, want %v", format, got, expiration)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	awsProvider "github.com/chuhaoyuu/aws-oidc-sts/pkg/providers/aws"
+)
+
+// CreateLocalIdentityProvider generates the documents of an OIDC identity provider served by
+// the caller, e.g. an internal service, without calling AWS.
+//
+// The key and token inputs of cfg are first checked, reporting every invalid input at once.
+// The function then performs the following steps:
+//  1. Creates the JWKS from the key pair in the output directory.
+//  2. Creates the openid-configuration for the issuer, unless NoDiscovery is set, and its
+//     YAML rendition when DiscoveryYAML is set.
+//  3. Signs a JWT for the issuer and the accepted audiences, and writes it to the JWT file.
+//
+// The issuer is given by IssuerOverride, and the bucket, IAM and trust policy settings of
+// cfg are ignored.
+//
+// It returns the issuer, JWKS URI, key ID and audiences of the generated documents.
+func CreateLocalIdentityProvider(cfg *Config) (*IdentityProviderResult, error) {
+	if cfg.IssuerOverride == "" {
+		return nil, fmt.Errorf("an issuer is required for a local identity provider")
+	}
+	if err := errors.Join(validateKeyConfig(cfg)...); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	jwksOptions := cfg.JWKS
+	jwksOptions.Strict = cfg.Strict
+	jwkKey, err := CreateJSONWebKeySet(cfg.OutputDir, jwksOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JSON Web Key Set: %w", err)
+	}
+
+	jwksURI := cfg.Issuer() + "/" + JWKSObjectKey
+	if !cfg.NoDiscovery {
+		discovery, err := CreateOpenIDConfiguration(cfg.OutputDir, cfg.Issuer())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create openid-configuration: %w", err)
+		}
+		if cfg.DiscoveryYAML {
+			if err := WriteOpenIDConfigurationYAML(cfg.OutputDir, discovery); err != nil {
+				return nil, err
+			}
+		}
+		jwksURI = discovery.JWKSURI
+	}
+
+	jwtOptions := cfg.JWT
+	jwtOptions.Issuer = cfg.Issuer()
+	jwtOptions.Subject = cfg.Subject()
+	if len(jwtOptions.Audiences) == 0 {
+		jwtOptions.Audiences = cfg.AcceptedAudiences()
+	}
+	if err := awsProvider.ValidateAudiences(jwtOptions.Audiences, cfg.AcceptedAudiences()); err != nil {
+		return nil, fmt.Errorf("invalid JWT audiences: %w", err)
+	}
+	if cfg.JWKS.Signer != nil {
+		jwtOptions.Signer = cfg.JWKS.Signer
+	}
+	signedJWT, err := CreateJWT(jwkKey, jwtOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWT: %w", err)
+	}
+
+	jwtFilePath := filepath.Join(cfg.OutputDir, TLSDirName, JWTFileName)
+	if err := writeFileAtomic(jwtFilePath, signedJWT, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write JWT to file: %w", err)
+	}
+	slog.Info("JWT written to", slog.String("file", jwtFilePath))
+
+	tokenExpiration, err := TokenExpiration(signedJWT)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, _ := jwkKey.KeyID()
+	return &IdentityProviderResult{
+		Issuer:          cfg.Issuer(),
+		JWKSURI:         jwksURI,
+		KeyID:           keyID,
+		Subject:         cfg.Subject(),
+		Audiences:       cfg.AcceptedAudiences(),
+		TokenExpiration: tokenExpiration,
+	}, nil
+}
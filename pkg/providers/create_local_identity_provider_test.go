@@ -0,0 +1,47 @@
+package providers
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCreateLocalIdentityProviderTokenExpiration(t *testing.T) {
+	dir := newTestKeyPairDir(t)
+	expiration := time.Now().Add(time.Hour).Truncate(time.Second)
+	result, err := CreateLocalIdentityProvider(&Config{
+		OutputDir:      dir,
+		IssuerOverride: "https://auth.internal.example.com",
+		JWKS:           JWKSOptions{MinKeySize: 2048},
+		JWT:            JWTOptions{Expiration: expiration},
+	})
+	if err != nil {
+		t.Fatalf("CreateLocalIdentityProvider: %v", err)
+	}
+
+	if !result.TokenExpiration.Equal(expiration) {
+		t.Errorf("token expiration = %v, want the exp claim %v", result.TokenExpiration, expiration)
+	}
+	signedJWT, err := os.ReadFile(filepath.Join(dir, TLSDirName, JWTFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := TokenExpiration(signedJWT); err != nil || !got.Equal(result.TokenExpiration) {
+		t.Errorf("exp of the written JWT = %v (%v), want %v", got, err, result.TokenExpiration)
+	}
+
+	// The expiration is left out of the serialized result, e.g. of manifests
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var serialized map[string]any
+	if err := json.Unmarshal(resultJSON, &serialized); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := serialized["TokenExpiration"]; ok {
+		t.Errorf("the serialized result %s has the token expiration", resultJSON)
+	}
+}
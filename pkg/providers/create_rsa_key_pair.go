@@ -7,25 +7,53 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 )
 
+// RSAKeyPairOptions holds the optional settings applied when generating an RSA key pair.
+type RSAKeyPairOptions struct {
+	// PrivateKeyWriter and PublicKeyWriter receive the PEM-encoded private and public keys
+	// instead of the key files, e.g. to stream them to a secret store. Both must be set
+	// together; the key files are written when they are nil.
+	PrivateKeyWriter io.Writer
+	PublicKeyWriter  io.Writer
+	// Bits is the size of the generated key. Defaults to DefaultRSAKeySize.
+	Bits int
+	// MinKeySize is the smallest key size allowed. Defaults to DefaultMinKeySize.
+	MinKeySize int
+	// Layout is the layout of the key files, KeyLayoutFlat or KeyLayoutNested (see KeyLayout).
+	// Defaults to KeyLayoutFlat.
+	Layout string
+	// KeyIDHash is the hash algorithm of the key ID naming the directory of the key pair in the
+	// nested layout. Defaults to KeyIDHashSHA256.
+	KeyIDHash string
+}
+
 // CreateRSAKeyPair generates an RSA key pair (private and public keys) and saves them to the specified file path.
 // If the key pair already exists at the specified location, the function skips the generation process.
 //
 // Parameters:
 //   - keyPairFilePath: The base directory where the RSA key pair will be stored. The private key will be saved
 //     as a file named "RSAPrivateKeyFile" and the public key as "RSAPublicKeyFile" within a subdirectory.
+//   - opts: The options applied to the key pair. When its writers are set, the keys are written to them
+//     instead, and keyPairFilePath is not used.
 //
 // Behavior:
 //   - Creates the necessary directory structure if it does not exist.
 //   - Checks if the private and public key files already exist. If both files are present, the function logs
 //     a warning and skips the key generation process.
-//   - If the key pair does not exist, generates a 4096-bit RSA private key and derives the public key from it.
+//   - Rejects a key size of opts.Bits (4096 bits by default) below opts.MinKeySize.
+//   - If the key pair does not exist, generates an RSA private key of that size and derives the public key from it.
 //   - Encodes the private key in PEM format and writes it to the private key file with restricted permissions (0600).
 //   - Encodes the public key in PEM format and writes it to the public key file with read permissions (0644).
+//   - Both files are written to temporary files renamed into place together, so that they are either
+//     both complete or both absent, even when interrupted.
+//   - With the nested opts.Layout, the files are written to a subdirectory named by the key ID of
+//     the key pair, which is made the active key pair. An existing key pair in the other layout
+//     is reported as an error.
 //
 // Returns:
 //   - An error if any step in the process fails, such as directory creation, key generation, or file writing.
@@ -33,8 +61,35 @@ import (
 //
 // Logging:
 //   - Logs informational messages during the process, including warnings if the key pair already exists.
-//   - Logs debug messages for successful file writes.
-func CreateRSAKeyPair(keyPairFilePath string) error {
+func CreateRSAKeyPair(keyPairFilePath string, opts RSAKeyPairOptions) error {
+
+	if (opts.PrivateKeyWriter == nil) != (opts.PublicKeyWriter == nil) {
+		return fmt.Errorf("both the private and public key writers must be set")
+	}
+	bits := opts.Bits
+	if bits <= 0 {
+		bits = DefaultRSAKeySize
+	}
+	if err := checkKeySize(bits, opts.MinKeySize); err != nil {
+		return err
+	}
+	if err := ValidateKeyLayout(opts.Layout); err != nil {
+		return err
+	}
+
+	if opts.PrivateKeyWriter != nil {
+		privateKeyPEM, publicKeyPEM, err := generateRSAKeyPairPEM(bits)
+		if err != nil {
+			return err
+		}
+		if _, err := opts.PrivateKeyWriter.Write(privateKeyPEM); err != nil {
+			return fmt.Errorf("failed to write private key: %w", err)
+		}
+		if _, err := opts.PublicKeyWriter.Write(publicKeyPEM); err != nil {
+			return fmt.Errorf("failed to write public key: %w", err)
+		}
+		return nil
+	}
 
 	RSAKeyDir := filepath.Join(keyPairFilePath, TLSDirName)
 	if err := os.MkdirAll(RSAKeyDir, 0755); err != nil {
@@ -42,6 +97,14 @@ func CreateRSAKeyPair(keyPairFilePath string) error {
 	}
 	privateKeyFile := filepath.Join(RSAKeyDir, RSAPrivateKeyFile)
 	publicKeyFile := filepath.Join(RSAKeyDir, RSAPublicKeyFile)
+
+	if opts.Layout == KeyLayoutNested {
+		return createNestedRSAKeyPair(keyPairFilePath, privateKeyFile, bits, opts.KeyIDHash)
+	}
+	if KeyLayout(keyPairFilePath) == KeyLayoutNested {
+		return fmt.Errorf("the key pair of %s uses the %s layout", keyPairFilePath, KeyLayoutNested)
+	}
+
 	skipGeneration := false
 
 	if _, err := os.Stat(privateKeyFile); err == nil {
@@ -58,13 +121,62 @@ func CreateRSAKeyPair(keyPairFilePath string) error {
 		return nil
 	}
 
+	privateKeyPEM, publicKeyPEM, err := generateRSAKeyPairPEM(bits)
+	if err != nil {
+		return err
+	}
+
+	// Write both keys to temporary files renamed into place together, so that an interrupted
+	// run never leaves a private key without its public key
+	slog.Info("Writing private key to", slog.String("file", privateKeyFile))
+	slog.Info("Writing public key to", slog.String("file", publicKeyFile))
+	if err := writeFilesAtomic(
+		atomicFile{name: privateKeyFile, data: privateKeyPEM, perm: 0600},
+		atomicFile{name: publicKeyFile, data: publicKeyPEM, perm: 0644},
+	); err != nil {
+		return fmt.Errorf("failed to write RSA key pair to files: %w", err)
+	}
+	slog.Info("RSA key pair generated successfully.")
+
+	return nil
+}
+
+// createNestedRSAKeyPair generates a key pair in its own subdirectory of the nested layout and
+// makes it the active key pair, unless the directory already has an active key pair.
+func createNestedRSAKeyPair(keyPairFilePath, flatPrivateKeyFile string, bits int, keyIDHash string) error {
+	if KeyLayout(keyPairFilePath) == KeyLayoutNested {
+		slog.Info("RSA key pair already exists, skipping creation.")
+		return nil
+	}
+	if _, err := os.Stat(flatPrivateKeyFile); err == nil {
+		return fmt.Errorf("the key pair of %s uses the %s layout", keyPairFilePath, KeyLayoutFlat)
+	}
+
+	privateKeyPEM, publicKeyPEM, err := generateRSAKeyPairPEM(bits)
+	if err != nil {
+		return err
+	}
+	keyID, err := writeNestedKeyPair(keyPairFilePath, privateKeyPEM, publicKeyPEM, keyIDHash)
+	if err != nil {
+		return err
+	}
+	if err := setActiveNestedKeyID(keyPairFilePath, keyID); err != nil {
+		return err
+	}
+	slog.Info("RSA key pair generated successfully.", slog.String("kid", keyID))
+
+	return nil
+}
+
+// generateRSAKeyPairPEM generates an RSA key pair of the given size and returns the PEM encoding
+// of the PKCS#1 private key and of the PKIX public key.
+func generateRSAKeyPairPEM(bitSize int) ([]byte, []byte, error) {
 	// Generate RSA private key
-	slog.Info("Generating RSA key pair...")
+	slog.Info("Generating RSA key pair...", slog.Int("bits", bitSize))
 
-	bitSize := 4096
 	privateKey, err := rsa.GenerateKey(rand.Reader, bitSize)
 	if err != nil {
-		return fmt.Errorf("failed to generate RSA private key: %w", err)
+		return nil, nil, fmt.Errorf("failed to generate RSA private key: %w", err)
 	}
 
 	// Encode private key to PEM format
@@ -80,28 +192,25 @@ func CreateRSAKeyPair(keyPairFilePath string) error {
 	// Encode public key to PEM format
 	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
 	if err != nil {
-		return fmt.Errorf("failed to marshal public key: %w", err)
+		return nil, nil, fmt.Errorf("failed to marshal public key: %w", err)
 	}
 	publicKeyPEM := pem.EncodeToMemory(&pem.Block{
 		Type:  "PUBLIC KEY",
 		Bytes: publicKeyBytes,
 	})
 
-	// Write private key to file
-	slog.Info("Writing private key to", slog.String("file", privateKeyFile))
-	err = os.WriteFile(privateKeyFile, privateKeyPEM, 0600)
-	if err != nil {
-		return fmt.Errorf("failed to write private key to file: %w", err)
-	}
-	slog.Debug("Private key written successfully", slog.String("file", privateKeyFile))
+	return privateKeyPEM, publicKeyPEM, nil
+}
 
-	// Write public key to file
-	slog.Info("Writing public key to", slog.String("file", publicKeyFile))
-	err = os.WriteFile(publicKeyFile, publicKeyPEM, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to write public key to file: %w", err)
+// checkKeySize returns an error naming both sizes when an RSA key of the given size is smaller
+// than minKeySize, or than DefaultMinKeySize when minKeySize is not set. It is the single weak
+// key guard applied to generated, imported and published keys.
+func checkKeySize(bits, minKeySize int) error {
+	if minKeySize <= 0 {
+		minKeySize = DefaultMinKeySize
+	}
+	if bits < minKeySize {
+		return fmt.Errorf("RSA key of %d bits is smaller than the minimum key size of %d bits", bits, minKeySize)
 	}
-	slog.Info("RSA key pair generated successfully.")
-
 	return nil
 }
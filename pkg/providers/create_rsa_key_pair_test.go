@@ -0,0 +1,94 @@
+package providers
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateRSAKeyPairWriters(t *testing.T) {
+	dir := t.TempDir()
+	var privateKeyPEM, publicKeyPEM bytes.Buffer
+	err := CreateRSAKeyPair(dir, RSAKeyPairOptions{
+		PrivateKeyWriter: &privateKeyPEM,
+		PublicKeyWriter:  &publicKeyPEM,
+		Bits:             2048,
+		MinKeySize:       2048,
+	})
+	if err != nil {
+		t.Fatalf("CreateRSAKeyPair: %v", err)
+	}
+
+	block, rest := pem.Decode(privateKeyPEM.Bytes())
+	if block == nil || block.Type != "RSA PRIVATE KEY" || len(rest) != 0 {
+		t.Fatalf("private key is not a single RSA PRIVATE KEY PEM block: %q", privateKeyPEM.String())
+	}
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("ParsePKCS1PrivateKey: %v", err)
+	}
+	if bits := privateKey.N.BitLen(); bits != 2048 {
+		t.Errorf("private key size = %d bits, want 2048", bits)
+	}
+
+	block, rest = pem.Decode(publicKeyPEM.Bytes())
+	if block == nil || block.Type != "PUBLIC KEY" || len(rest) != 0 {
+		t.Fatalf("public key is not a single PUBLIC KEY PEM block: %q", publicKeyPEM.String())
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("ParsePKIXPublicKey: %v", err)
+	}
+	if rsaPublicKey, ok := publicKey.(*rsa.PublicKey); !ok || !rsaPublicKey.Equal(&privateKey.PublicKey) {
+		t.Error("public key does not match the private key")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, TLSDirName)); !os.IsNotExist(err) {
+		t.Errorf("key files were written to %s with writers set", dir)
+	}
+}
+
+func TestCreateRSAKeyPairRequiresBothWriters(t *testing.T) {
+	var privateKeyPEM bytes.Buffer
+	err := CreateRSAKeyPair(t.TempDir(), RSAKeyPairOptions{PrivateKeyWriter: &privateKeyPEM, Bits: 2048})
+	if err == nil {
+		t.Fatal("CreateRSAKeyPair accepted a private key writer without a public key writer")
+	}
+	if privateKeyPEM.Len() != 0 {
+		t.Error("the private key was written")
+	}
+}
+
+func TestCreateRSAKeyPairMinKeySize(t *testing.T) {
+	tests := []struct {
+		name    string
+		bits    int
+		minSize int
+		wantErr string
+	}{
+		{name: "below configured minimum", bits: 2048, minSize: 3072,
+			wantErr: "RSA key of 2048 bits is smaller than the minimum key size of 3072 bits"},
+		{name: "below default minimum", bits: 1024,
+			wantErr: "RSA key of 1024 bits is smaller than the minimum key size of 2048 bits"},
+		{name: "default size above configured minimum", minSize: 8192,
+			wantErr: "RSA key of 4096 bits is smaller than the minimum key size of 8192 bits"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := CreateRSAKeyPair(dir, RSAKeyPairOptions{Bits: tt.bits, MinKeySize: tt.minSize})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			if _, err := os.Stat(filepath.Join(dir, TLSDirName)); !os.IsNotExist(err) {
+				t.Errorf("key files were written despite the weak key size")
+			}
+		})
+	}
+}
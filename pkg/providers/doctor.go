@@ -0,0 +1,296 @@
+package providers
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsProvider "github.com/chuhaoyuu/aws-oidc-sts/pkg/providers/aws"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// DoctorSessionName is the role session name of the test AssumeRoleWithWebIdentity call.
+const DoctorSessionName = "aws-oidc-sts-doctor"
+
+// DoctorOptions holds the settings of the diagnostics run by Doctor.
+type DoctorOptions struct {
+	// Config locates the key pair (OutputDir), the issuer (IssuerOverride, or BucketName and
+	// Region) and configures the AWS client. Its JWKS.KeyID is the key ID published in the JWKS
+	// and its JWT.Subject the subject trusted by the role, which defaults to the role name. Its
+	// Audiences are the client IDs expected on the IAM OIDC provider, and its JWT.Audiences the
+	// audiences of the test token, which default to all of them.
+	Config *Config
+	// RoleARN is the ARN of the role assumed with the identity provider tokens. The role
+	// checks are skipped when empty.
+	RoleARN string
+}
+
+// DoctorCheck is the outcome of a single diagnostic.
+type DoctorCheck struct {
+	// Name describes what is checked.
+	Name string
+	// Err is the reason the check failed, or nil when it passed.
+	Err error
+	// Hint suggests how to fix a failed check.
+	Hint string
+}
+
+// OK reports whether the check passed.
+func (c DoctorCheck) OK() bool {
+	return c.Err == nil
+}
+
+// Doctor runs a battery of diagnostics over the OIDC setup, from the local key pair to an
+// actual AssumeRoleWithWebIdentity call, and returns the outcome of each of them.
+//
+// Every check runs even when a previous one failed, so that all the problems are reported
+// at once; a check depending on a failed one reports the same underlying error.
+//
+// The checks are, in order:
+//  1. The key pair is present and its public key matches the private key.
+//  2. The local JWKS parses, is valid and publishes the key pair.
+//  3. The issuer is an https URL in the normalized form IAM and STS compare tokens against.
+//  4. The discovery document is reachable under the issuer and valid.
+//  5. The JWKS is reachable at the jwks_uri and publishes the key pair.
+//  6. The IAM OIDC provider exists for the issuer.
+//  7. The provider client IDs include the configured audiences.
+//  8. The provider thumbprints include the one of the JWKS host.
+//  9. The trust policy of the role allows the provider for the token claims (with RoleARN).
+//  10. A token signed with the key pair is exchanged for credentials of the role (with RoleARN).
+func Doctor(opts DoctorOptions) []DoctorCheck {
+	cfg := opts.Config
+	issuer := cfg.Issuer()
+	audiences := cfg.AcceptedAudiences()
+	tokenAudiences := cfg.JWT.Audiences
+	if len(tokenAudiences) == 0 {
+		tokenAudiences = audiences
+	}
+	var checks []DoctorCheck
+	check := func(name, hint string, fn func() error) {
+		checks = append(checks, DoctorCheck{Name: name, Err: fn(), Hint: hint})
+	}
+
+	var privateKey *rsa.PrivateKey
+	keyID := cfg.JWKS.KeyID
+	check("Key pair is present and matching",
+		"Run \"create rsa-key-pair\" with the same --output-dir, or restore the key pair.",
+		func() error {
+			var err error
+			privateKey, err = ParsePrivateKeyFromFile(cfg.OutputDir)
+			if err != nil {
+				return err
+			}
+			publicKey, err := ParsePublicKeyFromFile(cfg.OutputDir)
+			if err != nil {
+				return err
+			}
+			if rsaPublicKey, ok := publicKey.(*rsa.PublicKey); !ok || !rsaPublicKey.Equal(&privateKey.PublicKey) {
+				return fmt.Errorf("public key does not match the private key")
+			}
+			keyID, err = keyPairKeyID(cfg.OutputDir, &privateKey.PublicKey, keyID, cfg.JWKS.KeyIDHash)
+			return err
+		})
+
+	check("Local JWKS is valid and publishes the key pair",
+		"Run \"create identity-provider\" to regenerate the JWKS, with the same --kid if one was used.",
+		func() error {
+			data, err := os.ReadFile(filepath.Join(cfg.OutputDir, TLSDirName, JWKSFileName))
+			if err != nil {
+				return fmt.Errorf("failed to read JWKS: %w", err)
+			}
+			set, err := jwk.Parse(data)
+			if err != nil {
+				return fmt.Errorf("failed to parse JWKS: %w", err)
+			}
+			if err := validateJWKSet(set); err != nil {
+				return err
+			}
+			return checkPublishedKey(set, keyID, privateKey)
+		})
+
+	check("Issuer is normalized",
+		"Use an https issuer URL without trailing slash, query or fragment, exactly as in the \"iss\" claim.",
+		func() error {
+			if cfg.IssuerOverride != "" {
+				return checkIssuer(cfg.IssuerOverride)
+			}
+			return checkIssuer(issuer)
+		})
+
+	jwksURI := issuer + "/" + JWKSObjectKey
+	check("Discovery document is reachable and valid",
+		"Publish the openid-configuration at "+issuer+"/"+OpenIDConfigurationObjectKey+" and make it publicly readable.",
+		func() error {
+			discovery, err := FetchOpenIDConfiguration(issuer)
+			if err != nil {
+				return err
+			}
+			jwksURI = discovery.JWKSURI
+			return nil
+		})
+
+	check("JWKS is reachable and publishes the key pair",
+		"Upload the local JWKS to the jwks_uri of the discovery document and make it publicly readable.",
+		func() error {
+			set, err := FetchJWKS(jwksURI)
+			if err != nil {
+				return err
+			}
+			return checkPublishedKey(set, keyID, privateKey)
+		})
+
+	clientOptions := cfg.ClientOptions()
+	var awsCfg aws.Config
+	var provider awsProvider.OIDCProvider
+	check("IAM OIDC provider exists",
+		"Run \"create identity-provider\" to create the IAM OIDC provider for the issuer.",
+		func() error {
+			var err error
+			awsCfg, err = awsProvider.AwsClient(clientOptions)
+			if err != nil {
+				return fmt.Errorf("failed to create AWS client: %w", err)
+			}
+			accountID, err := awsProvider.AccountID(awsCfg, clientOptions)
+			if err != nil {
+				return err
+			}
+			service := &awsProvider.IAMService{Client: awsProvider.NewIAMClient(awsCfg, clientOptions)}
+			provider, err = service.GetOIDCProvider(context.TODO(), awsProvider.OIDCProviderARN(accountID, issuer))
+			return err
+		})
+
+	check("IAM OIDC provider client IDs include the audiences",
+		"Add "+strings.Join(audiences, ", ")+" to the client IDs of the IAM OIDC provider.",
+		func() error {
+			if provider.ARN == "" {
+				return fmt.Errorf("IAM OIDC provider not found")
+			}
+			for _, audience := range audiences {
+				if !slices.Contains(provider.ClientIDs, audience) {
+					return fmt.Errorf("client IDs %v do not include %s", provider.ClientIDs, audience)
+				}
+			}
+			return nil
+		})
+
+	check("IAM OIDC provider thumbprint matches the JWKS host",
+		"Update the thumbprints of the IAM OIDC provider with the one of the JWKS host certificate chain.",
+		func() error {
+			if provider.ARN == "" {
+				return fmt.Errorf("IAM OIDC provider not found")
+			}
+			thumbprint, err := FetchThumbprint(jwksURI)
+			if err != nil {
+				return err
+			}
+			for _, t := range provider.Thumbprints {
+				if strings.EqualFold(t, thumbprint) {
+					return nil
+				}
+			}
+			return fmt.Errorf("thumbprints %v do not include %s", provider.Thumbprints, thumbprint)
+		})
+
+	if opts.RoleARN == "" {
+		return checks
+	}
+
+	// Without an explicit subject, the role was created with its name as subject.
+	subject := cfg.Subject()
+	if cfg.JWT.Subject == "" && cfg.RoleName == "" {
+		if roleName, err := awsProvider.RoleNameFromARN(opts.RoleARN); err == nil {
+			subject = roleName
+		}
+	}
+
+	check("Role trust policy matches the token",
+		"Update the trust policy of the role, e.g. with the output of the trust-policy command.",
+		func() error {
+			if provider.ARN == "" {
+				return fmt.Errorf("IAM OIDC provider not found")
+			}
+			roleName, err := awsProvider.RoleNameFromARN(opts.RoleARN)
+			if err != nil {
+				return err
+			}
+			service := &awsProvider.IAMService{Client: awsProvider.NewIAMClient(awsCfg, clientOptions)}
+			document, err := service.GetRoleTrustPolicy(context.TODO(), roleName)
+			if err != nil {
+				return err
+			}
+			return awsProvider.CheckTrustPolicy(document, awsProvider.TrustPolicyInput{
+				ProviderARN: provider.ARN,
+				Issuer:      issuer,
+				Audiences:   tokenAudiences,
+				Subject:     subject,
+			})
+		})
+
+	check("AssumeRoleWithWebIdentity succeeds",
+		"Fix the failed checks above; STS errors such as InvalidIdentityToken name the offending part.",
+		func() error {
+			signingKey, err := SigningKey(cfg.OutputDir, cfg.JWKS.KeyID, cfg.JWKS.KeyIDHash, nil, cfg.JWKS.MinKeySize)
+			if err != nil {
+				return err
+			}
+			token, err := CreateJWT(signingKey, JWTOptions{Issuer: issuer, Subject: subject, Audiences: tokenAudiences})
+			if err != nil {
+				return err
+			}
+			_, err = awsProvider.AssumeRoleWithWebIdentity(awsCfg, clientOptions, opts.RoleARN, string(token), DoctorSessionName)
+			return err
+		})
+
+	return checks
+}
+
+// checkPublishedKey checks that the JWK Set publishes the public key of privateKey under keyID.
+func checkPublishedKey(set jwk.Set, keyID string, privateKey *rsa.PrivateKey) error {
+	if privateKey == nil {
+		return fmt.Errorf("key pair not available")
+	}
+
+	key, ok := set.LookupKeyID(keyID)
+	if !ok {
+		return fmt.Errorf("key ID %s not found in JWKS", keyID)
+	}
+
+	var publicKey rsa.PublicKey
+	if err := jwk.Export(key, &publicKey); err != nil {
+		return fmt.Errorf("failed to export key %s: %w", keyID, err)
+	}
+	if !publicKey.Equal(&privateKey.PublicKey) {
+		return fmt.Errorf("key %s in JWKS does not match the key pair", keyID)
+	}
+
+	return nil
+}
+
+// checkIssuer checks that the issuer is an https URL with a host and without trailing slash,
+// query or fragment, so that it compares equal to the "iss" claim and the IAM provider URL.
+func checkIssuer(issuer string) error {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return fmt.Errorf("failed to parse issuer %s: %w", issuer, err)
+	}
+	switch {
+	case u.Scheme != "https":
+		return fmt.Errorf("issuer %s must use https", issuer)
+	case u.Host == "":
+		return fmt.Errorf("issuer %s has no host", issuer)
+	case u.Host != strings.ToLower(u.Host):
+		return fmt.Errorf("issuer %s host must be lowercase", issuer)
+	case strings.HasSuffix(issuer, "/"):
+		return fmt.Errorf("issuer %s must not end with a slash", issuer)
+	case u.RawQuery != "" || u.Fragment != "":
+		return fmt.Errorf("issuer %s must not have a query or fragment", issuer)
+	}
+
+	return nil
+}
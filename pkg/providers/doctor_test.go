@@ -0,0 +1,228 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	awsProvider "github.com/chuhaoyuu/aws-oidc-sts/pkg/providers/aws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+const doctorTestAccountID = "123456789012"
+
+// fakeDoctorAWS answers the STS and IAM query API calls made by Doctor: the caller identity,
+// the IAM OIDC provider with clientIDs, or NoSuchEntity when nil, the role with trustPolicy,
+// and AssumeRoleWithWebIdentity, recording the audiences of the exchanged token.
+type fakeDoctorAWS struct {
+	clientIDs      []string
+	trustPolicy    []byte
+	tokenAudiences []string
+}
+
+func (f *fakeDoctorAWS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	switch r.Form.Get("Action") {
+	case "GetCallerIdentity":
+		fmt.Fprintf(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><GetCallerIdentityResult>`+
+			`<Account>%s</Account><Arn>arn:aws:iam::%[1]s:user/test</Arn><UserId>AIDA</UserId>`+
+			`</GetCallerIdentityResult></GetCallerIdentityResponse>`, doctorTestAccountID)
+	case "GetOpenIDConnectProvider":
+		if f.clientIDs == nil {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>NoSuchEntity</Code>`+
+				`<Message>provider not found</Message></Error></ErrorResponse>`)
+			return
+		}
+		fmt.Fprint(w, `<GetOpenIDConnectProviderResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/"><GetOpenIDConnectProviderResult><ClientIDList>`)
+		for _, clientID := range f.clientIDs {
+			fmt.Fprintf(w, "<member>%s</member>", clientID)
+		}
+		fmt.Fprint(w, `</ClientIDList><ThumbprintList><member>0000000000000000000000000000000000000000</member></ThumbprintList>`+
+			`</GetOpenIDConnectProviderResult></GetOpenIDConnectProviderResponse>`)
+	case "GetRole":
+		fmt.Fprintf(w, `<GetRoleResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/"><GetRoleResult><Role>`+
+			`<Path>/</Path><RoleName>my-role</RoleName><RoleId>AROA</RoleId><Arn>%s</Arn><CreateDate>2024-01-01T00:00:00Z</CreateDate>`+
+			`<AssumeRolePolicyDocument>%s</AssumeRolePolicyDocument></Role></GetRoleResult></GetRoleResponse>`,
+			awsProvider.RoleARN(doctorTestAccountID, "my-role"), url.QueryEscape(string(f.trustPolicy)))
+	case "AssumeRoleWithWebIdentity":
+		token, err := jwt.ParseInsecure([]byte(r.Form.Get("WebIdentityToken")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.tokenAudiences, _ = token.Audience()
+		fmt.Fprint(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleWithWebIdentityResult>`+
+			`<Credentials><AccessKeyId>ASIA</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>session</SessionToken>`+
+			`<Expiration>2030-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`)
+	default:
+		http.Error(w, "unexpected action "+r.Form.Get("Action"), http.StatusBadRequest)
+	}
+}
+
+// newDoctorIssuer serves the discovery document and the JWKS of the key pair in dir over
+// TLS, trusted by the HTTP clients of the package for the duration of the test, and returns
+// the issuer URL.
+func newDoctorIssuer(t *testing.T, dir string) string {
+	t.Helper()
+
+	jwks, err := os.ReadFile(filepath.Join(dir, TLSDirName, JWKSFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var issuer string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + OpenIDConfigurationObjectKey:
+			json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/" + JWKSObjectKey})
+		case "/" + JWKSObjectKey:
+			w.Write(jwks)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	issuer = server.URL
+
+	transport := http.DefaultTransport
+	http.DefaultTransport = server.Client().Transport
+	t.Cleanup(func() { http.DefaultTransport = transport })
+
+	return issuer
+}
+
+func TestDoctor(t *testing.T) {
+	const (
+		keyPairCheck     = "Key pair is present and matching"
+		localJWKSCheck   = "Local JWKS is valid and publishes the key pair"
+		issuerCheck      = "Issuer is normalized"
+		discoveryCheck   = "Discovery document is reachable and valid"
+		jwksCheck        = "JWKS is reachable and publishes the key pair"
+		providerCheck    = "IAM OIDC provider exists"
+		clientIDsCheck   = "IAM OIDC provider client IDs include the audiences"
+		trustPolicyCheck = "Role trust policy matches the token"
+		assumeRoleCheck  = "AssumeRoleWithWebIdentity succeeds"
+		serviceAudience  = "my-service"
+	)
+
+	tests := []struct {
+		name string
+		// audiences are the configured audiences, and clientIDs those of the IAM OIDC provider,
+		// which is missing when nil.
+		audiences []string
+		clientIDs []string
+		// trustedSubject and trustedAudiences are the claims trusted by the role.
+		trustedSubject   string
+		trustedAudiences []string
+		want             map[string]bool
+		wantAudiences    []string
+	}{
+		{
+			name:             "healthy setup",
+			clientIDs:        []string{JWTAudience},
+			trustedSubject:   "my-role",
+			trustedAudiences: []string{JWTAudience},
+			want: map[string]bool{keyPairCheck: true, localJWKSCheck: true, issuerCheck: true, discoveryCheck: true,
+				jwksCheck: true, providerCheck: true, clientIDsCheck: true, trustPolicyCheck: true, assumeRoleCheck: true},
+			wantAudiences: []string{JWTAudience},
+		},
+		{
+			name:             "every configured audience",
+			audiences:        []string{JWTAudience, serviceAudience},
+			clientIDs:        []string{JWTAudience, serviceAudience},
+			trustedSubject:   "my-role",
+			trustedAudiences: []string{serviceAudience},
+			want:             map[string]bool{clientIDsCheck: true, trustPolicyCheck: true, assumeRoleCheck: true},
+			wantAudiences:    []string{JWTAudience, serviceAudience},
+		},
+		{
+			name:             "configured audience missing from the client IDs",
+			audiences:        []string{JWTAudience, serviceAudience},
+			clientIDs:        []string{JWTAudience},
+			trustedSubject:   "my-role",
+			trustedAudiences: []string{JWTAudience},
+			want:             map[string]bool{providerCheck: true, clientIDsCheck: false, trustPolicyCheck: true},
+		},
+		{
+			name:             "trust policy for another subject",
+			clientIDs:        []string{JWTAudience},
+			trustedSubject:   "other-role",
+			trustedAudiences: []string{JWTAudience},
+			want:             map[string]bool{clientIDsCheck: true, trustPolicyCheck: false},
+		},
+		{
+			name:             "provider missing",
+			trustedSubject:   "my-role",
+			trustedAudiences: []string{JWTAudience},
+			want: map[string]bool{keyPairCheck: true, discoveryCheck: true, providerCheck: false,
+				clientIDsCheck: false, trustPolicyCheck: false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newTestKeyPairDir(t)
+			if _, err := CreateJSONWebKeySet(dir, JWKSOptions{}); err != nil {
+				t.Fatalf("CreateJSONWebKeySet: %v", err)
+			}
+			issuer := newDoctorIssuer(t, dir)
+
+			trustPolicy, err := awsProvider.RenderTrustPolicy(awsProvider.TrustPolicyInput{
+				ProviderARN: awsProvider.OIDCProviderARN(doctorTestAccountID, issuer),
+				Issuer:      issuer,
+				Audiences:   tt.trustedAudiences,
+				Subject:     tt.trustedSubject,
+			})
+			if err != nil {
+				t.Fatalf("RenderTrustPolicy: %v", err)
+			}
+			fake := &fakeDoctorAWS{clientIDs: tt.clientIDs, trustPolicy: trustPolicy}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+			t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+			t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+			t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+			checks := Doctor(DoctorOptions{
+				Config: &Config{
+					OutputDir:      dir,
+					IssuerOverride: issuer,
+					Region:         "us-east-1",
+					Audiences:      tt.audiences,
+					Endpoints:      awsProvider.ClientOptions{EndpointURL: server.URL},
+				},
+				RoleARN: awsProvider.RoleARN(doctorTestAccountID, "my-role"),
+			})
+
+			outcomes := make(map[string]DoctorCheck, len(checks))
+			for _, check := range checks {
+				outcomes[check.Name] = check
+			}
+			for name, wantOK := range tt.want {
+				check, ok := outcomes[name]
+				if !ok {
+					t.Errorf("check %q not run", name)
+				} else if check.OK() != wantOK {
+					t.Errorf("check %q: OK = %v (%v), want %v", name, check.OK(), check.Err, wantOK)
+				} else if !check.OK() && check.Hint == "" {
+					t.Errorf("check %q failed without a hint", name)
+				}
+			}
+			if tt.wantAudiences != nil && !slices.Equal(fake.tokenAudiences, tt.wantAudiences) {
+				t.Errorf("token audiences = %v, want %v", fake.tokenAudiences, tt.wantAudiences)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package providers
+
+import "fmt"
+
+// ExportJWKSURI returns the jwks_uri the provisioning flow advertises for cfg, without calling
+// AWS, e.g. to paste it into the trust configuration of another system.
+//
+// The URL is composed like in CreateIdentityProvider: from the bucket, region and key prefix,
+// or from the external issuer when SkipBucket is set, unless JWKSURIOverride is set.
+//
+// Returns:
+//   - string: The jwks_uri advertised for cfg.
+//   - error: An error if neither an external issuer nor a bucket and region are configured.
+func ExportJWKSURI(cfg *Config) (string, error) {
+	if cfg.SkipBucket {
+		if cfg.IssuerOverride == "" && cfg.JWKSURIOverride == "" {
+			return "", fmt.Errorf("an issuer is required without a bucket")
+		}
+	} else if cfg.BucketName == "" || cfg.Region == "" {
+		return "", fmt.Errorf("a bucket name and a region are required")
+	}
+
+	return cfg.JWKSURI(), nil
+}
@@ -0,0 +1,162 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	awsProvider "github.com/chuhaoyuu/aws-oidc-sts/pkg/providers/aws"
+)
+
+// GitLabInstance is the URL of GitLab.com, the default GitLab CI issuer.
+const GitLabInstance = "https://gitlab.com"
+
+// GitLabOptions selects the GitLab CI jobs allowed to assume the role.
+type GitLabOptions struct {
+	// Instance is the URL of the GitLab instance issuing the ID tokens, which also is their
+	// default audience. Defaults to GitLabInstance.
+	Instance string
+	// Project is the full path of the project, e.g. my-group/my-project. It may contain the
+	// * and ? wildcards.
+	Project string
+	// Ref restricts the jobs to a ref: a branch name, "branch:<name>" or "tag:<name>", which
+	// may contain wildcards. Any ref of the project is allowed when empty.
+	Ref string
+}
+
+// issuer returns the GitLab instance URL without its trailing slash.
+func (o GitLabOptions) issuer() string {
+	if o.Instance == "" {
+		return GitLabInstance
+	}
+	return strings.TrimSuffix(o.Instance, "/")
+}
+
+// GitLabSubject returns the "sub" claim of the ID tokens of the GitLab CI jobs selected by
+// opts, in the project_path:<project>:ref_type:<type>:ref:<ref> format. The subject is a
+// pattern when the project or ref contain wildcards, or when no ref is set.
+func GitLabSubject(opts GitLabOptions) (string, error) {
+	if opts.Project == "" {
+		return "", fmt.Errorf("a GitLab project is required")
+	}
+
+	subject := "project_path:" + strings.Trim(opts.Project, "/")
+	if opts.Ref == "" {
+		return subject + ":*", nil
+	}
+
+	refType, ref, found := strings.Cut(opts.Ref, ":")
+	if !found {
+		refType, ref = "branch", opts.Ref
+	}
+	if refType != "branch" && refType != "tag" {
+		return "", fmt.Errorf("GitLab ref type %q must be branch or tag", refType)
+	}
+	if ref == "" {
+		return "", fmt.Errorf("GitLab ref %q has no name", opts.Ref)
+	}
+
+	return subject + ":ref_type:" + refType + ":ref:" + ref, nil
+}
+
+// ValidateGitLabInstance checks that the GitLab instance is an https URL without query or
+// fragment, as IAM requires for the issuer of an OIDC provider.
+func ValidateGitLabInstance(instance string) error {
+	u, err := url.Parse(instance)
+	if err != nil {
+		return fmt.Errorf("invalid GitLab instance %q: %w", instance, err)
+	}
+	if u.Scheme != "https" || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("GitLab instance %q must be an https URL", instance)
+	}
+	return nil
+}
+
+// CreateGitLabIdentityProvider provisions the IAM OIDC provider of a GitLab instance and a
+// role assumed by the ID tokens of the GitLab CI jobs selected by gitlab.
+//
+// The function performs the following steps:
+//  1. Checks the GitLab instance serves a valid discovery document and JWKS.
+//  2. Creates the IAM OIDC provider for the instance, with the instance URL as client ID
+//     unless cfg.Audiences is set.
+//  3. Writes the role trust policy, matching the "sub" claim of the selected jobs with
+//     StringLike when it is a pattern, and creates the IAM role named cfg.RoleName.
+//
+// The bucket, JWKS and JWT settings of cfg are ignored.
+//
+// It returns the identifiers of the provisioned resources.
+func CreateGitLabIdentityProvider(cfg *Config, gitlab GitLabOptions) (*IdentityProviderResult, error) {
+	if err := ValidateGitLabInstance(gitlab.issuer()); err != nil {
+		return nil, err
+	}
+	subject, err := GitLabSubject(gitlab)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.RoleName == "" {
+		return nil, fmt.Errorf("a role name is required")
+	}
+	if err := awsProvider.ValidateTags(cfg.Tags); err != nil {
+		return nil, fmt.Errorf("invalid tags:\n%w", err)
+	}
+	if err := errors.Join(awsProvider.ValidateSourceIPs(cfg.SourceIPs), awsProvider.ValidateSourceVPCEs(cfg.SourceVPCEs)); err != nil {
+		return nil, fmt.Errorf("invalid trust policy network conditions:\n%w", err)
+	}
+
+	gitlabCfg := *cfg
+	gitlabCfg.SkipBucket = true
+	gitlabCfg.IssuerOverride = gitlab.issuer()
+	if len(gitlabCfg.Audiences) == 0 {
+		gitlabCfg.Audiences = []string{gitlab.issuer()}
+	}
+	gitlabCfg.JWT.Subject = subject
+
+	discovery, err := WaitUntilReachable(gitlabCfg.Issuer(), "", gitlabCfg.ReachableTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitLab instance: %w", err)
+	}
+	// GitLab serves its JWKS outside of the .well-known path
+	gitlabCfg.JWKSURIOverride = discovery.JWKSURI
+
+	awsCfg, err := awsProvider.AwsClient(gitlabCfg.ClientOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS client: %w", err)
+	}
+
+	if err := createOIDCProvider(&gitlabCfg, awsCfg); err != nil {
+		return nil, err
+	}
+
+	accountID, err := awsProvider.AccountID(awsCfg, gitlabCfg.ClientOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AWS account ID: %w", err)
+	}
+
+	result := &IdentityProviderResult{
+		Issuer:          gitlabCfg.Issuer(),
+		JWKSURI:         gitlabCfg.JWKSURI(),
+		Subject:         subject,
+		ProviderARN:     awsProvider.OIDCProviderARN(accountID, gitlabCfg.Issuer()),
+		Audiences:       gitlabCfg.AcceptedAudiences(),
+		TrustPolicyFile: filepath.Join(gitlabCfg.OutputDir, TLSDirName, TrustPolicyFileName),
+	}
+
+	if err := os.MkdirAll(filepath.Join(gitlabCfg.OutputDir, TLSDirName), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for the trust policy: %w", err)
+	}
+	trustPolicy, err := CreateTrustPolicy(&gitlabCfg, result.ProviderARN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trust policy: %w", err)
+	}
+
+	if result.RoleARN, err = createRole(&gitlabCfg, awsCfg, accountID, trustPolicy); err != nil {
+		return nil, err
+	}
+	slog.Info("Role ready to be assumed by GitLab CI jobs", "RoleArn", result.RoleARN, "Subject", subject)
+
+	return result, nil
+}
@@ -0,0 +1,127 @@
+package providers
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// CreatePublicJSONWebKeySet generates a JSON Web Key Set holding only the public key read
+// from publicKeyFile, for verifiers publishing the JWKS of tokens signed elsewhere, without
+// access to the private key. The JWK Set is written to its own file, so that the signing JWKS
+// of the output directory is never replaced by a JWKS without the signing key.
+//
+// Parameters:
+//   - outFile: The path of the file the JWK Set is written to.
+//   - publicKeyFile: The path of the PEM-encoded PKIX public key.
+//   - keyID: The key ID of the key, computed from the public key when empty. It must only
+//     contain URL-safe characters.
+//   - keyIDHash: The hash algorithm of the computed key ID, KeyIDHashSHA1 or KeyIDHashSHA256.
+//   - algorithm: The signature algorithm of the key, e.g. RS256. It must match the key type.
+//   - minKeySize: The smallest RSA key size allowed. Defaults to DefaultMinKeySize.
+//
+// Returns:
+//   - jwk.Key: The public JWK added to the JWK Set.
+//   - error: An error if the key cannot be parsed or is too small, the key ID or the algorithm is invalid,
+//     or the JWK Set cannot be written.
+func CreatePublicJSONWebKeySet(outFile, publicKeyFile, keyID, keyIDHash, algorithm string, minKeySize int) (jwk.Key, error) {
+	publicKey, err := ParsePublicKeyFromPEMFile(publicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if rsaPublicKey, ok := publicKey.(*rsa.PublicKey); ok {
+		if err := checkKeySize(rsaPublicKey.N.BitLen(), minKeySize); err != nil {
+			return nil, err
+		}
+	}
+
+	signatureAlgorithm, err := publicKeyAlgorithm(publicKey, algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyID == "" {
+		if err := ValidateKeyIDHash(keyIDHash); err != nil {
+			return nil, err
+		}
+		keyID = keyIDFromPublicKey(publicKey, keyIDHash)
+	} else if err := ValidateKeyID(keyID); err != nil {
+		return nil, err
+	}
+
+	jwkPublicKey, err := jwk.Import(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import public key into JWK: %w", err)
+	}
+	if err := setKeyMetadata(jwkPublicKey, keyID, signatureAlgorithm); err != nil {
+		return nil, err
+	}
+
+	jwkSet := jwk.NewSet()
+	if err := jwkSet.AddKey(jwkPublicKey); err != nil {
+		return nil, fmt.Errorf("failed to add public key to JWK Set: %w", err)
+	}
+	if err := validateJWKSet(jwkSet); err != nil {
+		return nil, err
+	}
+
+	jwkSetJSON, err := json.MarshalIndent(jwkSet, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JWK Set: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outFile), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := writeFileAtomic(outFile, jwkSetJSON, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write JWK Set to file: %w", err)
+	}
+	slog.Info("JWK Set written to", slog.String("file", outFile), slog.String("kid", keyID))
+
+	return jwkPublicKey, nil
+}
+
+// publicKeyAlgorithm looks up the named signature algorithm and checks it can be used with
+// the type of publicKey: RS* and PS* for RSA keys, the ES* of the curve for ECDSA keys and
+// EdDSA for Ed25519 keys.
+func publicKeyAlgorithm(publicKey any, algorithm string) (jwa.SignatureAlgorithm, error) {
+	signatureAlgorithm, ok := jwa.LookupSignatureAlgorithm(algorithm)
+	if !ok {
+		return jwa.EmptySignatureAlgorithm(), fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+
+	var allowed []jwa.SignatureAlgorithm
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		allowed = []jwa.SignatureAlgorithm{jwa.RS256(), jwa.RS384(), jwa.RS512(), jwa.PS256(), jwa.PS384(), jwa.PS512()}
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			allowed = []jwa.SignatureAlgorithm{jwa.ES256()}
+		case elliptic.P384():
+			allowed = []jwa.SignatureAlgorithm{jwa.ES384()}
+		case elliptic.P521():
+			allowed = []jwa.SignatureAlgorithm{jwa.ES512()}
+		}
+	case ed25519.PublicKey:
+		allowed = []jwa.SignatureAlgorithm{jwa.EdDSA()}
+	default:
+		return jwa.EmptySignatureAlgorithm(), fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+
+	if !slices.Contains(allowed, signatureAlgorithm) {
+		return jwa.EmptySignatureAlgorithm(), fmt.Errorf("algorithm %s does not match the %T public key", algorithm, publicKey)
+	}
+
+	return signatureAlgorithm, nil
+}
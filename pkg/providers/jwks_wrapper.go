@@ -0,0 +1,83 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// JWKSWrapperKeysPlaceholder is the string value of a JWKS wrapper property replaced by the
+// array of keys, for consumers expecting the keys under another property than "keys".
+const JWKSWrapperKeysPlaceholder = "{{keys}}"
+
+// ReadJWKSWrapper reads the JWKS wrapper template in the given file: a JSON object whose
+// properties are added around the standard "keys" array, e.g. {"version": 1}. A property
+// whose value is JWKSWrapperKeysPlaceholder receives the array of keys too.
+func ReadJWKSWrapper(filePath string) (map[string]any, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS wrapper: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var wrapper map[string]any
+	if err := decoder.Decode(&wrapper); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS wrapper %s, expected a JSON object: %w", filePath, err)
+	}
+	if err := ValidateJWKSWrapper(wrapper); err != nil {
+		return nil, fmt.Errorf("invalid JWKS wrapper %s: %w", filePath, err)
+	}
+
+	return wrapper, nil
+}
+
+// ValidateJWKSWrapper checks that the JWKS wrapper does not define the "keys" property, which
+// always holds the standard array of keys.
+func ValidateJWKSWrapper(wrapper map[string]any) error {
+	if _, ok := wrapper["keys"]; ok {
+		return fmt.Errorf(`the "keys" property is reserved for the standard array of keys`)
+	}
+	return nil
+}
+
+// writeWrappedJWKS writes the JWK Set wrapped with the properties of wrapper to
+// JWKSWrappedFileName, next to the standard JWK Set which is left unchanged. The wrapped JWK
+// Set always holds the standard "keys" array, and the properties of wrapper whose value is
+// JWKSWrapperKeysPlaceholder also hold it.
+func writeWrappedJWKS(filePath string, jwkSetJSON []byte, wrapper map[string]any) error {
+	if err := ValidateJWKSWrapper(wrapper); err != nil {
+		return err
+	}
+
+	var jwkSet struct {
+		Keys json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(jwkSetJSON, &jwkSet); err != nil {
+		return fmt.Errorf("failed to parse JWK Set: %w", err)
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(jwkSet.Keys), []byte("[")) {
+		return fmt.Errorf(`JWK Set has no "keys" array to wrap`)
+	}
+
+	wrapped := make(map[string]any, len(wrapper)+1)
+	for property, value := range wrapper {
+		if value == JWKSWrapperKeysPlaceholder {
+			value = jwkSet.Keys
+		}
+		wrapped[property] = value
+	}
+	wrapped["keys"] = jwkSet.Keys
+
+	wrappedJSON, err := json.MarshalIndent(wrapped, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal wrapped JWK Set: %w", err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(filePath, TLSDirName, JWKSWrappedFileName), wrappedJSON, 0644); err != nil {
+		return fmt.Errorf("failed to write wrapped JWK Set to file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package providers
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ValidateKeyLayout checks that the key directory layout is KeyLayoutFlat or KeyLayoutNested.
+// An empty layout selects the default, KeyLayoutFlat.
+func ValidateKeyLayout(layout string) error {
+	switch layout {
+	case "", KeyLayoutFlat, KeyLayoutNested:
+		return nil
+	default:
+		return fmt.Errorf("key layout must be %s or %s, got %q", KeyLayoutFlat, KeyLayoutNested, layout)
+	}
+}
+
+// KeyLayout returns the layout of the key pairs in the specified directory: KeyLayoutNested
+// when the active key file names the key pair in use, KeyLayoutFlat otherwise.
+//
+// In the flat layout, the key pair and its certificate are stored in the tls directory. In the
+// nested layout, each key pair and its certificate are stored in their own subdirectory of the
+// tls directory named by their key ID, e.g. tls/<kid>/private-key.pem, and the active key file
+// holds the key ID of the key pair signing new tokens. The generated documents, such as the
+// JWKS, are stored in the tls directory with both layouts.
+func KeyLayout(filePath string) string {
+	if _, err := os.Stat(filepath.Join(filePath, TLSDirName, ActiveKeyFileName)); err == nil {
+		return KeyLayoutNested
+	}
+	return KeyLayoutFlat
+}
+
+// keyPairDir returns the directory holding the key pair in use in the specified directory,
+// according to its layout.
+func keyPairDir(filePath string) (string, error) {
+	activeKeyID, err := activeNestedKeyID(filePath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filePath, TLSDirName, activeKeyID), nil
+}
+
+// activeNestedKeyID returns the key ID of the active key pair of the nested layout, or an
+// empty string with the flat layout.
+func activeNestedKeyID(filePath string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(filePath, TLSDirName, ActiveKeyFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read active key file: %w", err)
+	}
+
+	keyID := strings.TrimSpace(string(data))
+	if err := ValidateKeyID(keyID); err != nil {
+		return "", fmt.Errorf("invalid active key file: %w", err)
+	}
+	return keyID, nil
+}
+
+// setActiveNestedKeyID makes the key pair stored under keyID the active key pair of the
+// nested layout.
+func setActiveNestedKeyID(filePath, keyID string) error {
+	if err := writeFileAtomic(filepath.Join(filePath, TLSDirName, ActiveKeyFileName), []byte(keyID+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write active key file: %w", err)
+	}
+	return nil
+}
+
+// nestedKeyIDs returns the key IDs of the key pairs of the nested layout other than the active
+// one, i.e. the subdirectories of the tls directory holding a private key. They are published
+// in the JWKS, e.g. the next or previous key of a rotation, but never sign new tokens.
+func nestedKeyIDs(filePath string) ([]string, error) {
+	activeKeyID, err := activeNestedKeyID(filePath)
+	if err != nil || activeKeyID == "" {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(filePath, TLSDirName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key directory: %w", err)
+	}
+	var keyIDs []string
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == activeKeyID {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(filePath, TLSDirName, entry.Name(), RSAPrivateKeyFile)); err != nil {
+			continue
+		}
+		keyIDs = append(keyIDs, entry.Name())
+	}
+
+	return keyIDs, nil
+}
+
+// writeNestedKeyPair writes the PEM-encoded key pair to its subdirectory of the nested layout,
+// named by the key ID computed from its public key with the keyIDHash algorithm, and returns
+// that key ID. The active key pair is left unchanged.
+func writeNestedKeyPair(filePath string, privateKeyPEM, publicKeyPEM []byte, keyIDHash string) (string, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return "", fmt.Errorf("failed to decode PEM block containing private key")
+	}
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse private key: %w", err)
+	}
+	keyID := keyIDFromPublicKey(&privateKey.PublicKey, keyIDHash)
+
+	dir := filepath.Join(filePath, TLSDirName, keyID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory for RSA keys: %w", err)
+	}
+	slog.Info("Writing private key to", slog.String("file", filepath.Join(dir, RSAPrivateKeyFile)))
+	slog.Info("Writing public key to", slog.String("file", filepath.Join(dir, RSAPublicKeyFile)))
+	if err := writeFilesAtomic(
+		atomicFile{name: filepath.Join(dir, RSAPrivateKeyFile), data: privateKeyPEM, perm: 0600},
+		atomicFile{name: filepath.Join(dir, RSAPublicKeyFile), data: publicKeyPEM, perm: 0644},
+	); err != nil {
+		return "", fmt.Errorf("failed to write RSA key pair to files: %w", err)
+	}
+
+	return keyID, nil
+}
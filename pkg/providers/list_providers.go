@@ -0,0 +1,43 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+
+	awsProvider "github.com/chuhaoyuu/aws-oidc-sts/pkg/providers/aws"
+)
+
+// ListIdentityProviders returns the IAM OIDC identity providers of the account that
+// were created by this tool, recognized by the ManagedBy tag.
+//
+// Parameters:
+//   - clientOptions: The options used to configure the AWS client.
+//   - concurrency: The maximum number of provider details fetched simultaneously.
+//
+// Returns:
+//   - []awsProvider.OIDCProvider: The managed identity providers.
+//   - error: An error if the AWS client cannot be created or the providers cannot be listed.
+func ListIdentityProviders(clientOptions awsProvider.ClientOptions, concurrency int) ([]awsProvider.OIDCProvider, error) {
+	awsCfg, err := awsProvider.AwsClient(clientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS client: %w", err)
+	}
+
+	service := &awsProvider.IAMService{
+		Client:      awsProvider.NewIAMClient(awsCfg, clientOptions),
+		Concurrency: concurrency,
+	}
+	all, err := service.ListOIDCProviders(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	var managed []awsProvider.OIDCProvider
+	for _, provider := range all {
+		if provider.ManagedBy() {
+			managed = append(managed, provider)
+		}
+	}
+
+	return managed, nil
+}
@@ -0,0 +1,199 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// ManifestVersion is the version of the manifest format written by WriteManifest.
+const ManifestVersion = 1
+
+// Manifest records the inputs and outputs of a provisioning run, to be committed to a
+// repository and re-applied with ApplyManifest to reconcile the identity provider.
+type Manifest struct {
+	// Version is the version of the manifest format.
+	Version int `json:"version"`
+	// Inputs are the settings the identity provider is provisioned with.
+	Inputs ManifestInputs `json:"inputs"`
+	// Outputs are the identifiers of the provisioned resources, for reference only.
+	Outputs *IdentityProviderResult `json:"outputs,omitempty"`
+}
+
+// ManifestInputs are the settings of a Config recorded in a Manifest. Local settings, such as
+// the output directory, the signer or the AWS endpoints, are not recorded.
+type ManifestInputs struct {
+	Issuer                       string            `json:"issuer,omitempty"`
+	JWKSURI                      string            `json:"jwksUri,omitempty"`
+	BucketName                   string            `json:"bucketName,omitempty"`
+	Region                       string            `json:"region"`
+	KeyPrefix                    string            `json:"keyPrefix,omitempty"`
+	StorageClass                 string            `json:"storageClass,omitempty"`
+	ObjectOwnership              string            `json:"objectOwnership,omitempty"`
+	Public                       bool              `json:"public,omitempty"`
+	SkipBucket                   bool              `json:"skipBucket,omitempty"`
+	NoDiscovery                  bool              `json:"noDiscovery,omitempty"`
+	Thumbprints                  []string          `json:"thumbprints,omitempty"`
+	Audiences                    []string          `json:"audiences"`
+	JWTAudiences                 []string          `json:"jwtAudiences,omitempty"`
+	Subject                      string            `json:"subject"`
+	KeyID                        string            `json:"keyId,omitempty"`
+	KeyIDHash                    string            `json:"keyIdHash,omitempty"`
+	KeySize                      int               `json:"keySize,omitempty"`
+	KeyLayout                    string            `json:"keyLayout,omitempty"`
+	RoleName                     string            `json:"roleName,omitempty"`
+	Tags                         map[string]string `json:"tags,omitempty"`
+	AllowSourceIdentity          bool              `json:"allowSourceIdentity,omitempty"`
+	SourceIdentityMatchesSubject bool              `json:"sourceIdentityMatchesSubject,omitempty"`
+	SourceIPs                    []string          `json:"sourceIps,omitempty"`
+	SourceVPCEs                  []string          `json:"sourceVpces,omitempty"`
+}
+
+// NewManifest records the settings of cfg and the result of the run provisioning it. The
+// key size and layout are the ones of the key pair in the output directory, generated again
+// with the same size and layout by ApplyManifest when missing.
+func NewManifest(cfg *Config, result *IdentityProviderResult) *Manifest {
+	manifest := &Manifest{
+		Version: ManifestVersion,
+		Inputs: ManifestInputs{
+			Issuer:                       cfg.IssuerOverride,
+			JWKSURI:                      cfg.JWKSURIOverride,
+			BucketName:                   cfg.BucketName,
+			Region:                       cfg.Region,
+			KeyPrefix:                    cfg.KeyPrefix,
+			StorageClass:                 cfg.StorageClass,
+			ObjectOwnership:              cfg.ObjectOwnership,
+			Public:                       cfg.Public,
+			SkipBucket:                   cfg.SkipBucket,
+			NoDiscovery:                  cfg.NoDiscovery,
+			Thumbprints:                  cfg.Thumbprints,
+			Audiences:                    cfg.AcceptedAudiences(),
+			JWTAudiences:                 cfg.JWT.Audiences,
+			Subject:                      cfg.Subject(),
+			KeyID:                        cfg.JWKS.KeyID,
+			KeyIDHash:                    cfg.JWKS.KeyIDHash,
+			RoleName:                     cfg.RoleName,
+			Tags:                         cfg.Tags,
+			AllowSourceIdentity:          cfg.AllowSourceIdentity,
+			SourceIdentityMatchesSubject: cfg.SourceIdentityMatchesSubject,
+			SourceIPs:                    cfg.SourceIPs,
+			SourceVPCEs:                  cfg.SourceVPCEs,
+		},
+		Outputs: result,
+	}
+	if privateKey, err := ParsePrivateKeyFromFile(cfg.OutputDir); err == nil {
+		manifest.Inputs.KeySize = privateKey.N.BitLen()
+		manifest.Inputs.KeyLayout = KeyLayout(cfg.OutputDir)
+	}
+
+	return manifest
+}
+
+// Config returns the settings recorded in the manifest applied to base, which provides the
+// local settings that are not recorded, such as the output directory or the AWS endpoints.
+func (m *Manifest) Config(base Config) *Config {
+	cfg := base
+	cfg.IssuerOverride = m.Inputs.Issuer
+	cfg.JWKSURIOverride = m.Inputs.JWKSURI
+	cfg.BucketName = m.Inputs.BucketName
+	cfg.Region = m.Inputs.Region
+	cfg.KeyPrefix = m.Inputs.KeyPrefix
+	cfg.StorageClass = m.Inputs.StorageClass
+	cfg.ObjectOwnership = m.Inputs.ObjectOwnership
+	cfg.Public = m.Inputs.Public
+	cfg.SkipBucket = m.Inputs.SkipBucket
+	cfg.NoDiscovery = m.Inputs.NoDiscovery
+	cfg.Thumbprints = m.Inputs.Thumbprints
+	cfg.Audiences = m.Inputs.Audiences
+	cfg.JWT.Audiences = m.Inputs.JWTAudiences
+	cfg.JWT.Subject = m.Inputs.Subject
+	cfg.JWKS.KeyID = m.Inputs.KeyID
+	cfg.JWKS.KeyIDHash = m.Inputs.KeyIDHash
+	cfg.RoleName = m.Inputs.RoleName
+	cfg.Tags = m.Inputs.Tags
+	cfg.AllowSourceIdentity = m.Inputs.AllowSourceIdentity
+	cfg.SourceIdentityMatchesSubject = m.Inputs.SourceIdentityMatchesSubject
+	cfg.SourceIPs = m.Inputs.SourceIPs
+	cfg.SourceVPCEs = m.Inputs.SourceVPCEs
+
+	return &cfg
+}
+
+// WriteManifest writes the manifest as indented JSON to the given path.
+func WriteManifest(path string, manifest *Manifest) error {
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for the manifest: %w", err)
+	}
+	if err := writeFileAtomic(path, append(manifestJSON, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest to file: %w", err)
+	}
+	slog.Info("Manifest written to", slog.String("file", path))
+
+	return nil
+}
+
+// ReadManifest reads the manifest written by WriteManifest at the given path.
+func ReadManifest(path string) (*Manifest, error) {
+	manifestJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if manifest.Version != ManifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d, expected %d", manifest.Version, ManifestVersion)
+	}
+
+	return &manifest, nil
+}
+
+// ApplyManifest provisions the identity provider recorded in the manifest again, e.g. to
+// reconcile it from a repository. The key pair is generated with the recorded key size and
+// layout when missing from the output directory of base, and the existing AWS resources are
+// reused, so applying a manifest several times converges to the same setup. Manifests without
+// a recorded layout use the layout of the output directory. No key pair is generated for an
+// issuer hosted outside of S3.
+//
+// Returns:
+//   - *IdentityProviderResult: The identifiers of the provisioned resources.
+//   - error: An error if generating the key pair or provisioning fails.
+func ApplyManifest(manifest *Manifest, base Config) (*IdentityProviderResult, error) {
+	cfg := manifest.Config(base)
+
+	if cfg.JWKS.Signer == nil && !cfg.SkipBucket {
+		if err := manifest.createKeyPair(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return CreateIdentityProvider(cfg)
+}
+
+// createKeyPair generates the key pair of the manifest in the output directory of cfg with the
+// recorded key size and layout, unless the directory already has one.
+func (m *Manifest) createKeyPair(cfg *Config) error {
+	layout := m.Inputs.KeyLayout
+	if layout == "" {
+		layout = KeyLayout(cfg.OutputDir)
+	}
+	if err := CreateRSAKeyPair(cfg.OutputDir, RSAKeyPairOptions{
+		Bits:       m.Inputs.KeySize,
+		MinKeySize: cfg.JWKS.MinKeySize,
+		Layout:     layout,
+		KeyIDHash:  cfg.JWKS.KeyIDHash,
+	}); err != nil {
+		return fmt.Errorf("failed to create RSA key pair: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package providers
+
+import "testing"
+
+func TestManifestKeyLayout(t *testing.T) {
+	nestedDir := t.TempDir()
+	if err := CreateRSAKeyPair(nestedDir, RSAKeyPairOptions{Bits: 2048, Layout: KeyLayoutNested}); err != nil {
+		t.Fatalf("CreateRSAKeyPair: %v", err)
+	}
+	activeKeyID, err := activeNestedKeyID(nestedDir)
+	if err != nil {
+		t.Fatalf("activeNestedKeyID: %v", err)
+	}
+
+	manifest := NewManifest(&Config{OutputDir: nestedDir, Region: "us-east-1"}, nil)
+	if manifest.Inputs.KeyLayout != KeyLayoutNested || manifest.Inputs.KeySize != 2048 {
+		t.Fatalf("recorded key layout %q and size %d, want %q and 2048", manifest.Inputs.KeyLayout, manifest.Inputs.KeySize, KeyLayoutNested)
+	}
+
+	tests := []struct {
+		name      string
+		dir       string
+		keyLayout string
+	}{
+		{name: "existing nested key pair", dir: nestedDir, keyLayout: KeyLayoutNested},
+		{name: "existing nested key pair without recorded layout", dir: nestedDir},
+		{name: "missing key pair", dir: t.TempDir(), keyLayout: KeyLayoutNested},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := *manifest
+			m.Inputs.KeyLayout = tt.keyLayout
+			if err := m.createKeyPair(m.Config(Config{OutputDir: tt.dir})); err != nil {
+				t.Fatalf("createKeyPair: %v", err)
+			}
+			if layout := KeyLayout(tt.dir); layout != KeyLayoutNested {
+				t.Errorf("key layout = %q, want %q", layout, KeyLayoutNested)
+			}
+			if privateKey, err := ParsePrivateKeyFromFile(tt.dir); err != nil || privateKey.N.BitLen() != 2048 {
+				t.Errorf("key pair = %v, want a 2048-bit key", err)
+			}
+		})
+	}
+
+	if keyID, _ := activeNestedKeyID(nestedDir); keyID != activeKeyID {
+		t.Errorf("active kid = %q, want the existing key pair %q to be kept", keyID, activeKeyID)
+	}
+}
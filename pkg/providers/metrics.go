@@ -0,0 +1,110 @@
+package providers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MetricsJobName is the Pushgateway job the metrics of a run are pushed under.
+const MetricsJobName = "aws-oidc-sts"
+
+// RunMetrics holds the metrics of a single run of a command, exposed to Prometheus to alert
+// on failed scheduled runs, tokens about to expire and keys due for rotation.
+type RunMetrics struct {
+	// Command is the name of the command, exposed as the "command" label.
+	Command string
+	// Success reports whether the run succeeded.
+	Success bool
+	// Time is the time of the run.
+	Time time.Time
+	// TokenExpiration is the "exp" claim of the JWT signed by the run, if any.
+	TokenExpiration time.Time
+	// KeyCreated is the creation time of the key pair, when known.
+	KeyCreated time.Time
+}
+
+// Encode renders the metrics in the Prometheus text exposition format. The token expiration
+// and key age are omitted when unknown.
+func (m RunMetrics) Encode() []byte {
+	var buf bytes.Buffer
+	labels := fmt.Sprintf("{command=%q}", m.Command)
+	gauge := func(name, help string, value float64) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n%s%s %g\n", name, help, name, name, labels, value)
+	}
+
+	success := 0.0
+	if m.Success {
+		success = 1
+	}
+	gauge("aws_oidc_sts_last_run_success", "Whether the last run succeeded (1) or failed (0).", success)
+	gauge("aws_oidc_sts_last_run_timestamp_seconds", "Unix time of the last run.", float64(m.Time.Unix()))
+	if !m.TokenExpiration.IsZero() {
+		gauge("aws_oidc_sts_token_expiration_timestamp_seconds", "Unix time the last signed JWT expires at.", float64(m.TokenExpiration.Unix()))
+	}
+	if !m.KeyCreated.IsZero() {
+		gauge("aws_oidc_sts_key_age_days", "Age of the signing key pair in days.", m.Time.Sub(m.KeyCreated).Hours()/24)
+	}
+
+	return buf.Bytes()
+}
+
+// KeyCreationTime returns the creation time of the key pair in the specified directory, i.e.
+// the modification time of its private key file, which is only written when it is generated.
+func KeyCreationTime(filePath string) (time.Time, error) {
+	dir, err := keyPairDir(filePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	info, err := os.Stat(filepath.Join(dir, RSAPrivateKeyFile))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read private key file: %w", err)
+	}
+	return info.ModTime(), nil
+}
+
+// WriteMetricsTextfile writes the metrics to a file read by the textfile collector of the
+// Prometheus node exporter. The file is written atomically, so that the collector never reads
+// a partial file, and must have the .prom extension to be collected.
+func WriteMetricsTextfile(path string, m RunMetrics) error {
+	if filepath.Ext(path) != ".prom" {
+		return fmt.Errorf("metrics textfile %s must have the .prom extension", path)
+	}
+	if err := writeFileAtomic(path, m.Encode(), 0644); err != nil {
+		return fmt.Errorf("failed to write metrics textfile: %w", err)
+	}
+	return nil
+}
+
+// PushMetrics pushes the metrics to the Prometheus Pushgateway at the given URL, grouped
+// under the MetricsJobName job and the command, replacing the metrics of its previous run.
+func PushMetrics(pushgatewayURL string, m RunMetrics) error {
+	u, err := url.Parse(pushgatewayURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse Pushgateway URL %s: %w", pushgatewayURL, err)
+	}
+	u = u.JoinPath("metrics", "job", MetricsJobName, "command", m.Command)
+
+	req, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(m.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create Pushgateway request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics to %s: %w", u.Redacted(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to push metrics to %s: unexpected status %s", u.Redacted(), resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// MinPKCS12PasswordLength is the minimum length of the password protecting a PKCS#12 bundle.
+const MinPKCS12PasswordLength = 8
+
+// ExportPKCS12 bundles the private key of the key pair in the specified directory and its
+// self-signed certificate into a password-protected PKCS#12 (.p12/.pfx) file, for keystores
+// such as the Windows certificate store or Java keystores.
+//
+// The certificate is created as for the JWKS when the directory does not hold one yet. The
+// bundle is encrypted with AES-256 and PBKDF2 (pkcs12.Modern) and written with mode 0600.
+//
+// Parameters:
+//   - filePath: The directory holding the key pair.
+//   - outFile: The path of the PKCS#12 file to write.
+//   - password: The password protecting the bundle, of at least MinPKCS12PasswordLength characters.
+//
+// Returns:
+//   - error: An error if the password is too short, the key pair or certificate cannot be
+//     read or do not match, or the bundle cannot be encoded or written.
+func ExportPKCS12(filePath, outFile, password string) error {
+	if len(password) < MinPKCS12PasswordLength {
+		return fmt.Errorf("password must be at least %d characters long", MinPKCS12PasswordLength)
+	}
+
+	privateKey, err := ParsePrivateKeyFromFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	dir, err := keyPairDir(filePath)
+	if err != nil {
+		return err
+	}
+	certificatePath := filepath.Join(dir, CertificateFile)
+	if _, err := os.Stat(certificatePath); errors.Is(err, os.ErrNotExist) {
+		if err := CreateSelfSignedCertificate(filePath); err != nil {
+			return fmt.Errorf("failed to create certificate: %w", err)
+		}
+	}
+	certificate, err := ParseCertificateFromFile(filePath)
+	if err != nil {
+		return err
+	}
+	if !privateKey.PublicKey.Equal(certificate.PublicKey) {
+		return fmt.Errorf("certificate %s does not match the private key", certificatePath)
+	}
+
+	bundle, err := pkcs12.Modern.Encode(privateKey, certificate, nil, password)
+	if err != nil {
+		return fmt.Errorf("failed to encode PKCS#12 bundle: %w", err)
+	}
+
+	if err := writeFileAtomic(outFile, bundle, 0600); err != nil {
+		return fmt.Errorf("failed to write PKCS#12 bundle: %w", err)
+	}
+	slog.Info("PKCS#12 bundle written to", slog.String("file", outFile))
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package providers
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	awsProvider "github.com/chuhaoyuu/aws-oidc-sts/pkg/providers/aws"
+)
+
+// PruneJWKSVersions deletes the superseded versions of the JWKS object in a versioned S3 bucket
+// that are older than the retention window. The current version is always kept.
+//
+// Parameters:
+//   - clientOptions: The options used to configure the AWS client.
+//   - bucketName: The name of the S3 bucket hosting the JWKS.
+//   - keyPrefix: The prefix of the JWKS object key, empty when the JWKS is at the bucket root.
+//   - olderThan: The retention window; only versions last modified before now minus olderThan are pruned.
+//   - dryRun: When true, the versions that would be deleted are returned without deleting them.
+//
+// Returns:
+//   - []awsProvider.ObjectVersion: The pruned versions, or the versions that would be pruned in dry-run mode.
+//   - error: An error if listing or deleting the object versions fails.
+func PruneJWKSVersions(clientOptions awsProvider.ClientOptions, bucketName, keyPrefix string, olderThan time.Duration, dryRun bool) ([]awsProvider.ObjectVersion, error) {
+	awsCfg, err := awsProvider.AwsClient(clientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS client: %w", err)
+	}
+
+	s3Service := &awsProvider.S3Service{
+		Client:     awsProvider.NewS3Client(awsCfg, clientOptions),
+		BucketName: bucketName,
+		Region:     awsCfg.Region,
+	}
+
+	versions, err := s3Service.ListObjectVersions(awsProvider.JoinObjectKey(keyPrefix, JWKSObjectKey))
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	var pruned []awsProvider.ObjectVersion
+	for _, version := range versions {
+		if version.IsLatest || !version.LastModified.Before(cutoff) {
+			continue
+		}
+
+		if dryRun {
+			slog.Info("Would delete JWKS version", "VersionId", version.VersionID, "LastModified", version.LastModified)
+		} else if err := s3Service.DeleteObjectVersion(version.Key, version.VersionID); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, version)
+	}
+
+	return pruned, nil
+}
@@ -0,0 +1,103 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// reachableInitialBackoff and reachableMaxBackoff bound the wait between two attempts of
+// WaitUntilReachable, which doubles after every attempt.
+var (
+	reachableInitialBackoff = time.Second
+	reachableMaxBackoff     = 30 * time.Second
+)
+
+// HTTPStatusError is returned when a document is served with an unexpected HTTP status.
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("failed to fetch %s: unexpected status %s", e.URL, e.Status)
+}
+
+// isPropagationError reports whether err is likely caused by a document not being propagated
+// yet, i.e. S3 or CloudFront answering 404, or 403 when retryForbidden is set, right after the
+// upload.
+func isPropagationError(err error, retryForbidden bool) bool {
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	return statusErr.StatusCode == http.StatusNotFound || (retryForbidden && statusErr.StatusCode == http.StatusForbidden)
+}
+
+// isForbiddenError reports whether err is a document answered with 403.
+func isForbiddenError(err error) bool {
+	var statusErr *HTTPStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusForbidden
+}
+
+// WaitUntilReachable polls the discovery document of the issuer and the JWKS it advertises
+// until both are served and valid, so that STS can fetch them. When jwksURI is set, the
+// discovery document is not managed by this tool: it is skipped and jwksURI is polled instead.
+//
+// Documents answered with 403 or 404 are assumed to be still propagating and are retried with
+// an exponential backoff, until timeout has elapsed. Any other error fails immediately. A zero
+// timeout makes a single attempt.
+//
+// Parameters:
+//   - issuer: The issuer URL of the identity provider.
+//   - jwksURI: The JWKS URL polled without the discovery document, or empty.
+//   - timeout: The maximum time spent waiting for the documents to propagate.
+//
+// Returns:
+//   - *OpenIDConfiguration: The discovery document served by the issuer, nil when skipped.
+//   - error: The last error if the documents are not reachable in time, or the first
+//     error not caused by propagation.
+func WaitUntilReachable(issuer, jwksURI string, timeout time.Duration) (*OpenIDConfiguration, error) {
+	return waitUntilReachable(issuer, jwksURI, timeout, true)
+}
+
+// waitUntilReachable is WaitUntilReachable, only retrying documents answered with 403 when
+// retryForbidden is set. Private S3 objects are answered with 403 forever, so the documents
+// uploaded without the public-read ACL fail on the first 403 instead of until the timeout.
+func waitUntilReachable(issuer, jwksURI string, timeout time.Duration, retryForbidden bool) (*OpenIDConfiguration, error) {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	backoff := reachableInitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		var discovery *OpenIDConfiguration
+		var err error
+		if jwksURI != "" {
+			_, err = FetchJWKS(jwksURI)
+		} else if discovery, err = FetchOpenIDConfiguration(issuer); err == nil {
+			_, err = FetchJWKS(discovery.JWKSURI)
+		}
+		if err == nil {
+			slog.Info("Issuer documents reachable", slog.String("issuer", issuer),
+				slog.Int("attempts", attempt), slog.Duration("elapsed", time.Since(start).Round(time.Millisecond)))
+			return discovery, nil
+		}
+
+		if !retryForbidden && isForbiddenError(err) {
+			return nil, fmt.Errorf("issuer documents are not public: %w", err)
+		}
+		remaining := time.Until(deadline)
+		if !isPropagationError(err, retryForbidden) || remaining <= 0 {
+			return nil, err
+		}
+
+		wait := min(backoff, remaining)
+		slog.Warn("Issuer documents not reachable yet, retrying.", slog.String("error", err.Error()),
+			slog.Int("attempt", attempt), slog.Duration("wait", wait))
+		time.Sleep(wait)
+		backoff = min(backoff*2, reachableMaxBackoff)
+	}
+}
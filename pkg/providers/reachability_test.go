@@ -0,0 +1,133 @@
+package providers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// withReachableBackoff shortens the backoff of WaitUntilReachable for the duration of the test.
+func withReachableBackoff(t *testing.T, initial, maxBackoff time.Duration) {
+	t.Helper()
+	previousInitial, previousMax := reachableInitialBackoff, reachableMaxBackoff
+	reachableInitialBackoff, reachableMaxBackoff = initial, maxBackoff
+	t.Cleanup(func() { reachableInitialBackoff, reachableMaxBackoff = previousInitial, previousMax })
+}
+
+// newJWKSServer serves the JWKS of a test key pair once the given number of requests have been
+// answered with failStatus, and records the time of every request.
+func newJWKSServer(t *testing.T, failStatus, failures int) (*httptest.Server, *[]time.Time) {
+	t.Helper()
+
+	dir := newTestKeyPairDir(t)
+	if _, err := CreateJSONWebKeySet(dir, JWKSOptions{}); err != nil {
+		t.Fatalf("CreateJSONWebKeySet: %v", err)
+	}
+	jwks, err := os.ReadFile(filepath.Join(dir, TLSDirName, JWKSFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests []time.Time
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, time.Now())
+		if int(count.Add(1)) <= failures {
+			w.WriteHeader(failStatus)
+			return
+		}
+		w.Write(jwks)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func TestWaitUntilReachableRetries(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		retryForbidden bool
+		wantAttempts   int
+		wantErr        bool
+	}{
+		{name: "not found retried", status: http.StatusNotFound, retryForbidden: true, wantAttempts: 3},
+		{name: "forbidden retried", status: http.StatusForbidden, retryForbidden: true, wantAttempts: 3},
+		{name: "forbidden fatal for private objects", status: http.StatusForbidden, wantAttempts: 1, wantErr: true},
+		{name: "not found retried for private objects", status: http.StatusNotFound, wantAttempts: 3},
+		{name: "server error fatal", status: http.StatusInternalServerError, retryForbidden: true, wantAttempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withReachableBackoff(t, 10*time.Millisecond, time.Second)
+			server, requests := newJWKSServer(t, tt.status, 2)
+
+			_, err := waitUntilReachable("https://oidc.example.com", server.URL+"/jwks.json", 10*time.Second, tt.retryForbidden)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("waitUntilReachable error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(*requests) != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", len(*requests), tt.wantAttempts)
+			}
+			var statusErr *HTTPStatusError
+			if tt.wantErr && (!errors.As(err, &statusErr) || statusErr.StatusCode != tt.status) {
+				t.Errorf("err = %v, want the HTTP status %d", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestWaitUntilReachableBackoff(t *testing.T) {
+	withReachableBackoff(t, 20*time.Millisecond, 40*time.Millisecond)
+	server, requests := newJWKSServer(t, http.StatusNotFound, 3)
+
+	if _, err := WaitUntilReachable("https://oidc.example.com", server.URL+"/jwks.json", 10*time.Second); err != nil {
+		t.Fatalf("WaitUntilReachable: %v", err)
+	}
+
+	// The wait doubles after every attempt, up to the maximum backoff
+	wantWaits := []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond}
+	if len(*requests) != len(wantWaits)+1 {
+		t.Fatalf("got %d attempts, want %d", len(*requests), len(wantWaits)+1)
+	}
+	for i, want := range wantWaits {
+		if wait := (*requests)[i+1].Sub((*requests)[i]); wait < want {
+			t.Errorf("wait before attempt %d = %v, want at least %v", i+2, wait, want)
+		}
+	}
+}
+
+func TestWaitUntilReachableTimeout(t *testing.T) {
+	withReachableBackoff(t, 20*time.Millisecond, 20*time.Millisecond)
+	server, requests := newJWKSServer(t, http.StatusNotFound, 1000)
+
+	start := time.Now()
+	_, err := WaitUntilReachable("https://oidc.example.com", server.URL+"/jwks.json", 100*time.Millisecond)
+	elapsed := time.Since(start)
+
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("err = %v, want the last 404", err)
+	}
+	if elapsed < 100*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("gave up after %v, want about the 100ms timeout", elapsed)
+	}
+	if len(*requests) < 2 {
+		t.Errorf("got %d attempts, want retries until the timeout", len(*requests))
+	}
+
+	// A zero timeout makes a single attempt
+	*requests = nil
+	if _, err := WaitUntilReachable("https://oidc.example.com", server.URL+"/jwks.json", 0); err == nil {
+		t.Fatal("WaitUntilReachable succeeded without the JWKS")
+	}
+	if len(*requests) != 1 {
+		t.Errorf("got %d attempts with a zero timeout, want 1", len(*requests))
+	}
+}
@@ -0,0 +1,100 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+// RefreshToken signs a new JWT for an already provisioned identity provider, without
+// touching the key pair, the bucket or IAM. It is the everyday operation once the
+// infrastructure exists and the previous token expired.
+//
+// The claims not set in opts are taken from the local files of the identity provider:
+//  1. The issuer is the one of the openid-configuration in the directory.
+//  2. The audiences and subject are the ones of the previous token.jwt, when present,
+//     and otherwise the defaults of CreateJWT.
+//
+// The token is signed with the key ID published in the JWKS of the directory, so that it
+// still verifies against the published JWKS, and gets a fresh "iat" and "exp" unless set
+// in opts. It is written to token.jwt with mode 0600.
+//
+// Parameters:
+//   - filePath: The directory holding the key pair and the identity provider documents.
+//   - keyID: The key ID of the key pair, when set with --kid at provisioning.
+//   - keyIDHash: The hash algorithm of the computed key ID, when the key is not in the local JWKS.
+//   - signer: The signer holding the private key, or nil to read it from the directory.
+//   - minKeySize: The minimum RSA key size in bits.
+//   - opts: The claims overriding the ones of the local files.
+//
+// Returns:
+//   - []byte: The signed JWT.
+//   - error: An error if the issuer cannot be determined, or the signing or writing fails.
+func RefreshToken(filePath, keyID, keyIDHash string, signer Signer, minKeySize int, opts JWTOptions) ([]byte, error) {
+	signingKey, err := SigningKey(filePath, keyID, keyIDHash, signer, minKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key: %w", err)
+	}
+
+	if opts.Issuer == "" {
+		opts.Issuer, err = localIssuer(filePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	jwtFilePath := filepath.Join(filePath, TLSDirName, JWTFileName)
+	if previous, err := os.ReadFile(jwtFilePath); err == nil {
+		token, err := jwt.ParseInsecure(previous)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse previous JWT %s: %w", jwtFilePath, err)
+		}
+		if audiences, ok := token.Audience(); ok && len(opts.Audiences) == 0 {
+			opts.Audiences = audiences
+		}
+		if subject, ok := token.Subject(); ok && opts.Subject == "" {
+			opts.Subject = subject
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read previous JWT: %w", err)
+	}
+
+	if signer != nil {
+		opts.Signer = signer
+	}
+	signedJWT, err := CreateJWT(signingKey, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWT: %w", err)
+	}
+
+	if err := writeFileAtomic(jwtFilePath, signedJWT, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write JWT to file: %w", err)
+	}
+	slog.Info("JWT written to", slog.String("file", jwtFilePath))
+
+	return signedJWT, nil
+}
+
+// localIssuer returns the issuer of the openid-configuration in the specified directory.
+func localIssuer(filePath string) (string, error) {
+	discoveryFilePath := filepath.Join(filePath, TLSDirName, OpenIDConfigurationFileName)
+	data, err := os.ReadFile(discoveryFilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read openid-configuration, set the issuer explicitly: %w", err)
+	}
+
+	var discovery OpenIDConfiguration
+	if err := json.Unmarshal(data, &discovery); err != nil {
+		return "", fmt.Errorf("failed to parse openid-configuration %s: %w", discoveryFilePath, err)
+	}
+	if discovery.Issuer == "" {
+		return "", fmt.Errorf("openid-configuration %s has no issuer", discoveryFilePath)
+	}
+
+	return discovery.Issuer, nil
+}
@@ -0,0 +1,64 @@
+package providers
+
+import "time"
+
+// IdentityProviderResult describes the identity provider provisioned by CreateIdentityProvider,
+// or generated by CreateLocalIdentityProvider.
+type IdentityProviderResult struct {
+	// Issuer is the issuer URL, i.e. the "iss" claim of the tokens.
+	Issuer string `json:"issuer" yaml:"issuer"`
+	// JWKSURI is the URL the JWKS is served from.
+	JWKSURI string `json:"jwksUri" yaml:"jwksUri"`
+	// KeyID is the key ID (kid) of the signing key.
+	KeyID string `json:"keyId" yaml:"keyId"`
+	// Subject is the "sub" claim of the JWT, trusted by the role trust policy.
+	Subject string `json:"subject" yaml:"subject"`
+	// ProviderARN is the ARN of the IAM OIDC provider, empty for a local identity provider.
+	ProviderARN string `json:"providerArn,omitempty" yaml:"providerArn,omitempty"`
+	// Audiences are the client IDs of the IAM OIDC provider.
+	Audiences []string `json:"audiences" yaml:"audiences"`
+	// RoleARN is the ARN of the IAM role, when one was created.
+	RoleARN string `json:"roleArn,omitempty" yaml:"roleArn,omitempty"`
+	// TrustPolicyFile is the path of the written trust policy, empty for a local identity provider.
+	TrustPolicyFile string `json:"trustPolicyFile,omitempty" yaml:"trustPolicyFile,omitempty"`
+	// TokenExpiration is the exp claim of the JWT signed by the run, e.g. for the metrics. It is
+	// not serialized, so that manifests recording the result do not change with every run.
+	TokenExpiration time.Time `json:"-" yaml:"-"`
+}
+
+// JWTResult describes a JWT signed by CreateJWT.
+type JWTResult struct {
+	// Token is the signed JWT.
+	Token string `json:"token" yaml:"token"`
+	// Expiration is the exp claim of the JWT as a Unix timestamp.
+	Expiration int64 `json:"exp" yaml:"exp"`
+	// ExpiresAt is the exp claim of the JWT in RFC 3339 format.
+	ExpiresAt string `json:"expiresAt" yaml:"expiresAt"`
+}
+
+// NewJWTResult describes the signed JWT, reading its expiration from the exp claim so that
+// it reflects any explicit expiration.
+func NewJWTResult(signedJWT []byte) (*JWTResult, error) {
+	expiration, err := TokenExpiration(signedJWT)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JWTResult{
+		Token:      string(signedJWT),
+		Expiration: expiration.Unix(),
+		ExpiresAt:  expiration.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// AssumeRoleResult describes the role session obtained by TestAssumeRole.
+type AssumeRoleResult struct {
+	// AssumedRoleARN is the ARN of the assumed role session, as reported by GetCallerIdentity.
+	AssumedRoleARN string `json:"assumedRoleArn" yaml:"assumedRoleArn"`
+	// Account is the AWS account of the role.
+	Account string `json:"account" yaml:"account"`
+	// UserID is the unique identifier of the role session.
+	UserID string `json:"userId" yaml:"userId"`
+	// Expiration is the expiration of the temporary credentials in RFC 3339 format.
+	Expiration string `json:"expiration" yaml:"expiration"`
+}
@@ -0,0 +1,434 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	awsProvider "github.com/chuhaoyuu/aws-oidc-sts/pkg/providers/aws"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+const (
+	// RotationStagePrepare generates the next key and publishes it alongside the active key.
+	RotationStagePrepare = "prepare"
+	// RotationStageActivate signs new tokens with the next key, still publishing the previous one.
+	RotationStageActivate = "activate"
+	// RotationStageRetire stops publishing the previous key, completing the rotation.
+	RotationStageRetire = "retire"
+)
+
+// RotationState records the progress of a staged key rotation in the rotation state file of
+// the output directory, so that each stage can check the previous one completed.
+type RotationState struct {
+	// Stage is the last completed stage.
+	Stage string `json:"stage"`
+	// ActiveKeyID is the key ID of the key pair signing new tokens.
+	ActiveKeyID string `json:"activeKeyId"`
+	// NextKeyID is the key ID of the key published ahead of use, after the prepare stage.
+	NextKeyID string `json:"nextKeyId,omitempty"`
+	// PreviousKeyID is the key ID of the key still published for the tokens it signed, after
+	// the activate stage.
+	PreviousKeyID string `json:"previousKeyId,omitempty"`
+	// UpdatedAt is the time the stage completed.
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// RotateOptions holds the settings of a rotation stage run by RotateKeys.
+type RotateOptions struct {
+	// Config locates the key pair (OutputDir) and, with BucketName, the bucket the JWKS is
+	// uploaded to. Its JWKS options are applied to the regenerated JWKS.
+	Config *Config
+	// Stage is RotationStagePrepare, RotationStageActivate or RotationStageRetire.
+	Stage string
+	// Bits is the size of the next key. Defaults to DefaultRSAKeySize.
+	Bits int
+}
+
+// ReadRotationState reads the rotation state of the specified directory, or returns nil
+// when no rotation was ever staged.
+func ReadRotationState(filePath string) (*RotationState, error) {
+	data, err := os.ReadFile(filepath.Join(filePath, TLSDirName, RotationStateFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rotation state: %w", err)
+	}
+
+	state := &RotationState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse rotation state: %w", err)
+	}
+	return state, nil
+}
+
+// rotationStagedKeyFile returns the private key file of the key published besides the key
+// pair by a rotation in progress: the next key after the prepare stage, the previous key
+// after the activate stage, or an empty string otherwise. In the nested key layout, the
+// staged key has its own subdirectory and is published as such, so none is returned.
+func rotationStagedKeyFile(filePath string) (string, error) {
+	state, err := ReadRotationState(filePath)
+	if err != nil || state == nil || KeyLayout(filePath) == KeyLayoutNested {
+		return "", err
+	}
+
+	switch state.Stage {
+	case RotationStagePrepare:
+		return filepath.Join(filePath, TLSDirName, NextPrivateKeyFile), nil
+	case RotationStageActivate:
+		return filepath.Join(filePath, TLSDirName, PreviousPrivateKeyFile), nil
+	default:
+		return "", nil
+	}
+}
+
+// RotateKeys runs one stage of a zero-downtime key rotation, in which the next key is
+// published some time before it signs tokens, so that verifiers have cached it by then:
+//
+//  1. RotationStagePrepare generates the next key pair and publishes its public key
+//     alongside the active key. It requires no rotation to be in progress.
+//  2. RotationStageActivate makes the next key the key pair, signing new tokens, and keeps
+//     publishing the previous key until the tokens it signed expire.
+//  3. RotationStageRetire stops publishing the previous key and deletes it.
+//
+// In the nested key layout (see KeyLayout), the next key pair is generated in its own
+// subdirectory, activating it switches the active key file to it, and retiring the previous
+// key pair deletes its subdirectory.
+//
+// After each stage, the rotation state file records the completed stage, and the JWKS is
+// regenerated with the JWKS options of the configuration and uploaded to the bucket when
+// BucketName is set (unless SkipBucket). When the stage or its publication fails, the key
+// directory, including the rotation state file, is rolled back to its content before the stage,
+// so that the stage can be run again and the next stage never starts from keys that were not
+// published. Keys held by a Signer cannot be rotated.
+//
+// Returns:
+//   - *RotationState: The rotation state after the stage.
+//   - error: An error if the stage is unknown or out of order, or a step fails.
+func RotateKeys(opts RotateOptions) (*RotationState, error) {
+	cfg := opts.Config
+	if cfg.JWKS.Signer != nil {
+		return nil, fmt.Errorf("keys held by a signer cannot be rotated")
+	}
+
+	state, err := ReadRotationState(cfg.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+	stage := ""
+	if state != nil {
+		stage = state.Stage
+	}
+
+	tlsDir := filepath.Join(cfg.OutputDir, TLSDirName)
+	snapshot, err := snapshotKeyDir(tlsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err = runRotationStage(cfg, tlsDir, opts, stage, state)
+	if err != nil {
+		if restoreErr := restoreKeyDir(tlsDir, snapshot); restoreErr != nil {
+			return nil, errors.Join(err, restoreErr)
+		}
+		return nil, err
+	}
+	slog.Info("Rotation stage completed", slog.String("stage", opts.Stage), slog.String("activeKid", state.ActiveKeyID))
+
+	return state, nil
+}
+
+// runRotationStage runs the stage of opts from the current stage and state, records it in the
+// rotation state file and publishes the regenerated JWKS.
+func runRotationStage(cfg *Config, tlsDir string, opts RotateOptions, stage string, state *RotationState) (*RotationState, error) {
+	var err error
+	switch opts.Stage {
+	case RotationStagePrepare:
+		if stage == RotationStagePrepare || stage == RotationStageActivate {
+			return nil, fmt.Errorf("a rotation is already in progress (stage %s), retire it first", stage)
+		}
+		state, err = prepareRotation(cfg, tlsDir, opts.Bits)
+	case RotationStageActivate:
+		if stage != RotationStagePrepare {
+			return nil, fmt.Errorf("activate requires the prepare stage, current stage is %q", stage)
+		}
+		state, err = activateRotation(cfg, tlsDir, state)
+	case RotationStageRetire:
+		if stage != RotationStageActivate {
+			return nil, fmt.Errorf("retire requires the activate stage, current stage is %q", stage)
+		}
+		state, err = retireRotation(cfg, tlsDir, state)
+	default:
+		return nil, fmt.Errorf("unknown rotation stage %q, must be %s, %s or %s",
+			opts.Stage, RotationStagePrepare, RotationStageActivate, RotationStageRetire)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state.Stage = opts.Stage
+	state.UpdatedAt = time.Now().UTC()
+	stateJSON, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rotation state: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(tlsDir, RotationStateFileName), stateJSON, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write rotation state: %w", err)
+	}
+
+	if err := publishRotatedJWKS(cfg); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// snapshotKeyDir returns the content and permissions of every file of the key directory, to
+// roll back a rotation stage with restoreKeyDir.
+func snapshotKeyDir(tlsDir string) ([]atomicFile, error) {
+	var files []atomicFile
+	err := filepath.WalkDir(tlsDir, func(name string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		file, err := readPreviousFile(name)
+		if err != nil || file == nil {
+			return err
+		}
+		files = append(files, *file)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key directory: %w", err)
+	}
+
+	return files, nil
+}
+
+// restoreKeyDir restores the key directory to the snapshot taken by snapshotKeyDir: the files
+// and subdirectories created since are removed and the snapshot files are written back.
+func restoreKeyDir(tlsDir string, snapshot []atomicFile) error {
+	kept := make(map[string]bool, len(snapshot))
+	for _, file := range snapshot {
+		kept[file.name] = true
+		for dir := filepath.Dir(file.name); dir != tlsDir && !kept[dir]; dir = filepath.Dir(dir) {
+			kept[dir] = true
+		}
+	}
+
+	var created []string
+	err := filepath.WalkDir(tlsDir, func(name string, entry os.DirEntry, err error) error {
+		if err != nil || name == tlsDir || kept[name] {
+			return err
+		}
+		created = append(created, name)
+		if entry.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to roll back key directory: %w", err)
+	}
+	for _, name := range created {
+		if err := os.RemoveAll(name); err != nil {
+			return fmt.Errorf("failed to roll back key directory: %w", err)
+		}
+	}
+
+	for _, file := range snapshot {
+		if err := os.MkdirAll(filepath.Dir(file.name), 0755); err != nil {
+			return fmt.Errorf("failed to roll back key directory: %w", err)
+		}
+		if err := writeFileAtomic(file.name, file.data, file.perm); err != nil {
+			return fmt.Errorf("failed to roll back %s: %w", file.name, err)
+		}
+	}
+
+	return nil
+}
+
+// prepareRotation generates the next key pair, which CreateJSONWebKeySet then publishes.
+func prepareRotation(cfg *Config, tlsDir string, bits int) (*RotationState, error) {
+	privateKey, err := ParsePrivateKeyFromFile(cfg.OutputDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	activeKeyID, err := keyPairKeyID(cfg.OutputDir, &privateKey.PublicKey, cfg.JWKS.KeyID, cfg.JWKS.KeyIDHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if bits <= 0 {
+		bits = DefaultRSAKeySize
+	}
+	if err := checkKeySize(bits, cfg.JWKS.MinKeySize); err != nil {
+		return nil, err
+	}
+	privateKeyPEM, publicKeyPEM, err := generateRSAKeyPairPEM(bits)
+	if err != nil {
+		return nil, err
+	}
+
+	if KeyLayout(cfg.OutputDir) == KeyLayoutNested {
+		nextKeyID, err := writeNestedKeyPair(cfg.OutputDir, privateKeyPEM, publicKeyPEM, cfg.JWKS.KeyIDHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write next key pair: %w", err)
+		}
+		return &RotationState{ActiveKeyID: activeKeyID, NextKeyID: nextKeyID}, nil
+	}
+
+	if err := writeFilesAtomic(
+		atomicFile{name: filepath.Join(tlsDir, NextPrivateKeyFile), data: privateKeyPEM, perm: 0600},
+		atomicFile{name: filepath.Join(tlsDir, NextPublicKeyFile), data: publicKeyPEM, perm: 0644},
+	); err != nil {
+		return nil, fmt.Errorf("failed to write next key pair: %w", err)
+	}
+
+	nextKey, err := ParsePrivateKeyFromPEMFile(filepath.Join(tlsDir, NextPrivateKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse next private key: %w", err)
+	}
+
+	return &RotationState{
+		ActiveKeyID: activeKeyID,
+		NextKeyID:   keyIDFromPublicKey(&nextKey.PublicKey, cfg.JWKS.KeyIDHash),
+	}, nil
+}
+
+// activateRotation swaps the key pair with the next key pair, keeping the former key pair as
+// the previous key. The certificate of the former key pair is removed to be recreated for
+// the new one.
+func activateRotation(cfg *Config, tlsDir string, state *RotationState) (*RotationState, error) {
+	if err := checkActivatedKeyID(cfg.OutputDir, cfg.JWKS.KeyID, state.NextKeyID); err != nil {
+		return nil, err
+	}
+	// The activated key is published with its label when set, like the key pair
+	activatedKeyID := state.NextKeyID
+	if cfg.JWKS.KeyID != "" {
+		activatedKeyID = cfg.JWKS.KeyID
+	}
+
+	if KeyLayout(cfg.OutputDir) == KeyLayoutNested {
+		if err := setActiveNestedKeyID(cfg.OutputDir, state.NextKeyID); err != nil {
+			return nil, fmt.Errorf("failed to activate next key pair: %w", err)
+		}
+		return &RotationState{ActiveKeyID: activatedKeyID, PreviousKeyID: state.ActiveKeyID}, nil
+	}
+
+	read := func(name string) ([]byte, error) {
+		data, err := os.ReadFile(filepath.Join(tlsDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		return data, nil
+	}
+
+	var contents [4][]byte
+	for i, name := range []string{RSAPrivateKeyFile, RSAPublicKeyFile, NextPrivateKeyFile, NextPublicKeyFile} {
+		data, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+		contents[i] = data
+	}
+
+	if err := writeFilesAtomic(
+		atomicFile{name: filepath.Join(tlsDir, PreviousPrivateKeyFile), data: contents[0], perm: 0600},
+		atomicFile{name: filepath.Join(tlsDir, PreviousPublicKeyFile), data: contents[1], perm: 0644},
+		atomicFile{name: filepath.Join(tlsDir, RSAPrivateKeyFile), data: contents[2], perm: 0600},
+		atomicFile{name: filepath.Join(tlsDir, RSAPublicKeyFile), data: contents[3], perm: 0644},
+	); err != nil {
+		return nil, fmt.Errorf("failed to activate next key pair: %w", err)
+	}
+
+	for _, name := range []string{NextPrivateKeyFile, NextPublicKeyFile, CertificateFile} {
+		if err := os.Remove(filepath.Join(tlsDir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+
+	return &RotationState{
+		ActiveKeyID:   activatedKeyID,
+		PreviousKeyID: state.ActiveKeyID,
+	}, nil
+}
+
+// checkActivatedKeyID returns an error when keyID, the key ID given to the activated key, is
+// already published in the JWK Set of the specified directory for another key than the next
+// key, such as the previous key, which is still published after the activation. Both keys
+// would otherwise share a key ID, leaving verifiers unable to tell which one signed a token.
+func checkActivatedKeyID(filePath, keyID, nextKeyID string) error {
+	if keyID == "" || keyID == nextKeyID {
+		return nil
+	}
+
+	jwkSet, err := jwk.ReadFile(filepath.Join(filePath, TLSDirName, JWKSFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read JWK Set: %w", err)
+	}
+	if _, ok := jwkSet.LookupKeyID(keyID); ok {
+		return fmt.Errorf("key ID %s is already published for another key in the JWK Set, choose a new key ID for the activated key", keyID)
+	}
+
+	return nil
+}
+
+// retireRotation deletes the previous key pair, which CreateJSONWebKeySet then stops publishing.
+func retireRotation(cfg *Config, tlsDir string, state *RotationState) (*RotationState, error) {
+	if KeyLayout(cfg.OutputDir) == KeyLayoutNested {
+		if err := ValidateKeyID(state.PreviousKeyID); err != nil {
+			return nil, fmt.Errorf("invalid previous key in rotation state: %w", err)
+		}
+		if err := os.RemoveAll(filepath.Join(tlsDir, state.PreviousKeyID)); err != nil {
+			return nil, fmt.Errorf("failed to remove previous key pair: %w", err)
+		}
+		return &RotationState{ActiveKeyID: state.ActiveKeyID}, nil
+	}
+
+	for _, name := range []string{PreviousPrivateKeyFile, PreviousPublicKeyFile} {
+		if err := os.Remove(filepath.Join(tlsDir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+
+	return &RotationState{ActiveKeyID: state.ActiveKeyID}, nil
+}
+
+// publishRotatedJWKS regenerates the JWKS of the key pair and of the key staged by the
+// rotation, and uploads it to the bucket when one is configured.
+func publishRotatedJWKS(cfg *Config) error {
+	if _, err := CreateJSONWebKeySet(cfg.OutputDir, cfg.JWKS); err != nil {
+		return fmt.Errorf("failed to create JWKS: %w", err)
+	}
+
+	if cfg.BucketName == "" || cfg.SkipBucket {
+		slog.Info("No bucket configured, publish the regenerated JWKS to the issuer.",
+			slog.String("file", filepath.Join(cfg.OutputDir, TLSDirName, JWKSFileName)))
+		return nil
+	}
+
+	awsCfg, err := awsProvider.AwsClient(cfg.ClientOptions())
+	if err != nil {
+		return fmt.Errorf("failed to create AWS client: %w", err)
+	}
+	s3Service := &awsProvider.S3Service{
+		Client:       awsProvider.NewS3Client(awsCfg, cfg.ClientOptions()),
+		BucketName:   cfg.BucketName,
+		Region:       cfg.Region,
+		StorageClass: cfg.StorageClass,
+		PublicRead:   cfg.Public,
+	}
+
+	jwksOnly := *cfg
+	jwksOnly.NoDiscovery = true
+	return uploadIdentityProviderDocuments(&jwksOnly, s3Service, nil)
+}
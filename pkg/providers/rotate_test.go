@@ -0,0 +1,121 @@
+package providers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotateActivateRejectsPublishedKeyID(t *testing.T) {
+	dir := newTestKeyPairDir(t)
+	cfg := &Config{OutputDir: dir, JWKS: JWKSOptions{KeyID: "signing", MinKeySize: 2048}}
+	if _, err := CreateJSONWebKeySet(dir, cfg.JWKS); err != nil {
+		t.Fatalf("CreateJSONWebKeySet: %v", err)
+	}
+	if _, err := RotateKeys(RotateOptions{Config: cfg, Stage: RotationStagePrepare, Bits: 2048}); err != nil {
+		t.Fatalf("RotateKeys(prepare): %v", err)
+	}
+	privateKeyPEM, err := os.ReadFile(filepath.Join(dir, TLSDirName, RSAPrivateKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The previous key keeps its "signing" key ID, which the activated key cannot reuse
+	_, err = RotateKeys(RotateOptions{Config: cfg, Stage: RotationStageActivate})
+	if err == nil || !strings.Contains(err.Error(), "key ID signing is already published") {
+		t.Fatalf("err = %v, want the duplicate key ID error", err)
+	}
+	state, err := ReadRotationState(dir)
+	if err != nil {
+		t.Fatalf("ReadRotationState: %v", err)
+	}
+	if state.Stage != RotationStagePrepare {
+		t.Errorf("stage = %q, want the rotation to stay prepared", state.Stage)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, TLSDirName, RSAPrivateKeyFile)); err != nil || string(data) != string(privateKeyPEM) {
+		t.Errorf("the key pair was swapped despite the rejected key ID")
+	}
+
+	cfg.JWKS.KeyID = "signing-next"
+	state, err = RotateKeys(RotateOptions{Config: cfg, Stage: RotationStageActivate})
+	if err != nil {
+		t.Fatalf("RotateKeys(activate): %v", err)
+	}
+	if state.ActiveKeyID != "signing-next" {
+		t.Errorf("active kid = %q, want the published kid %q", state.ActiveKeyID, "signing-next")
+	}
+	if saved, err := ReadRotationState(dir); err != nil || saved.ActiveKeyID != "signing-next" {
+		t.Errorf("saved active kid = %v (%v), want %q", saved, err, "signing-next")
+	}
+	set := readTestJWKS(t, dir)
+	for _, keyID := range []string{"signing", "signing-next"} {
+		if _, ok := set.LookupKeyID(keyID); !ok {
+			t.Errorf("kid %q is not published", keyID)
+		}
+	}
+}
+
+func TestRotateRollsBackWhenPublishFails(t *testing.T) {
+	dir := newTestKeyPairDir(t)
+	cfg := &Config{OutputDir: dir, JWKS: JWKSOptions{MinKeySize: 2048}}
+	if _, err := CreateJSONWebKeySet(dir, cfg.JWKS); err != nil {
+		t.Fatalf("CreateJSONWebKeySet: %v", err)
+	}
+	jwksJSON, err := os.ReadFile(filepath.Join(dir, TLSDirName, JWKSFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// AWS denies every request, so the JWKS cannot be uploaded
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code>` +
+			`<Message>denied</Message></Error></ErrorResponse>`))
+	}))
+	defer server.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	failing := *cfg
+	failing.BucketName = "my-oidc-bucket"
+	failing.Region = "us-east-1"
+	failing.Endpoints.EndpointURL = server.URL
+
+	if _, err := RotateKeys(RotateOptions{Config: &failing, Stage: RotationStagePrepare, Bits: 2048}); err == nil {
+		t.Fatal("RotateKeys(prepare) succeeded although the JWKS was not published")
+	}
+	if state, err := ReadRotationState(dir); err != nil || state != nil {
+		t.Fatalf("rotation state = %v (%v), want none after the failed prepare", state, err)
+	}
+	for _, name := range []string{NextPrivateKeyFile, NextPublicKeyFile} {
+		if _, err := os.Stat(filepath.Join(dir, TLSDirName, name)); !os.IsNotExist(err) {
+			t.Errorf("%s was kept after the failed prepare", name)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, TLSDirName, JWKSFileName)); err != nil || string(data) != string(jwksJSON) {
+		t.Error("the JWKS was not rolled back after the failed prepare")
+	}
+
+	// The next key is never activated before it is published
+	if _, err := RotateKeys(RotateOptions{Config: cfg, Stage: RotationStageActivate}); err == nil {
+		t.Error("RotateKeys(activate) succeeded after the failed prepare")
+	}
+	if _, err := RotateKeys(RotateOptions{Config: cfg, Stage: RotationStagePrepare, Bits: 2048}); err != nil {
+		t.Fatalf("RotateKeys(prepare) after the failed prepare: %v", err)
+	}
+	state, err := RotateKeys(RotateOptions{Config: &failing, Stage: RotationStageActivate})
+	if err == nil {
+		t.Fatal("RotateKeys(activate) succeeded although the JWKS was not published")
+	}
+	if state, err = ReadRotationState(dir); err != nil || state.Stage != RotationStagePrepare {
+		t.Fatalf("rotation state = %v (%v), want the prepare stage after the failed activate", state, err)
+	}
+	if _, err := RotateKeys(RotateOptions{Config: cfg, Stage: RotationStageActivate}); err != nil {
+		t.Errorf("RotateKeys(activate) after the failed activate: %v", err)
+	}
+}
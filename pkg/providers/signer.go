@@ -0,0 +1,65 @@
+package providers
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+)
+
+const (
+	// SignerFile signs with the private key file of the key pair in the output directory.
+	SignerFile = "file"
+	// SignerPKCS11 signs with a key held in a PKCS#11 token, e.g. an HSM.
+	SignerPKCS11 = "pkcs11"
+)
+
+// Signer is an RSA private key signing the JWTs and the self-signed certificate without
+// being exposed to the process, e.g. a key held in an HSM.
+type Signer interface {
+	crypto.Signer
+	// Close releases the resources held by the signer, such as the PKCS#11 session.
+	Close() error
+}
+
+// SignerOptions selects the signer of the JWTs and its settings.
+type SignerOptions struct {
+	// Type is SignerFile or SignerPKCS11.
+	Type string
+	// PKCS11Library is the path of the PKCS#11 module, e.g. /usr/lib/softhsm/libsofthsm2.so.
+	PKCS11Library string
+	// PKCS11TokenLabel is the label of the token holding the key.
+	PKCS11TokenLabel string
+	// PKCS11KeyLabel is the label of the RSA key pair in the token.
+	PKCS11KeyLabel string
+	// PKCS11PIN is the user PIN of the token.
+	PKCS11PIN string
+}
+
+// NewSigner opens the signer selected by opts. The file signer has no Signer, as the
+// private key file is read directly, so nil is returned for SignerFile.
+//
+// Returns:
+//   - Signer: The opened signer, to be closed by the caller, or nil for SignerFile.
+//   - error: An error if the signer type is unknown or the signer cannot be opened.
+func NewSigner(opts SignerOptions) (Signer, error) {
+	switch opts.Type {
+	case "", SignerFile:
+		return nil, nil
+	case SignerPKCS11:
+		if opts.PKCS11Library == "" || opts.PKCS11TokenLabel == "" || opts.PKCS11KeyLabel == "" {
+			return nil, fmt.Errorf("the PKCS#11 signer requires a library, a token label and a key label")
+		}
+		return newPKCS11Signer(opts)
+	default:
+		return nil, fmt.Errorf("unsupported signer %q, expected %s or %s", opts.Type, SignerFile, SignerPKCS11)
+	}
+}
+
+// signerPublicKey returns the RSA public key of the signer.
+func signerPublicKey(signer crypto.Signer) (*rsa.PublicKey, error) {
+	publicKey, ok := signer.Public().(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("signer key is a %T, only RSA keys are supported", signer.Public())
+	}
+	return publicKey, nil
+}
@@ -0,0 +1,46 @@
+//go:build cgo
+
+package providers
+
+import (
+	"fmt"
+
+	"github.com/ThalesGroup/crypto11"
+)
+
+// pkcs11Signer signs with a key pair held in a PKCS#11 token.
+type pkcs11Signer struct {
+	crypto11.Signer
+	ctx *crypto11.Context
+}
+
+// Close closes the PKCS#11 session.
+func (s *pkcs11Signer) Close() error {
+	return s.ctx.Close()
+}
+
+// newPKCS11Signer logs into the PKCS#11 token and finds the RSA key pair with the configured label.
+func newPKCS11Signer(opts SignerOptions) (Signer, error) {
+	ctx, err := crypto11.Configure(&crypto11.Config{
+		Path:       opts.PKCS11Library,
+		TokenLabel: opts.PKCS11TokenLabel,
+		Pin:        opts.PKCS11PIN,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PKCS#11 token %s: %w", opts.PKCS11TokenLabel, err)
+	}
+
+	key, err := ctx.FindKeyPair(nil, []byte(opts.PKCS11KeyLabel))
+	if err == nil && key == nil {
+		err = fmt.Errorf("key pair not found")
+	}
+	if err == nil {
+		_, err = signerPublicKey(key)
+	}
+	if err != nil {
+		ctx.Close()
+		return nil, fmt.Errorf("failed to load PKCS#11 key %s: %w", opts.PKCS11KeyLabel, err)
+	}
+
+	return &pkcs11Signer{Signer: key, ctx: ctx}, nil
+}
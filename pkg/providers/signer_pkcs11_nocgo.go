@@ -0,0 +1,10 @@
+//go:build !cgo
+
+package providers
+
+import "fmt"
+
+// newPKCS11Signer reports that the PKCS#11 signer is not available, as it relies on cgo.
+func newPKCS11Signer(opts SignerOptions) (Signer, error) {
+	return nil, fmt.Errorf("the PKCS#11 signer requires a build with cgo enabled")
+}
@@ -0,0 +1,57 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadTagsFile reads the tags listed in the given file, either as a JSON object of string
+// values, e.g. {"team": "platform"}, or as key=value lines. In the latter format, blank lines
+// and lines starting with # are ignored, and the key and value are trimmed of spaces.
+func ReadTagsFile(filePath string) (map[string]string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags file: %w", err)
+	}
+
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("{")) {
+		var tags map[string]string
+		if err := json.Unmarshal(trimmed, &tags); err != nil {
+			return nil, fmt.Errorf("failed to parse tags file %s: %w", filePath, err)
+		}
+		return tags, nil
+	}
+
+	tags := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, err := ParseTag(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag on line %d of %s: %w", lineNumber, filePath, err)
+		}
+		tags[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tags file: %w", err)
+	}
+
+	return tags, nil
+}
+
+// ParseTag parses a tag written as key=value. The key and value are trimmed of spaces and the
+// value may be empty.
+func ParseTag(tag string) (string, string, error) {
+	key, value, ok := strings.Cut(tag, "=")
+	if !ok {
+		return "", "", fmt.Errorf("tag %q must be written as key=value", tag)
+	}
+	return strings.TrimSpace(key), strings.TrimSpace(value), nil
+}
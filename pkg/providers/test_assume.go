@@ -0,0 +1,138 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go"
+	awsProvider "github.com/chuhaoyuu/aws-oidc-sts/pkg/providers/aws"
+)
+
+// TestAssumeSessionName is the role session name of the AssumeRoleWithWebIdentity call of TestAssumeRole.
+const TestAssumeSessionName = "aws-oidc-sts-test-assume"
+
+// TestAssumeOptions holds the settings of the end-to-end test run by TestAssumeRole.
+type TestAssumeOptions struct {
+	// Config locates the key pair (OutputDir) and configures the AWS client. When Token is not
+	// set, the JWT is signed with its JWKS and JWT settings, for the issuer of IssuerOverride
+	// or of the local openid-configuration.
+	Config *Config
+	// RoleARN is the ARN of the role assumed with the token.
+	RoleARN string
+	// Token is the web identity token to exchange. When nil, a fresh JWT is signed with the
+	// key pair, with the role name as subject unless Config.JWT.Subject is set.
+	Token []byte
+}
+
+// TestAssumeRole proves that the whole setup works by exchanging a web identity token for
+// credentials of the role with AssumeRoleWithWebIdentity, then calling GetCallerIdentity with
+// the temporary credentials to report the assumed identity.
+//
+// AssumeRoleWithWebIdentity is not signed, so no AWS credentials are needed to run the test.
+// When it fails, AssumeRoleHint suggests the likely cause of the returned error.
+//
+// Returns:
+//   - *AssumeRoleResult: The identity of the assumed role session.
+//   - error: An error if the token cannot be signed, STS rejects it or the identity cannot be read.
+func TestAssumeRole(opts TestAssumeOptions) (*AssumeRoleResult, error) {
+	cfg := opts.Config
+
+	token := opts.Token
+	if token == nil {
+		var err error
+		token, err = signTestToken(cfg, opts.RoleARN)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	awsCfg, err := awsProvider.LoadConfig(cfg.ClientOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS client: %w", err)
+	}
+
+	out, err := awsProvider.AssumeRoleWithWebIdentity(awsCfg, cfg.ClientOptions(), opts.RoleARN, strings.TrimSpace(string(token)), TestAssumeSessionName)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := awsProvider.CallerIdentityWithCredentials(awsCfg, cfg.ClientOptions(), out.Credentials)
+	if err != nil {
+		return nil, fmt.Errorf("role assumed but failed to get the assumed identity: %w", err)
+	}
+
+	return &AssumeRoleResult{
+		AssumedRoleARN: aws.ToString(identity.Arn),
+		Account:        aws.ToString(identity.Account),
+		UserID:         aws.ToString(identity.UserId),
+		Expiration:     aws.ToTime(out.Credentials.Expiration).UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// signTestToken signs a fresh JWT with the key pair of the configuration, for the issuer of
+// IssuerOverride or of the local openid-configuration.
+func signTestToken(cfg *Config, roleARN string) ([]byte, error) {
+	signingKey, err := SigningKey(cfg.OutputDir, cfg.JWKS.KeyID, cfg.JWKS.KeyIDHash, cfg.JWKS.Signer, cfg.JWKS.MinKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key: %w", err)
+	}
+
+	jwtOptions := cfg.JWT
+	jwtOptions.Issuer = strings.TrimSuffix(cfg.IssuerOverride, "/")
+	if jwtOptions.Issuer == "" {
+		if jwtOptions.Issuer, err = localIssuer(cfg.OutputDir); err != nil {
+			return nil, err
+		}
+	}
+	if jwtOptions.Subject == "" {
+		// Without an explicit subject, the role was created with its name as subject.
+		if jwtOptions.Subject, err = awsProvider.RoleNameFromARN(roleARN); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.JWKS.Signer != nil {
+		jwtOptions.Signer = cfg.JWKS.Signer
+	}
+
+	token, err := CreateJWT(signingKey, jwtOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWT: %w", err)
+	}
+	return token, nil
+}
+
+// AssumeRoleHint maps the error of a failed AssumeRoleWithWebIdentity call to the likely cause
+// and how to fix it, or returns an empty string when the cause is not recognized.
+func AssumeRoleHint(err error) string {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return ""
+	}
+	message := strings.ToLower(apiErr.ErrorMessage())
+
+	switch apiErr.ErrorCode() {
+	case "InvalidIdentityToken":
+		switch {
+		case strings.Contains(message, "audience"):
+			return "The aud claim of the token is not a client ID of the IAM OIDC provider: sign the token with one of the --audience values of identity-provider."
+		case strings.Contains(message, "thumbprint"):
+			return "The certificate of the JWKS host does not match the thumbprints of the IAM OIDC provider: update them with the thumbprint of its certificate chain."
+		case strings.Contains(message, "no openidconnect provider found"):
+			return "There is no IAM OIDC provider for the iss claim of the token: check that the issuer matches the provider URL exactly, without trailing slash."
+		case strings.Contains(message, "expired"):
+			return "The token is expired: sign a fresh one, e.g. with refresh-token."
+		}
+		return "STS rejected the token: check its iss, aud and kid against the IAM OIDC provider and the published JWKS, e.g. with doctor."
+	case "IDPCommunicationError":
+		return "STS could not fetch the JWKS from the issuer: check that the openid-configuration and the JWKS are publicly reachable over HTTPS, e.g. with verify-issuers."
+	case "ExpiredTokenException":
+		return "The token is expired: sign a fresh one, e.g. with refresh-token."
+	case "AccessDenied":
+		return "The trust policy of the role does not allow the token: check that its sub and aud conditions match the token claims, e.g. with trust-policy --print-condition-keys."
+	}
+
+	return ""
+}
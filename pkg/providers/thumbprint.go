@@ -0,0 +1,98 @@
+package providers
+
+import (
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// FetchThumbprint dials the host of the given HTTPS URL over TLS and returns the thumbprint
+// IAM expects for an OIDC identity provider: the hex-encoded SHA-1 fingerprint of the last
+// certificate of the chain presented by the server, i.e. its top intermediate or root CA.
+//
+// Parameters:
+//   - rawURL: The HTTPS URL whose host serves the JWKS, usually the issuer or jwks_uri.
+//
+// Returns:
+//   - string: The lowercase hex-encoded thumbprint.
+//   - error: An error if the URL is invalid, the TLS handshake fails or no certificate is presented.
+func FetchThumbprint(rawURL string) (string, error) {
+	certificates, err := fetchCertificateChain(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	fingerprint := sha1.Sum(certificates[len(certificates)-1].Raw)
+
+	return hex.EncodeToString(fingerprint[:]), nil
+}
+
+// fetchCertificateChain returns the certificate chain presented by the host of the given HTTPS URL.
+func fetchCertificateChain(rawURL string) ([]*x509.Certificate, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL %s: %w", rawURL, err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("URL %s must use https", rawURL)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(u.Hostname(), port), &tls.Config{
+		ServerName: u.Hostname(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", u.Host, err)
+	}
+	defer conn.Close()
+
+	peerCertificates := conn.ConnectionState().PeerCertificates
+	if len(peerCertificates) == 0 {
+		return nil, fmt.Errorf("no certificate presented by %s", u.Host)
+	}
+
+	return peerCertificates, nil
+}
+
+// CheckThumbprints dials the host of the given HTTPS URL and checks that each of the supplied
+// thumbprints is the SHA-1 fingerprint of a certificate of the chain it presents, so that a
+// stale or mistyped thumbprint is caught before STS distrusts the IAM OIDC provider.
+//
+// Returns:
+//   - nil if every thumbprint matches a certificate of the chain.
+//   - an error naming the thumbprints matching none of them, or if the chain cannot be fetched.
+func CheckThumbprints(rawURL string, thumbprints []string) error {
+	certificates, err := fetchCertificateChain(rawURL)
+	if err != nil {
+		return err
+	}
+
+	presented := make(map[string]bool, len(certificates))
+	for _, certificate := range certificates {
+		fingerprint := sha1.Sum(certificate.Raw)
+		presented[hex.EncodeToString(fingerprint[:])] = true
+	}
+
+	var unmatched []string
+	for _, thumbprint := range thumbprints {
+		if !presented[strings.ToLower(thumbprint)] {
+			unmatched = append(unmatched, thumbprint)
+		}
+	}
+	if len(unmatched) > 0 {
+		return fmt.Errorf("thumbprints %s match no certificate presented by %s", strings.Join(unmatched, ", "), rawURL)
+	}
+
+	return nil
+}
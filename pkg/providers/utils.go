@@ -13,7 +13,8 @@ import (
 // decodes the PEM block, and parses the public key.
 //
 // Parameters:
-//   - filePath: The path to the directory containing the public key file.
+//   - filePath: The path to the directory containing the public key file, in the flat or
+//     nested key layout (see KeyLayout).
 //
 // Returns:
 //   - any: The parsed public key object.
@@ -25,8 +26,21 @@ import (
 //   - Returns an error if the PEM block is invalid or cannot be decoded.
 //   - Returns an error if the public key cannot be parsed.
 func ParsePublicKeyFromFile(filePath string) (any, error) {
+	dir, err := keyPairDir(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKeyFromPEMFile(filepath.Join(dir, RSAPublicKeyFile))
+}
+
+// ParsePublicKeyFromPEMFile reads a PEM-encoded PKIX public key from the given file
+// path and parses it.
+//
+// Unlike ParsePublicKeyFromFile, keyFile is the path of the key file itself rather
+// than the directory containing it, which allows reading keys stored elsewhere.
+func ParsePublicKeyFromPEMFile(keyFile string) (any, error) {
 	// Read the public key from the specified file
-	publicKeyPem, err := os.ReadFile(filepath.Join(filePath, TLSDirName, RSAPublicKeyFile))
+	publicKeyPem, err := os.ReadFile(keyFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read public key file: %w", err)
 	}
@@ -58,10 +72,24 @@ func ParsePublicKeyFromFile(filePath string) (any, error) {
 //     or the private key cannot be parsed.
 //
 // The function expects the private key file to be named as specified by the
-// RSAPrivateKeyFile constant and located in the provided directory path.
+// RSAPrivateKeyFile constant and located in the provided directory path, in the flat or
+// nested key layout (see KeyLayout).
 func ParsePrivateKeyFromFile(filePath string) (*rsa.PrivateKey, error) {
+	dir, err := keyPairDir(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKeyFromPEMFile(filepath.Join(dir, RSAPrivateKeyFile))
+}
+
+// ParsePrivateKeyFromPEMFile reads a PEM-encoded PKCS#1 RSA private key from the
+// given file path and parses it into an *rsa.PrivateKey.
+//
+// Unlike ParsePrivateKeyFromFile, keyFile is the path of the key file itself rather
+// than the directory containing it, which allows reading keys stored elsewhere.
+func ParsePrivateKeyFromPEMFile(keyFile string) (*rsa.PrivateKey, error) {
 	// Read the private key from the specified file
-	privateKeyPem, err := os.ReadFile(filepath.Join(filePath, TLSDirName, RSAPrivateKeyFile))
+	privateKeyPem, err := os.ReadFile(keyFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read private key file: %w", err)
 	}
@@ -80,3 +108,39 @@ func ParsePrivateKeyFromFile(filePath string) (*rsa.PrivateKey, error) {
 
 	return privateKey, nil
 }
+
+// ParseCertificateFromFile reads the PEM-encoded X.509 certificate of the key pair stored in
+// the specified directory and parses it.
+//
+// Parameters:
+//   - filePath: The path to the directory containing the certificate file.
+//
+// Returns:
+//   - *x509.Certificate: The parsed certificate.
+//   - error: An error if the file cannot be read, the PEM block cannot be decoded,
+//     or the certificate cannot be parsed.
+func ParseCertificateFromFile(filePath string) (*x509.Certificate, error) {
+	// Read the certificate from the specified file
+	dir, err := keyPairDir(filePath)
+	if err != nil {
+		return nil, err
+	}
+	certificatePem, err := os.ReadFile(filepath.Join(dir, CertificateFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate file: %w", err)
+	}
+
+	// Decode the PEM-encoded certificate
+	block, _ := pem.Decode(certificatePem)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block containing certificate")
+	}
+
+	// Parse the certificate
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return certificate, nil
+}
@@ -0,0 +1,161 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	awsProvider "github.com/chuhaoyuu/aws-oidc-sts/pkg/providers/aws"
+)
+
+// ValidateConfig checks every input of an identity provider provisioned in AWS before any key
+// is read for signing, file is written or AWS API is called, so that all the problems of a
+// first run are reported at once instead of one per attempt.
+//
+// The following inputs are checked:
+//  1. The key pair, or the Signer, and the additional keys are RSA keys of at least MinKeySize bits.
+//  2. The key ID, the key ID hash, the x5t algorithm and the wrapper of the JWKS options.
+//  3. The JWT audiences are accepted by the identity provider.
+//  4. The region is set and, unless SkipBucket is set, the bucket name follows the S3 naming
+//     rules and its object ownership allows the ACLs of Public. With SkipBucket, the external issuer and JWKS URI are https URLs.
+//  5. The storage class, the lifecycle settings, the role name, the thumbprints and the tags.
+//  6. SourceIdentityMatchesSubject is only set with AllowSourceIdentity.
+//  7. The source IPs are IP addresses or CIDR blocks and the source VPC endpoints are VPC endpoint IDs.
+//
+// The inputs 1 to 3 are not checked with SkipBucket, as the JWKS is then hosted and signed
+// elsewhere.
+//
+// Returns:
+//   - nil if the configuration is valid.
+//   - an error joining one error per problem found with errors.Join.
+func ValidateConfig(cfg *Config) error {
+	var errs []error
+	if !cfg.SkipBucket {
+		errs = validateKeyConfig(cfg)
+	}
+
+	if cfg.Region == "" {
+		errs = append(errs, fmt.Errorf("a region is required"))
+	}
+
+	if cfg.SkipBucket {
+		if cfg.IssuerOverride == "" {
+			errs = append(errs, fmt.Errorf("an issuer is required when the bucket is skipped"))
+		} else if err := checkIssuer(cfg.Issuer()); err != nil {
+			errs = append(errs, err)
+		}
+		if cfg.JWKSURIOverride != "" && !strings.HasPrefix(cfg.JWKSURIOverride, "https://") {
+			errs = append(errs, fmt.Errorf("JWKS URI %s must use https", cfg.JWKSURIOverride))
+		}
+	} else {
+		if err := awsProvider.ValidateBucketName(cfg.BucketName); err != nil {
+			errs = append(errs, err)
+		}
+		if err := awsProvider.ValidateObjectOwnership(cfg.BucketObjectOwnership(), cfg.Public); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if cfg.StorageClass != "" {
+		if err := awsProvider.ValidateStorageClass(cfg.StorageClass); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if cfg.LifecycleExpireDays < 0 {
+		errs = append(errs, fmt.Errorf("lifecycle expiration of %d days must not be negative", cfg.LifecycleExpireDays))
+	} else if cfg.LifecycleExpireDays > 0 {
+		if _, err := cfg.LifecycleRulePrefix(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if cfg.RoleName != "" && !iamRoleName.MatchString(cfg.RoleName) {
+		errs = append(errs, fmt.Errorf("role name %q must be 1 to 64 letters, digits or '+=,.@_-' characters", cfg.RoleName))
+	}
+
+	for _, thumbprint := range cfg.Thumbprints {
+		if !thumbprintPattern.MatchString(thumbprint) {
+			errs = append(errs, fmt.Errorf("thumbprint %q must be 40 hexadecimal characters", thumbprint))
+		}
+	}
+
+	if err := awsProvider.ValidateTags(cfg.Tags); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.SourceIdentityMatchesSubject && !cfg.AllowSourceIdentity {
+		errs = append(errs, fmt.Errorf("matching the source identity to the subject requires allowing the source identity"))
+	}
+
+	if err := awsProvider.ValidateSourceIPs(cfg.SourceIPs); err != nil {
+		errs = append(errs, err)
+	}
+	if err := awsProvider.ValidateSourceVPCEs(cfg.SourceVPCEs); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateKeyConfig returns the problems of the key and token inputs of cfg, which are shared
+// by the identity providers provisioned in AWS and the local ones.
+func validateKeyConfig(cfg *Config) []error {
+	var errs []error
+
+	if cfg.JWKS.Signer != nil {
+		if publicKey, err := signerPublicKey(cfg.JWKS.Signer); err != nil {
+			errs = append(errs, err)
+		} else if err := checkKeySize(publicKey.N.BitLen(), cfg.JWKS.MinKeySize); err != nil {
+			errs = append(errs, err)
+		}
+	} else if privateKey, err := ParsePrivateKeyFromFile(cfg.OutputDir); err != nil {
+		errs = append(errs, fmt.Errorf("failed to parse private key: %w", err))
+	} else if err := checkKeySize(privateKey.N.BitLen(), cfg.JWKS.MinKeySize); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, keyFile := range cfg.JWKS.AdditionalKeyFiles {
+		additionalKey, err := ParsePrivateKeyFromPEMFile(keyFile)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse additional private key %s: %w", keyFile, err))
+		} else if err := checkKeySize(additionalKey.N.BitLen(), cfg.JWKS.MinKeySize); err != nil {
+			errs = append(errs, fmt.Errorf("additional private key %s: %w", keyFile, err))
+		}
+	}
+
+	if cfg.JWKS.KeyID != "" {
+		if err := ValidateKeyID(cfg.JWKS.KeyID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := ValidateKeyIDHash(cfg.JWKS.KeyIDHash); err != nil {
+		errs = append(errs, err)
+	}
+	switch cfg.JWKS.X5TAlgorithm {
+	case "", X5TAlgorithmSHA1, X5TAlgorithmSHA256, X5TAlgorithmBoth:
+	default:
+		errs = append(errs, fmt.Errorf("unsupported x5t algorithm %q, expected %s, %s or %s",
+			cfg.JWKS.X5TAlgorithm, X5TAlgorithmSHA1, X5TAlgorithmSHA256, X5TAlgorithmBoth))
+	}
+
+	if err := ValidateJWKSWrapper(cfg.JWKS.Wrapper); err != nil {
+		errs = append(errs, fmt.Errorf("invalid JWKS wrapper: %w", err))
+	}
+
+	if len(cfg.JWT.Audiences) > 0 {
+		if err := awsProvider.ValidateAudiences(cfg.JWT.Audiences, cfg.AcceptedAudiences()); err != nil {
+			errs = append(errs, fmt.Errorf("invalid JWT audiences: %w", err))
+		}
+	}
+
+	return errs
+}
+
+var (
+	// iamRoleName matches the names accepted by IAM for a role.
+	iamRoleName = regexp.MustCompile(`^[\w+=,.@-]{1,64}$`)
+	// thumbprintPattern matches the hex-encoded SHA-1 thumbprints of an IAM OIDC provider.
+	thumbprintPattern = regexp.MustCompile(`^[0-9A-Fa-f]{40}$`)
+)
@@ -0,0 +1,63 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateConfigValid(t *testing.T) {
+	cfg := &Config{OutputDir: newTestKeyPairDir(t), BucketName: "my-oidc-bucket", Region: "eu-west-1",
+		JWKS: JWKSOptions{MinKeySize: 2048}}
+	if err := ValidateConfig(cfg); err != nil {
+		t.Fatalf("ValidateConfig: %v", err)
+	}
+}
+
+func TestValidateConfigSkipBucketWithoutKeyPair(t *testing.T) {
+	cfg := &Config{OutputDir: t.TempDir(), Region: "eu-west-1", SkipBucket: true,
+		IssuerOverride: "https://oidc.example.com"}
+	if err := ValidateConfig(cfg); err != nil {
+		t.Fatalf("ValidateConfig: %v", err)
+	}
+}
+
+func TestValidateConfigReportsEveryViolation(t *testing.T) {
+	cfg := &Config{
+		OutputDir:   t.TempDir(),
+		BucketName:  "Invalid_Bucket",
+		RoleName:    "role with spaces",
+		Thumbprints: []string{"not-a-thumbprint"},
+		SourceIPs:   []string{"10.0.0.1/8"},
+		SourceVPCEs: []string{"vpc-123"},
+		JWKS:        JWKSOptions{KeyIDHash: "md5", X5TAlgorithm: "md5"},
+	}
+
+	err := ValidateConfig(cfg)
+	if err == nil {
+		t.Fatal("ValidateConfig accepted an invalid configuration")
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("err = %T, want the errors joined with errors.Join", err)
+	}
+
+	want := []string{
+		"failed to parse private key",
+		`key ID hash must be sha1 or sha256, got "md5"`,
+		`unsupported x5t algorithm "md5"`,
+		"a region is required",
+		"Invalid_Bucket",
+		`role name "role with spaces"`,
+		`thumbprint "not-a-thumbprint"`,
+		`source IP "10.0.0.1/8" has host bits set`,
+		`VPC endpoint "vpc-123"`,
+	}
+	if len(joined.Unwrap()) != len(want) {
+		t.Errorf("got %d errors, want %d:\n%v", len(joined.Unwrap()), len(want), err)
+	}
+	for _, message := range want {
+		if !strings.Contains(err.Error(), message) {
+			t.Errorf("error does not report %q:\n%v", message, err)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// requiredJWKParameters lists the parameters a public JWK must carry for each key type,
+// as defined in RFC 7518 section 6 and RFC 8037 section 2.
+var requiredJWKParameters = map[string][]string{
+	"RSA": {"n", "e"},
+	"EC":  {"crv", "x", "y"},
+	"OKP": {"crv", "x"},
+}
+
+// validateJWK checks that the key carries every parameter required by its key type (kty),
+// e.g. "n" and "e" for RSA keys. A key missing one of them would be published as is and
+// break the verification of every token signed with it.
+//
+// Returns:
+//   - nil if the key has all the parameters required by its type.
+//   - an error naming the missing parameters, or the key type if it is not supported.
+func validateJWK(key jwk.Key) error {
+	keyType := key.KeyType().String()
+	parameters, ok := requiredJWKParameters[keyType]
+	if !ok {
+		return fmt.Errorf("unsupported key type %q", keyType)
+	}
+
+	var missing []string
+	for _, parameter := range parameters {
+		if !hasJWKParameter(key, parameter) {
+			missing = append(missing, parameter)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s key is missing required parameters: %s", keyType, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// hasJWKParameter reports whether the key has a non-empty value for the given parameter.
+func hasJWKParameter(key jwk.Key, name string) bool {
+	if !key.Has(name) {
+		return false
+	}
+
+	var value any
+	if err := key.Get(name, &value); err != nil {
+		return false
+	}
+	if b, ok := value.([]byte); ok && len(b) == 0 {
+		return false
+	}
+
+	return true
+}
+
+// validateJWKSet runs validateJWK over every key of the set.
+func validateJWKSet(set jwk.Set) error {
+	for i := 0; i < set.Len(); i++ {
+		key, _ := set.Key(i)
+		if err := validateJWK(key); err != nil {
+			keyID, _ := key.KeyID()
+			return fmt.Errorf("invalid key %q in JWK Set: %w", keyID, err)
+		}
+	}
+
+	return nil
+}
+
+// FetchJWKS retrieves the JWK Set served at the given URL and validates the parameters of
+// each of its keys, as STS would when verifying a token.
+//
+// Parameters:
+//   - jwksURI: The HTTPS URL of the JWK Set, usually the jwks_uri of the discovery document.
+//
+// Returns:
+//   - jwk.Set: The JWK Set served at the URL.
+//   - error: An error if the JWK Set cannot be fetched, parsed or is invalid.
+func FetchJWKS(jwksURI string) (jwk.Set, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(jwksURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", jwksURI, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPStatusError{URL: jwksURI, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", jwksURI, err)
+	}
+
+	set, err := jwk.Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", jwksURI, err)
+	}
+	if err := validateJWKSet(set); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+// ValidateJWKSFile checks that the JWK Set in the given file is fit to be published for STS
+// and returns every issue found rather than stopping at the first one:
+//
+//  1. The file is a JSON object with a "keys" array, and each key parses as a JWK.
+//  2. Every key has a "kid" and the parameters required by its "kty" (see validateJWK).
+//  3. No two keys share the same "kid".
+//  4. With allowedAlgorithms, every key has an "alg" from the list.
+//  5. At least one key is usable for signatures, i.e. has no "use" or a "use" of "sig".
+//
+// Each key is parsed on its own, so that a malformed key does not hide the issues of the others.
+//
+// Parameters:
+//   - filePath: The path of the JWK Set to validate.
+//   - allowedAlgorithms: The allowed values of "alg", or nil to accept any algorithm.
+//
+// Returns:
+//   - []error: The issues found, or nil if the JWK Set is valid.
+func ValidateJWKSFile(filePath string, allowedAlgorithms []string) []error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return []error{fmt.Errorf("failed to read JWKS: %w", err)}
+	}
+
+	var document struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return []error{fmt.Errorf("failed to parse JWKS: %w", err)}
+	}
+	if len(document.Keys) == 0 {
+		return []error{fmt.Errorf("JWKS has no keys")}
+	}
+
+	var issues []error
+	keyIDs := make(map[string]int, len(document.Keys))
+	signingKeys := 0
+	for i, raw := range document.Keys {
+		key, err := jwk.ParseKey(raw)
+		if err != nil {
+			issues = append(issues, fmt.Errorf("key %d: failed to parse: %w", i, err))
+			continue
+		}
+
+		keyID, ok := key.KeyID()
+		if !ok || keyID == "" {
+			issues = append(issues, fmt.Errorf("key %d: missing kid", i))
+		} else if first, ok := keyIDs[keyID]; ok {
+			issues = append(issues, fmt.Errorf("key %d: kid %q already used by key %d", i, keyID, first))
+		} else {
+			keyIDs[keyID] = i
+		}
+
+		if err := validateJWK(key); err != nil {
+			issues = append(issues, fmt.Errorf("key %d: %w", i, err))
+		}
+
+		if len(allowedAlgorithms) > 0 {
+			algorithm, ok := key.Algorithm()
+			if !ok {
+				issues = append(issues, fmt.Errorf("key %d: missing alg, expected one of %s", i, strings.Join(allowedAlgorithms, ", ")))
+			} else if !slices.Contains(allowedAlgorithms, algorithm.String()) {
+				issues = append(issues, fmt.Errorf("key %d: alg %s is not one of %s", i, algorithm, strings.Join(allowedAlgorithms, ", ")))
+			}
+		}
+
+		if usage, ok := key.KeyUsage(); !ok || usage == JWKSUsage {
+			signingKeys++
+		}
+	}
+
+	if signingKeys == 0 {
+		issues = append(issues, fmt.Errorf("JWKS has no signing key (use %q)", JWKSUsage))
+	}
+
+	return issues
+}
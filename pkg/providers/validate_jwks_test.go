@@ -0,0 +1,101 @@
+package providers
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// newTestJWK imports the public key of the raw private key into a JWK, removing the given
+// parameters to simulate a malformed import.
+func newTestJWK(t *testing.T, rawKey any, strip ...string) jwk.Key {
+	t.Helper()
+
+	privateKey, err := jwk.Import(rawKey)
+	if err != nil {
+		t.Fatalf("jwk.Import: %v", err)
+	}
+	key, err := jwk.PublicKeyOf(privateKey)
+	if err != nil {
+		t.Fatalf("jwk.PublicKeyOf: %v", err)
+	}
+	for _, parameter := range strip {
+		if err := key.Remove(parameter); err != nil {
+			t.Fatalf("Remove(%q): %v", parameter, err)
+		}
+	}
+	return key
+}
+
+func TestValidateJWK(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, okpKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     jwk.Key
+		wantErr string
+	}{
+		{name: "RSA", key: newTestJWK(t, rsaKey)},
+		{name: "EC", key: newTestJWK(t, ecKey)},
+		{name: "OKP", key: newTestJWK(t, okpKey)},
+		{name: "RSA without e", key: newTestJWK(t, rsaKey, "e"), wantErr: "RSA key is missing required parameters: e"},
+		{name: "EC without x and y", key: newTestJWK(t, ecKey, "x", "y"), wantErr: "EC key is missing required parameters: x, y"},
+		{name: "OKP without x", key: newTestJWK(t, okpKey, "x"), wantErr: "OKP key is missing required parameters: x"},
+		{name: "symmetric key", key: newTestJWK(t, []byte("secret")), wantErr: `unsupported key type "oct"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateJWK(tt.key)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateJWK: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateJWKSetRejectsStrippedKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := jwk.NewSet()
+	if err := set.AddKey(newTestJWK(t, rsaKey)); err != nil {
+		t.Fatal(err)
+	}
+	stripped := newTestJWK(t, rsaKey, "n")
+	if err := stripped.Set(jwk.KeyIDKey, "stripped"); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.AddKey(stripped); err != nil {
+		t.Fatal(err)
+	}
+
+	err = validateJWKSet(set)
+	if err == nil || !strings.Contains(err.Error(), `invalid key "stripped"`) {
+		t.Fatalf("err = %v, want the stripped key to be reported", err)
+	}
+}
@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chuhaoyuu/aws-oidc-sts/pkg/workerpool"
+)
+
+// IssuerStatus is the outcome of the verification of a single issuer by VerifyIssuers.
+type IssuerStatus struct {
+	// Issuer is the verified issuer URL.
+	Issuer string
+	// JWKSURI is the jwks_uri advertised by the discovery document, when it was fetched.
+	JWKSURI string
+	// Keys is the number of keys published in the JWKS, when it was fetched.
+	Keys int
+	// Err is the reason the verification failed, or nil when it passed.
+	Err error
+}
+
+// OK reports whether the issuer passed the verification.
+func (s IssuerStatus) OK() bool {
+	return s.Err == nil
+}
+
+// ReadIssuersFile reads the issuer URLs listed in the given file, one per line. Blank lines
+// and lines starting with # are ignored.
+func ReadIssuersFile(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open issuers file: %w", err)
+	}
+	defer file.Close()
+
+	var issuers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		issuers = append(issuers, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read issuers file: %w", err)
+	}
+	if len(issuers) == 0 {
+		return nil, fmt.Errorf("no issuer listed in %s", filePath)
+	}
+
+	return issuers, nil
+}
+
+// VerifyIssuers verifies the health of several issuers at once, with at most concurrency of
+// them verified simultaneously. For each issuer, the discovery document is fetched and
+// validated with FetchOpenIDConfiguration, then the JWKS it advertises with FetchJWKS, which
+// must publish at least one key.
+//
+// Every issuer is verified even when others fail, and the statuses are returned in the
+// order of the issuers.
+func VerifyIssuers(issuers []string, concurrency int) []IssuerStatus {
+	statuses := make([]IssuerStatus, len(issuers))
+	_ = workerpool.Run(concurrency, len(issuers), func(i int) error {
+		statuses[i] = verifyIssuer(issuers[i])
+		return nil
+	})
+
+	return statuses
+}
+
+// verifyIssuer fetches and validates the discovery document and the JWKS of the issuer.
+func verifyIssuer(issuer string) IssuerStatus {
+	status := IssuerStatus{Issuer: issuer}
+
+	discovery, err := FetchOpenIDConfiguration(issuer)
+	if err != nil {
+		status.Err = err
+		return status
+	}
+	status.JWKSURI = discovery.JWKSURI
+
+	set, err := FetchJWKS(discovery.JWKSURI)
+	if err != nil {
+		status.Err = err
+		return status
+	}
+	status.Keys = set.Len()
+	if status.Keys == 0 {
+		status.Err = fmt.Errorf("JWKS at %s has no keys", discovery.JWKSURI)
+	}
+
+	return status
+}
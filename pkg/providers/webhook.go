@@ -0,0 +1,88 @@
+package providers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// WebhookSignatureHeader is the header carrying the HMAC-SHA256 signature of the webhook
+	// body, as "sha256=" followed by the hex-encoded signature.
+	WebhookSignatureHeader = "X-Aws-Oidc-Sts-Signature"
+	// webhookTimeout bounds the delivery of a webhook notification.
+	webhookTimeout = 10 * time.Second
+)
+
+// WebhookPayload is the JSON body of the webhook notification sent after a provisioning run.
+type WebhookPayload struct {
+	// Command is the name of the command that ran, e.g. identity-provider.
+	Command string `json:"command"`
+	// Success reports whether the run succeeded.
+	Success bool `json:"success"`
+	// Time is the time the run completed.
+	Time time.Time `json:"time"`
+	// Result describes the provisioned identity provider, on success.
+	Result *IdentityProviderResult `json:"result,omitempty"`
+	// Error is the error of the run, on failure.
+	Error string `json:"error,omitempty"`
+}
+
+// WebhookSignature returns the value of the WebhookSignatureHeader for the body: the
+// hex-encoded HMAC-SHA256 of the body keyed with secret, prefixed with "sha256=". Receivers
+// recompute it over the raw body and compare it with hmac.Equal.
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SendWebhook POSTs the payload as JSON to the webhook URL, signed with the
+// WebhookSignatureHeader when secret is set.
+//
+// Returns:
+//   - nil if the receiver answered with a 2xx status.
+//   - an error if the URL is not an http or https URL, the request fails or another status
+//     is returned.
+func SendWebhook(webhookURL, secret string, payload WebhookPayload) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse webhook URL: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("webhook URL %s must be an http or https URL", u.Redacted())
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(WebhookSignatureHeader, WebhookSignature(secret, body))
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook to %s: %w", u.Redacted(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to send webhook to %s: unexpected status %s", u.Redacted(), resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+// Package workerpool runs batches of independent tasks with bounded concurrency.
+package workerpool
+
+import (
+	"errors"
+	"sync"
+)
+
+// DefaultConcurrency is the default number of tasks run simultaneously by batch operations.
+const DefaultConcurrency = 4
+
+// Run calls fn for every index in [0, n) with at most limit calls running simultaneously.
+// A limit below 1 runs the tasks one at a time.
+//
+// Every task is run even if some of them fail. The errors returned by the tasks are
+// joined in index order, and nil is returned when all of them succeed.
+func Run(limit, n int, fn func(i int) error) error {
+	if limit < 1 {
+		limit = 1
+	}
+
+	sem := make(chan struct{}, limit)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
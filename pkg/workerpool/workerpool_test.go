@@ -0,0 +1,96 @@
+package workerpool
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// runTracked runs n tasks with Run and returns the peak number of tasks in flight and the
+// number of tasks run. It fails the test if Run does not return in time.
+func runTracked(t *testing.T, limit, n int) (peak, calls int32) {
+	t.Helper()
+
+	var inFlight, maxInFlight, total atomic.Int32
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(limit, n, func(int) error {
+			current := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				observed := maxInFlight.Load()
+				if current <= observed || maxInFlight.CompareAndSwap(observed, current) {
+					break
+				}
+			}
+			total.Add(1)
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run(%d, %d) did not return", limit, n)
+	}
+
+	return maxInFlight.Load(), total.Load()
+}
+
+func TestRunBoundsConcurrency(t *testing.T) {
+	tests := []struct {
+		limit    int
+		n        int
+		wantPeak int32
+	}{
+		{limit: 3, n: 20, wantPeak: 3},
+		{limit: 8, n: 4, wantPeak: 4},
+		{limit: 1, n: 5, wantPeak: 1},
+		{limit: 0, n: 5, wantPeak: 1},
+		{limit: -2, n: 5, wantPeak: 1},
+		{limit: 2, n: 0, wantPeak: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("limit=%d,n=%d", tt.limit, tt.n), func(t *testing.T) {
+			peak, calls := runTracked(t, tt.limit, tt.n)
+			if calls != int32(tt.n) {
+				t.Errorf("calls = %d, want %d", calls, tt.n)
+			}
+			if peak != tt.wantPeak {
+				t.Errorf("peak in-flight calls = %d, want %d", peak, tt.wantPeak)
+			}
+		})
+	}
+}
+
+func TestRunJoinsErrorsInIndexOrder(t *testing.T) {
+	errOne, errThree := errors.New("one"), errors.New("three")
+	var calls atomic.Int32
+	err := Run(2, 4, func(i int) error {
+		calls.Add(1)
+		switch i {
+		case 1:
+			return errOne
+		case 3:
+			return errThree
+		}
+		return nil
+	})
+
+	if calls.Load() != 4 {
+		t.Errorf("calls = %d, want every task to run", calls.Load())
+	}
+	if !errors.Is(err, errOne) || !errors.Is(err, errThree) {
+		t.Fatalf("err = %v, want both task errors", err)
+	}
+	if err.Error() != "one\nthree" {
+		t.Errorf("err = %q, want the errors in index order", err.Error())
+	}
+}